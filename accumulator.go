@@ -0,0 +1,218 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"slices"
+	"sync"
+)
+
+// Accumulator accumulates the number and size of files in to Stats for every
+// directory they are nested within, per BoM, like BoMDirectoryStats() does.
+// It's for when you want to drive your own read loop, eg. to combine entries
+// from multiple sources.
+type Accumulator struct {
+	mu         *sync.Mutex
+	stats      bomDirectoryStats
+	sizePolicy SizePolicy
+}
+
+// SizePolicy determines which types of entry have their size counted by
+// Accumulator.AddEntry(). The zero value counts the sizes of regular files
+// only.
+//
+// It only affects Accumulator: BoMDirectoryStats(), BoMDirectoryUserStats()
+// and the other functions that take a StatsParser count the size of every
+// entry the parser returns, so use its FilterForType() etc. to control those.
+type SizePolicy struct {
+	all   bool
+	types []byte
+}
+
+// RegularFileSizes returns the default SizePolicy, where only the sizes of
+// regular files are counted.
+func RegularFileSizes() SizePolicy {
+	return SizePolicy{}
+}
+
+// AllEntrySizes returns a SizePolicy where the sizes of entries of every type
+// are counted.
+func AllEntrySizes() SizePolicy {
+	return SizePolicy{all: true}
+}
+
+// EntryTypeSizes returns a SizePolicy where only the sizes of entries of the
+// given types (eg. 'f' for files, 'd' for directories) are counted.
+func EntryTypeSizes(types ...byte) SizePolicy {
+	return SizePolicy{types: types}
+}
+
+// counts returns true if the size of entries of the given type should be
+// counted.
+func (sp SizePolicy) counts(entryType byte) bool {
+	if sp.all {
+		return true
+	}
+
+	if len(sp.types) == 0 {
+		return entryType == fileType
+	}
+
+	return slices.Contains(sp.types, entryType)
+}
+
+// NewAccumulator returns a new Accumulator that is not safe for concurrent
+// use.
+func NewAccumulator() *Accumulator {
+	return &Accumulator{stats: make(bomDirectoryStats)}
+}
+
+// NewSyncAccumulator returns a new Accumulator that is safe to Add() to from
+// multiple goroutines at once.
+func NewSyncAccumulator() *Accumulator {
+	acc := NewAccumulator()
+	acc.mu = &sync.Mutex{}
+
+	return acc
+}
+
+// Add adds a file of the given size with the given full path to the Stats of
+// the given BoM. The given bom is retained, so must not be altered afterwards,
+// but path is not.
+//
+// Since only the size is known, the file is treated as having an mtime of 0
+// and a single hardlink; use AddEntry() to have those counted correctly.
+func (a *Accumulator) Add(bom []byte, path []byte, size int64) {
+	a.addFile(bom, path, newFileStats(size, 0, 1))
+}
+
+// AddEntry is like Add(), but takes all the details from the given Entry. The
+// Entry is always counted, but its size is only counted if its type is allowed
+// by our SizePolicy (by default only regular files). This matters if you filter
+// the StatsParser for entries other than regular files.
+func (a *Accumulator) AddEntry(bom []byte, entry Entry) {
+	size := entry.Size
+	if !a.sizePolicy.counts(entry.EntryType) {
+		size = 0
+	}
+
+	a.addFile(bom, entry.Path, newFileStats(size, entry.MTime, entry.Nlink))
+}
+
+// SetSizePolicy changes which types of entry AddEntry() counts the sizes of,
+// from the default RegularFileSizes(). Add() is not affected.
+func (a *Accumulator) SetSizePolicy(policy SizePolicy) {
+	a.sizePolicy = policy
+}
+
+// addFile adds the given Stats of a single file with the given full path to
+// the Stats of the given BoM.
+func (a *Accumulator) addFile(bom []byte, path []byte, file *Stats) {
+	if a.mu != nil {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+	}
+
+	accumulateDirStats(path, file, bom, a.stats)
+}
+
+// Result returns the Stats accumulated so far, sorted in the same way as
+// BoMDirectoryStats().
+func (a *Accumulator) Result() []*Stats {
+	if a.mu != nil {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+	}
+
+	return sortBoMDirectoryStats(a.stats)
+}
+
+// DrainByBoM is an alternative to Result() for very large results, that calls
+// the given function with the Stats of each BoM in turn (in BoM name order),
+// sorted in the same way as Result() would sort them. Each BoM's Stats are
+// removed from the Accumulator before the function is called, so that the
+// memory used by them can be freed as soon as the function is done with them,
+// instead of all the results being held at once. The Stats are grouped by BoM
+// in a single pass up front. This leaves the Accumulator empty.
+//
+// The slice passed to the function is reused for the next BoM, so must not be
+// retained. If the function returns an error, draining stops and the error is
+// returned.
+func (a *Accumulator) DrainByBoM(fn func(stats []*Stats) error) error {
+	if a.mu != nil {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+	}
+
+	keys, boms := a.stats.keysByBoM()
+
+	var bomStats []*Stats
+
+	for _, bom := range boms {
+		bomStats = a.stats.take(keys[bom], bomStats[:0])
+		delete(keys, bom)
+
+		sortStats(bomStats)
+
+		if err := fn(bomStats); err != nil {
+			return err
+		}
+
+		clear(bomStats)
+	}
+
+	return nil
+}
+
+// keysByBoM returns our keys grouped by the BoM of their Stats, along with the
+// distinct BoMs, sorted by name.
+func (bds bomDirectoryStats) keysByBoM() (map[string][]string, []string) {
+	keys := make(map[string][]string)
+
+	for key, s := range bds {
+		keys[string(s.BoM)] = append(keys[string(s.BoM)], key)
+	}
+
+	boms := make([]string, 0, len(keys))
+
+	for bom := range keys {
+		boms = append(boms, bom)
+	}
+
+	slices.Sort(boms)
+
+	return keys, boms
+}
+
+// take removes the Stats with the given keys from us, appending them to the
+// given slice.
+func (bds bomDirectoryStats) take(keys []string, stats []*Stats) []*Stats {
+	for _, key := range keys {
+		stats = append(stats, bds[key])
+
+		delete(bds, key)
+	}
+
+	return stats
+}
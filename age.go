@@ -0,0 +1,85 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	hoursInDay    = 24
+	daysPerYear   = 365
+	daysPerWeek   = 7
+	monthsPerYear = 12
+	day           = hoursInDay * time.Hour
+	year          = daysPerYear * day
+
+	ErrBadAgeDuration = Error("invalid age duration")
+)
+
+// ageUnits are the suffixes ParseAge() understands beyond those of
+// time.ParseDuration(). "m" is not included, since it means minutes there.
+var ageUnits = []struct { //nolint:gochecknoglobals
+	suffix   string
+	duration time.Duration
+}{
+	{"mo", year / monthsPerYear},
+	{"y", year},
+	{"w", daysPerWeek * day},
+	{"d", day},
+}
+
+// ParseAge parses an age like "5y" (years of 365 days), "18mo" (months of a
+// twelfth of a year), "2w" (weeks) or "30d" (days), or any duration understood
+// by time.ParseDuration(), such as "43800h".
+func ParseAge(age string) (time.Duration, error) {
+	for _, unit := range ageUnits {
+		n, found := strings.CutSuffix(age, unit.suffix)
+		if !found {
+			continue
+		}
+
+		num, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return 0, ErrBadAgeDuration
+		}
+
+		d := num * float64(unit.duration)
+		if math.IsNaN(d) || math.Abs(d) >= math.MaxInt64 {
+			return 0, ErrBadAgeDuration
+		}
+
+		return time.Duration(d), nil
+	}
+
+	d, err := time.ParseDuration(age)
+	if err != nil {
+		return 0, ErrBadAgeDuration
+	}
+
+	return d, nil
+}
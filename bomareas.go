@@ -0,0 +1,118 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const numBoMAreasColumns = 2
+
+// GroupLookup returns the GID of the given unix group name.
+type GroupLookup func(group string) (int, error)
+
+// lookupGroupGID is a GroupLookup that asks the OS.
+func lookupGroupGID(group string) (int, error) {
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(g.Gid)
+}
+
+// GenerateBoMGIDs reads bom.areas data, which is CSV of unix group name and
+// BoM area, like:
+//
+//	group1,area1
+//	group2,area1
+//	group3,area2
+//
+// and writes the corresponding bom.gids data (see NewGIDToBoM()) to the given
+// writer, with the areas sorted by name and their GIDs in the order their
+// groups appeared. Group names are resolved to GIDs using the given lookup;
+// groups that can't be resolved are skipped with a warning.
+func GenerateBoMGIDs(r io.Reader, w io.Writer, lookup GroupLookup) error {
+	areaGIDs, err := parseBoMAreas(r, lookup)
+	if err != nil {
+		return err
+	}
+
+	areas := make([]string, 0, len(areaGIDs))
+
+	for area := range areaGIDs {
+		areas = append(areas, area)
+	}
+
+	slices.Sort(areas)
+
+	for _, area := range areas {
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", area, strings.Join(areaGIDs[area], ",")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseBoMAreas returns the GIDs of the groups in each area of the given
+// bom.areas data.
+func parseBoMAreas(r io.Reader, lookup GroupLookup) (map[string][]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = numBoMAreasColumns
+
+	areaGIDs := make(map[string][]string)
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return areaGIDs, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		group, area := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if area == "" {
+			return nil, ErrEmptyBoM
+		}
+
+		gid, err := lookup(group)
+		if err != nil {
+			l.Warnf("skipping group %s of area %s: %s", group, area, err)
+
+			continue
+		}
+
+		areaGIDs[area] = append(areaGIDs[area], strconv.Itoa(gid))
+	}
+}
@@ -24,139 +24,1777 @@
 package main
 
 import (
+	"bytes"
 	"cmp"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"regexp"
 	"slices"
 	"strings"
+	"syscall"
 	"time"
 )
 
 const (
 	bytesPerKiB     = 1024
 	bytesPerGiB     = (bytesPerKiB * bytesPerKiB * bytesPerKiB)
+	bytesPerKB      = 1000
+	bytesPerGB      = (bytesPerKB * bytesPerKB * bytesPerKB)
 	bomDirSeparator = ":"
+	tmpSuffix       = ".tmp"
 )
 
+// SizeUnit is the unit that sizes are printed in.
+type SizeUnit int
+
+const (
+	// GiB is binary gibibytes (1024^3 bytes).
+	GiB SizeUnit = iota
+
+	// GB is decimal gigabytes (1000^3 bytes).
+	GB
+)
+
+// String returns the label for this unit, eg. "GiB".
+func (u SizeUnit) String() string {
+	if u == GB {
+		return "GB"
+	}
+
+	return "GiB"
+}
+
+// divisor returns the number of bytes in this unit.
+func (u SizeUnit) divisor() int64 {
+	if u == GB {
+		return bytesPerGB
+	}
+
+	return bytesPerGiB
+}
+
+// Stats holds the number and size of files nested within a directory.
+// OwnCount and OwnSize only count the files directly in the directory.
+// HardlinkedFiles counts the nested files that have more than 1 hardlink, and
+// OldestMTime is the mtime of the least recently modified nested file.
+// MinSize and MaxSize are the sizes of the smallest and largest nested files,
+// where MinSize ignores empty files (and is 0 if all are empty) unless
+// WithEmptyFilesInMinSize() was used. EmptyFiles counts the nested files of
+// size 0. PathBytes is the total length of the paths of the nested files, if
+// WithPathBytes() was used. TotalCount and TotalSize count all the nested
+// files, whether old or not, if WithTotals() was used. Cost is the sum of the
+// sizes of the nested files multiplied by their GID's rate, if WithGIDCosts()
+// was used.
 type Stats struct {
-	BoM       []byte
-	Directory string
-	Count     uint64
-	Size      int64 // in bytes
+	BoM             []byte
+	Directory       string
+	Count           uint64
+	Size            int64 // in bytes
+	OwnCount        uint64
+	OwnSize         int64 // in bytes
+	HardlinkedFiles uint64
+	OldestMTime     int64
+	MinSize         int64
+	MaxSize         int64
+	EmptyFiles      uint64
+	PathBytes       int64
+	TotalCount      uint64
+	TotalSize       int64
+	Cost            float64
+}
+
+// ColdFraction returns the fraction of the TotalSize of the directory that is
+// made up of old files, ie. Size / TotalSize. Returns 0 if TotalSize is 0,
+// which will be the case if WithTotals() wasn't used.
+func (s *Stats) ColdFraction() float64 {
+	if s.TotalSize == 0 {
+		return 0
+	}
+
+	return float64(s.Size) / float64(s.TotalSize)
 }
 
 type bomDirectoryStats map[string]*Stats
 
+const (
+	ErrNoData      = Error("no stats data was parsed")
+	ErrNoAgeFilter = Error("stats parser has no age filter, so results would not just be of old files")
+	ErrNoCapture   = Error("path key pattern has no capture group")
+
+	unmatchedKey = "unmatched"
+	otherRootKey = "other"
+)
+
+// StatsOption is an option that alters how BoMDirectoryStats() aggregates
+// stats.
+type StatsOption func(*statsOptions)
+
+type statsOptions struct {
+	spillThreshold int
+	spillDir       string
+	order          SortOrder
+	capacity       int
+	bomAges        map[string]time.Duration
+	bomCutoffs     map[string]int64
+	defaultCutoff  int64
+	rootSlash      []byte
+	keyPattern     *regexp.Regexp
+	projectRoots   map[string]bool
+	emptyMinSize   bool
+	pathBytes      bool
+	totals         bool
+	minCold        float64
+	directOnly     bool
+	bomsBySize     bool
+	gidCosts       map[int64]float64
+	defaultCost    float64
+}
+
+func newStatsOptions(opts []StatsOption) *statsOptions {
+	so := &statsOptions{}
+
+	for _, opt := range opts {
+		opt(so)
+	}
+
+	return so
+}
+
 // BoMDirectoryStats uses the given StatsParser and GIDToBoM to find the number
 // and size of all files belonging to each BoM area that are older than the
 // given duration, and returns a slice of ?.
-func BoMDirectoryStats(sp *StatsParser, gp *GIDToBoM, d time.Duration) ([]*Stats, error) {
-	sp.FilterForFilesOlderThan(d)
+//
+// Returns ErrNoData (along with the empty results) if the StatsParser had no
+// entries at all, since that likely means its input was broken.
+func BoMDirectoryStats(sp *StatsParser, gp *GIDToBoM, d time.Duration, opts ...StatsOption) ([]*Stats, error) {
+	so := newStatsOptions(opts)
 
-	bomToDirToStats, err := getBoMDirectoryStats(sp, gp)
-	if err != nil {
+	stats, err := bomDirectoryStatsWithOptions(sp, gp, d, so)
+	if err == nil && sp.EntriesParsed() == 0 {
+		err = ErrNoData
+	}
+
+	if so.order != LargestFirst {
+		SortStats(stats, so.order)
+	}
+
+	if so.emptyMinSize {
+		includeEmptyFilesInMinSize(stats)
+	}
+
+	if so.totals {
+		stats = so.coldEnough(stats)
+	}
+
+	if so.directOnly {
+		stats = withOwnFiles(stats)
+	}
+
+	if so.bomsBySize {
+		groupBoMsLargestFirst(stats)
+	}
+
+	return stats, err
+}
+
+// groupBoMsLargestFirst stably sorts the given stats so that those of each BoM
+// are together, with the BoMs with the largest total size first (then by name).
+// A BoM's total size is the sum of the OwnSizes of its Stats, so that it is
+// correct even if there is no "/" directory.
+func groupBoMsLargestFirst(stats []*Stats) {
+	totals := make(map[string]int64)
+
+	for _, s := range stats {
+		totals[string(s.BoM)] += s.OwnSize
+	}
+
+	slices.SortStableFunc(stats, func(a, b *Stats) int {
+		if n := cmp.Compare(totals[string(b.BoM)], totals[string(a.BoM)]); n != 0 {
+			return n
+		}
+
+		return bytes.Compare(a.BoM, b.BoM)
+	})
+}
+
+// withOwnFiles returns the given stats minus those of directories that have no
+// files directly within them.
+func withOwnFiles(stats []*Stats) []*Stats {
+	return slices.DeleteFunc(stats, func(s *Stats) bool {
+		return s.OwnCount == 0
+	})
+}
+
+// coldEnough returns the given stats minus those of directories with no old
+// files, and those with a ColdFraction less than our minCold.
+func (so *statsOptions) coldEnough(stats []*Stats) []*Stats {
+	return slices.DeleteFunc(stats, func(s *Stats) bool {
+		return s.Count == 0 || s.ColdFraction() < so.minCold
+	})
+}
+
+// includeEmptyFilesInMinSize sets the MinSize of the given Stats that have
+// nested empty files to 0.
+func includeEmptyFilesInMinSize(stats []*Stats) {
+	for _, s := range stats {
+		if s.EmptyFiles > 0 {
+			s.MinSize = 0
+		}
+	}
+}
+
+func bomDirectoryStatsWithOptions(sp *StatsParser, gp *GIDToBoM, d time.Duration,
+	so *statsOptions) ([]*Stats, error) {
+	if err := so.prepare(sp, d); err != nil {
 		return nil, err
 	}
 
-	return sortBoMDirectoryStats(bomToDirToStats), nil
+	if so.spillThreshold > 0 {
+		return spillingBoMDirectoryStats(sp, gp, so)
+	}
+
+	return getBoMDirectoryStats(sp, gp, so)
+}
+
+// prepare validates our options and sets up the given StatsParser's filters and
+// our age cutoffs for finding files older than the given duration.
+func (so *statsOptions) prepare(sp *StatsParser, d time.Duration) error {
+	if so.keyPattern != nil && so.keyPattern.NumSubexp() < 1 {
+		return ErrNoCapture
+	}
+
+	if so.totals {
+		sp.FilterForFiles()
+	} else {
+		sp.FilterForFilesOlderThan(so.youngestAge(d))
+	}
+
+	so.setBoMCutoffs(sp, d)
+
+	return nil
 }
 
-func getBoMDirectoryStats(sp *StatsParser, gp *GIDToBoM) (bomDirectoryStats, error) {
-	bomToDirToStats := make(bomDirectoryStats)
+// BoMOverSize uses the given StatsParser and GIDToBoM like BoMDirectoryStats(),
+// but instead of aggregating directory stats, it keeps a running total of the
+// size of the old files of each BoM, and returns the first BoM whose total
+// exceeds the given threshold as soon as it does so, without reading the rest
+// of the input. This lets you quickly alert on any BoM having too much old data.
+//
+// Returns an empty string if no BoM exceeded the threshold by the end of the
+// input, along with ErrNoData if the StatsParser had no entries at all.
+//
+// Of the StatsOptions, only those that change which files are counted, like
+// WithBoMAges() and WithRoot(), have an effect.
+func BoMOverSize(sp *StatsParser, gp *GIDToBoM, d time.Duration, threshold int64,
+	opts ...StatsOption) (string, error) {
+	so := newStatsOptions(opts)
+
+	if err := so.prepare(sp, d); err != nil {
+		return "", err
+	}
+
+	totals := make(map[string]int64)
 
 	for sp.Scan() {
 		bom, err := gp.GetBom(int(sp.GID))
 		if err != nil {
-			return nil, err
+			return "", err
+		}
+
+		if so.outsideRoot(sp.Path) || !so.oldEnough(sp, bom) {
+			continue
+		}
+
+		totals[string(bom)] += sp.Size
+
+		if totals[string(bom)] > threshold {
+			return string(bom), nil
 		}
+	}
+
+	if err := sp.Err(); err != nil {
+		return "", err
+	}
 
-		accumulateDirStats(sp.Path, sp, bom, bomToDirToStats)
+	if sp.EntriesParsed() == 0 {
+		return "", ErrNoData
 	}
 
-	return bomToDirToStats, sp.Err()
+	return "", nil
 }
 
-func accumulateDirStats(fullPath []byte, sp *StatsParser, bom []byte, bomToDirToStats bomDirectoryStats) {
-	for i, b := range fullPath {
-		if b != '/' {
-			continue
-		}
+// WithBoMAges makes BoMDirectoryStats() only count the files of the given BoMs
+// that are older than the corresponding durations, instead of the duration
+// passed to BoMDirectoryStats(), which still applies to BoMs not in the map.
+func WithBoMAges(ages map[string]time.Duration) StatsOption {
+	return func(so *statsOptions) {
+		so.bomAges = ages
+	}
+}
 
-		end := i
-		if i == 0 {
-			end = i + 1
+// WithLargestBoMsFirst makes BoMDirectoryStats() group its results by BoM, with
+// the BoMs with the largest total size of old files first, while the Stats
+// within each BoM remain in the WithSortOrder() order. This is useful when
+// writing every BoM to a single file, eg. with
+// WriteBoMDirectoryStatsNDJSON().
+func WithLargestBoMsFirst() StatsOption {
+	return func(so *statsOptions) {
+		so.bomsBySize = true
+	}
+}
+
+// WithGIDCosts makes BoMDirectoryStats() calculate the Cost of each directory,
+// by summing the size of each nested file multiplied by the cost per byte of
+// its GID in the given map, or by the given default cost per byte if its GID
+// isn't in the map. Use WithCostColumn() to print the costs.
+func WithGIDCosts(costs map[int64]float64, defaultCost float64) StatsOption {
+	return func(so *statsOptions) {
+		so.gidCosts = costs
+		so.defaultCost = defaultCost
+	}
+}
+
+// cost returns the cost of the given StatsParser's current entry per our
+// gidCosts, or 0 if WithGIDCosts() wasn't used.
+func (so *statsOptions) cost(sp *StatsParser) float64 {
+	if so.gidCosts == nil {
+		return 0
+	}
+
+	rate, ok := so.gidCosts[sp.GID]
+	if !ok {
+		rate = so.defaultCost
+	}
+
+	return float64(sp.Size) * rate
+}
+
+// WithTotals makes BoMDirectoryStats() also count the number and size of all
+// files in each directory, regardless of age, in the TotalCount and TotalSize of
+// its Stats, so that you can get each directory's ColdFraction(). Directories
+// with no old files are still not returned. The StatsParser is filtered for
+// files, instead of old files.
+func WithTotals() StatsOption {
+	return func(so *statsOptions) {
+		so.totals = true
+	}
+}
+
+// WithMinColdFraction implies WithTotals(), and makes BoMDirectoryStats() only
+// return the Stats of directories with at least the given ColdFraction(), eg.
+// 0.9 to find directories that are at least 90% old by size, which might be
+// archived wholesale.
+func WithMinColdFraction(fraction float64) StatsOption {
+	return func(so *statsOptions) {
+		so.totals = true
+		so.minCold = fraction
+	}
+}
+
+// WithDirectFilesOnly makes BoMDirectoryStats() only return the Stats of
+// directories that directly contain at least one old file (ie. have an OwnCount
+// greater than 0), omitting the directories that only have old files nested in
+// their subdirectories. The returned Stats are still cumulative.
+func WithDirectFilesOnly() StatsOption {
+	return func(so *statsOptions) {
+		so.directOnly = true
+	}
+}
+
+// WithEmptyFilesInMinSize makes BoMDirectoryStats() consider empty files when
+// working out the MinSize of each directory, so that any directory containing
+// an empty file has a MinSize of 0.
+func WithEmptyFilesInMinSize() StatsOption {
+	return func(so *statsOptions) {
+		so.emptyMinSize = true
+	}
+}
+
+// WithPathBytes makes BoMDirectoryStats() total up the lengths of the decoded
+// paths of the files nested within each directory in their PathBytes, which
+// correlates with the dentry memory they need.
+func WithPathBytes() StatsOption {
+	return func(so *statsOptions) {
+		so.pathBytes = true
+	}
+}
+
+// WithRoot makes BoMDirectoryStats() only count the files nested within the
+// given root directory, and only output Stats for the root and the directories
+// within it, skipping the work of creating the Stats of its ancestors.
+func WithRoot(root string) StatsOption {
+	return func(so *statsOptions) {
+		root = strings.TrimRight(root, "/")
+		if root != "" {
+			so.rootSlash = []byte(root + "/")
 		}
+	}
+}
 
-		thisDir := string(fullPath[0:end])
+// WithPathKey makes BoMDirectoryStats() aggregate files by the first capture
+// group of the given regular expression when matched against their paths,
+// instead of by the directories they are nested within. The Directory of each
+// resulting Stats is then the captured key, or "unmatched" for the files whose
+// path didn't match. For example, `/project_([^/]+)/` would give per-project
+// totals for each BoM.
+//
+// BoMDirectoryStats() will return ErrNoCapture if the expression has no capture
+// group.
+func WithPathKey(re *regexp.Regexp) StatsOption {
+	return func(so *statsOptions) {
+		so.keyPattern = re
+	}
+}
 
-		key := string(bom) + bomDirSeparator + thisDir
+// WithProjectRoots makes BoMDirectoryStats() attribute each file to the nearest
+// of its ancestor directories that is one of the given roots, instead of to
+// every directory it is nested within. The Directory of each resulting Stats is
+// then one of the roots, or "other" for the files not nested within any of
+// them.
+func WithProjectRoots(roots []string) StatsOption {
+	return func(so *statsOptions) {
+		so.projectRoots = make(map[string]bool, len(roots))
 
-		stats, ok := bomToDirToStats[key]
-		if !ok {
-			stats = &Stats{
-				BoM:       bom,
-				Directory: thisDir,
+		for _, root := range roots {
+			if root = strings.TrimRight(root, "/"); root != "" {
+				so.projectRoots[root] = true
 			}
-			bomToDirToStats[key] = stats
 		}
+	}
+}
 
-		stats.Count++
-		stats.Size += sp.Size
+// nearestProjectRoot returns the deepest of our projectRoots that the given
+// path is nested within, or otherRootKey if none.
+func (so *statsOptions) nearestProjectRoot(fullPath []byte) string {
+	for i := len(fullPath) - 1; i > 0; i-- {
+		if fullPath[i] == '/' && so.projectRoots[string(fullPath[:i])] {
+			return string(fullPath[:i])
+		}
 	}
+
+	return otherRootKey
 }
 
-func sortBoMDirectoryStats(bds bomDirectoryStats) []*Stats {
-	results := make([]*Stats, 0, len(bds))
+// accumulate calls accumulateDirStats(), unless WithRoot() was used, in which
+// case files outside of the root are ignored, and only the Stats of the root
+// and its subdirectories are added to; or WithPathKey() or WithProjectRoots()
+// were used, in which case the file is added to the Stats of its key or root.
+// If WithPathBytes() was used, the length of fullPath is added to the file's
+// Stats first, unless it's a young file only being counted WithTotals().
+func (so *statsOptions) accumulate(fullPath []byte, file *Stats, bom []byte, store dirStatsStore) {
+	if so.outsideRoot(fullPath) {
+		return
+	}
 
-	for _, stats := range bds {
-		results = append(results, stats)
+	if so.pathBytes && file.Count > 0 {
+		file.PathBytes = int64(len(fullPath))
 	}
 
-	slices.SortFunc(results, func(a, b *Stats) int {
-		if n := cmp.Compare(b.Size, a.Size); n != 0 {
-			return n
-		}
+	switch {
+	case so.keyPattern != nil:
+		accumulateKeyStats(so.pathKey(fullPath), file, bom, store)
+	case so.projectRoots != nil:
+		accumulateKeyStats(so.nearestProjectRoot(fullPath), file, bom, store)
+	case so.rootSlash != nil:
+		accumulateDirStatsFrom(fullPath, len(so.rootSlash)-1, file, bom, store)
+	default:
+		accumulateDirStats(fullPath, file, bom, store)
+	}
+}
 
-		if n := cmp.Compare(strings.Count(a.Directory, "/"), strings.Count(b.Directory, "/")); n != 0 {
-			return n
-		}
+// outsideRoot returns true if we have a WithRoot() root and the given path is
+// not within it.
+func (so *statsOptions) outsideRoot(fullPath []byte) bool {
+	return so.rootSlash != nil && !bytes.HasPrefix(fullPath, so.rootSlash)
+}
 
-		return cmp.Compare(a.Directory, b.Directory)
-	})
+// pathKey returns the first capture of our keyPattern in the given path, or
+// unmatchedKey if it doesn't match.
+func (so *statsOptions) pathKey(fullPath []byte) string {
+	match := so.keyPattern.FindSubmatch(fullPath)
+	if match == nil {
+		return unmatchedKey
+	}
 
-	return results
+	return string(match[1])
 }
 
-// PrintBoMDirectoryStats takes BoMDirectoryStats() stats and writes them as
-// a TSV:
-//
-//	Directory	Count	Size
-//
-// With one line per Stats and one file per BoM area, with files named after
-// the given path suffixed with ".[bom name].tsv".
-func PrintBoMDirectoryStats(path string, stats []*Stats) error {
-	writers := make(map[string]*os.File)
+// accumulateKeyStats adds the given file's Stats to the Stats of the given key,
+// for which it is considered to be an own file.
+func accumulateKeyStats(key string, file *Stats, bom []byte, store dirStatsStore) {
+	s := store.statsFor(bom, key)
+	s.add(file)
+	s.OwnCount += file.Count
+	s.OwnSize += file.Size
+}
+
+// youngestAge returns the smallest of the given default duration and our
+// per-BoM ages, so that the StatsParser can filter out files that are too
+// young for any BoM.
+func (so *statsOptions) youngestAge(d time.Duration) time.Duration {
+	for _, age := range so.bomAges {
+		d = min(d, age)
+	}
+
+	return d
+}
+
+// setBoMCutoffs converts our per-BoM ages, and the given default duration, to
+// the epoch times relative to the given StatsParser's creation that files must
+// be older than.
+func (so *statsOptions) setBoMCutoffs(sp *StatsParser, d time.Duration) {
+	if len(so.bomAges) == 0 && !so.totals {
+		return
+	}
+
+	now := time.Unix(sp.now, 0)
+	so.defaultCutoff = now.Add(-d).Unix()
+	so.bomCutoffs = make(map[string]int64, len(so.bomAges))
+
+	for bom, age := range so.bomAges {
+		so.bomCutoffs[bom] = now.Add(-age).Unix()
+	}
+}
+
+// oldEnough returns true if sp's current entry is older than the age for the
+// given BoM. Always true without WithBoMAges() or WithTotals(), since the
+// StatsParser will have already filtered on age.
+func (so *statsOptions) oldEnough(sp *StatsParser, bom []byte) bool {
+	if so.bomCutoffs == nil {
+		return true
+	}
+
+	cutoff, ok := so.bomCutoffs[string(bom)]
+	if !ok {
+		cutoff = so.defaultCutoff
+	}
+
+	return sp.ageTime() <= cutoff
+}
+
+// BoMDirectoryStatsWithCounts is like BoMDirectoryStats(), but also returns the
+// number of distinct directories found for each BoM, keyed on BoM name.
+func BoMDirectoryStatsWithCounts(sp *StatsParser, gp *GIDToBoM, d time.Duration,
+	opts ...StatsOption) ([]*Stats, map[string]int, error) {
+	stats, err := BoMDirectoryStats(sp, gp, d, opts...)
+	if err != nil && !errors.Is(err, ErrNoData) {
+		return nil, nil, err
+	}
+
+	return stats, countBoMDirectories(stats), err
+}
+
+// RunSummary summarises the results of BoMDirectoryStatsWithSummary(): the
+// number of distinct BoMs and directories, the number and size of the old files
+// counted, and how long it took, along with a BoMSummary for each BoM.
+type RunSummary struct {
+	BoMs        int
+	Directories int
+	Files       uint64
+	Bytes       int64
+	Elapsed     time.Duration
+	PerBoM      map[string]*BoMSummary
+}
+
+// BoMSummary summarises the results for a single BoM: the number and size of
+// its old files, and the depths (see RollupToDepth()) of the shallowest and
+// deepest directories directly containing them, which shows if its data is
+// flat or deeply nested.
+type BoMSummary struct {
+	Files    uint64
+	Bytes    int64
+	MinDepth int
+	MaxDepth int
+}
+
+// add adds the files directly in the given Stats' directory to our summary.
+func (bs *BoMSummary) add(s *Stats) {
+	if s.OwnCount == 0 {
+		return
+	}
+
+	depth := dirDepth(s.Directory)
+
+	if bs.Files == 0 || depth < bs.MinDepth {
+		bs.MinDepth = depth
+	}
+
+	bs.MaxDepth = max(bs.MaxDepth, depth)
+	bs.Files += s.OwnCount
+	bs.Bytes += s.OwnSize
+}
+
+// BoMDirectoryStatsWithSummary is like BoMDirectoryStats(), but also returns a
+// RunSummary of the results.
+func BoMDirectoryStatsWithSummary(sp *StatsParser, gp *GIDToBoM, d time.Duration,
+	opts ...StatsOption) ([]*Stats, RunSummary, error) {
+	start := time.Now()
+
+	stats, err := BoMDirectoryStats(sp, gp, d, opts...)
+	if err != nil && !errors.Is(err, ErrNoData) {
+		return nil, RunSummary{}, err
+	}
+
+	summary := summarise(stats)
+	summary.Elapsed = time.Since(start)
+
+	return stats, summary, err
+}
+
+// summarise returns a RunSummary of the given stats, without an Elapsed time.
+// The files are those directly in each directory, so that they are counted
+// correctly even if there is no "/" directory.
+func summarise(stats []*Stats) RunSummary {
+	summary := RunSummary{Directories: len(stats), PerBoM: make(map[string]*BoMSummary)}
 
 	for _, s := range stats {
-		file, ok := writers[string(s.BoM)]
+		bs, ok := summary.PerBoM[string(s.BoM)]
 		if !ok {
-			var err error
+			bs = &BoMSummary{}
+			summary.PerBoM[string(s.BoM)] = bs
+		}
 
-			file, err = os.Create(fmt.Sprintf("%s.%s.tsv", path, s.BoM))
-			if err != nil {
-				return err
-			}
+		bs.add(s)
+		summary.Files += s.OwnCount
+		summary.Bytes += s.OwnSize
+	}
+
+	summary.BoMs = len(summary.PerBoM)
+
+	return summary
+}
+
+// countBoMDirectories returns the number of Stats (and so distinct
+// directories) each BoM has in the given stats.
+func countBoMDirectories(stats []*Stats) map[string]int {
+	counts := make(map[string]int)
+
+	for _, s := range stats {
+		counts[string(s.BoM)]++
+	}
+
+	return counts
+}
 
-			defer file.Close()
+// getBoMDirectoryStats aggregates the stats of sp's entries in memory. sp must
+// already have an age filter (or so must have age cutoffs), or ErrNoAgeFilter is
+// returned, since the results are expected to be of old files only.
+func getBoMDirectoryStats(sp *StatsParser, gp *GIDToBoM, so *statsOptions) ([]*Stats, error) {
+	if !so.ageFiltered(sp) {
+		return nil, ErrNoAgeFilter
+	}
+
+	acc := &Accumulator{stats: make(bomDirectoryStats, so.capacity)}
 
-			writers[string(s.BoM)] = file
+	for sp.Scan() {
+		bom, err := gp.GetBom(int(sp.GID))
+		if err != nil {
+			return nil, err
 		}
 
-		if _, err := fmt.Fprintf(file, "%s\t%d\t%.2f\n",
-			s.Directory, s.Count, float64(s.Size)/bytesPerGiB); err != nil {
+		so.accumulateIfOld(sp, bom, acc.stats)
+	}
+
+	if err := sp.Err(); err != nil {
+		return nil, err
+	}
+
+	return acc.Result(), nil
+}
+
+// ageFiltered returns true if either the given StatsParser filters on age, or
+// we have age cutoffs for oldEnough() to check.
+func (so *statsOptions) ageFiltered(sp *StatsParser) bool {
+	return sp.AgeFiltered() || so.bomCutoffs != nil
+}
+
+// accumulateIfOld accumulates the stats of sp's current entry in to the given
+// store under the given BoM, if it is oldEnough(). With WithTotals(), entries
+// that are not old enough are still added to the TotalCount and TotalSize.
+func (so *statsOptions) accumulateIfOld(sp *StatsParser, bom []byte, store dirStatsStore) {
+	old := so.oldEnough(sp, bom)
+
+	var file *Stats
+
+	switch {
+	case old:
+		file = fileStats(sp)
+		file.Cost = so.cost(sp)
+	case so.totals:
+		file = &Stats{}
+	default:
+		return
+	}
+
+	if so.totals {
+		file.TotalCount = 1
+		file.TotalSize = sp.Size
+	}
+
+	so.accumulate(sp.Path, file, bom, store)
+}
+
+// accumulateParsedStats scans through all of sp's entries, accumulating their
+// stats in to the given store under their BoM.
+func accumulateParsedStats(sp *StatsParser, gp *GIDToBoM, store dirStatsStore) error {
+	for sp.Scan() {
+		if err := accumulateParsedEntry(sp, gp, store); err != nil {
 			return err
 		}
 	}
 
+	return sp.Err()
+}
+
+// accumulateParsedEntry accumulates the stats of sp's current entry in to the
+// given store under its BoM.
+func accumulateParsedEntry(sp *StatsParser, gp *GIDToBoM, store dirStatsStore) error {
+	bom, err := gp.GetBom(int(sp.GID))
+	if err != nil {
+		return err
+	}
+
+	accumulateDirStats(sp.Path, fileStats(sp), bom, store)
+
 	return nil
 }
+
+// fileStats returns the Stats of sp's current entry, to be added to the Stats
+// of each directory it is nested within.
+func fileStats(sp *StatsParser) *Stats {
+	return newFileStats(sp.Size, sp.MTime, sp.Nlink)
+}
+
+// newFileStats returns the Stats of a single file with the given details.
+func newFileStats(size, mtime, nlink int64) *Stats {
+	file := &Stats{Count: 1, Size: size, OldestMTime: mtime, MinSize: size, MaxSize: size}
+
+	if nlink > 1 {
+		file.HardlinkedFiles = 1
+	}
+
+	if size == 0 {
+		file.EmptyFiles = 1
+	}
+
+	return file
+}
+
+// dirStatsStore is implemented by the maps that accumulateDirStats() stores
+// its Stats in.
+type dirStatsStore interface {
+	statsFor(bom []byte, dir string) *Stats
+}
+
+// bomDirKey returns a key that uniquely identifies the given BoM and directory.
+func bomDirKey(bom []byte, dir string) string {
+	return string(bom) + bomDirSeparator + dir
+}
+
+// statsFor returns the Stats for the given BoM and directory, creating it if
+// necessary.
+func (bds bomDirectoryStats) statsFor(bom []byte, dir string) *Stats {
+	key := bomDirKey(bom, dir)
+
+	stats, ok := bds[key]
+	if !ok {
+		stats = &Stats{
+			BoM:       bom,
+			Directory: dir,
+		}
+		bds[key] = stats
+	}
+
+	return stats
+}
+
+func accumulateDirStats(fullPath []byte, file *Stats, bom []byte, store dirStatsStore) {
+	accumulateDirStatsFrom(fullPath, 0, file, bom, store)
+}
+
+// accumulateDirStatsFrom is like accumulateDirStats(), but only adds to the
+// Stats of the directories whose path ends at or after the given index of the
+// given fullPath.
+func accumulateDirStatsFrom(fullPath []byte, start int, file *Stats, bom []byte, store dirStatsStore) {
+	var parent *Stats
+
+	for i := start; i < len(fullPath); i++ {
+		if fullPath[i] != '/' {
+			continue
+		}
+
+		end := i
+		if i == 0 {
+			end = i + 1
+		}
+
+		parent = store.statsFor(bom, string(fullPath[0:end]))
+
+		parent.add(file)
+	}
+
+	if parent != nil {
+		parent.OwnCount += file.Count
+		parent.OwnSize += file.Size
+	}
+}
+
+// add adds the counts and sizes of other to s, keeping the oldest OldestMTime,
+// the smallest non-zero MinSize and the largest MaxSize.
+func (s *Stats) add(other *Stats) {
+	if other.Count > 0 && (s.Count == 0 || other.OldestMTime < s.OldestMTime) {
+		s.OldestMTime = other.OldestMTime
+	}
+
+	if other.MinSize > 0 && (s.MinSize == 0 || other.MinSize < s.MinSize) {
+		s.MinSize = other.MinSize
+	}
+
+	s.MaxSize = max(s.MaxSize, other.MaxSize)
+	s.EmptyFiles += other.EmptyFiles
+	s.PathBytes += other.PathBytes
+	s.TotalCount += other.TotalCount
+	s.TotalSize += other.TotalSize
+	s.Cost += other.Cost
+
+	s.Count += other.Count
+	s.Size += other.Size
+	s.OwnCount += other.OwnCount
+	s.OwnSize += other.OwnSize
+	s.HardlinkedFiles += other.HardlinkedFiles
+}
+
+// MergeStats combines the given sets of Stats, eg. from BoMDirectoryStats() of
+// different stats files, or ParseStatsTSV() of different output files, summing
+// the counts and sizes of each BoM's directories. The results are sorted in the
+// same way as BoMDirectoryStats().
+func MergeStats(sets ...[]*Stats) []*Stats {
+	merged := make(bomDirectoryStats)
+
+	for _, stats := range sets {
+		for _, s := range stats {
+			merged.statsFor(s.BoM, s.Directory).add(s)
+		}
+	}
+
+	return sortBoMDirectoryStats(merged)
+}
+
+func sortBoMDirectoryStats(bdss ...bomDirectoryStats) []*Stats {
+	n := 0
+
+	for _, bds := range bdss {
+		n += len(bds)
+	}
+
+	results := make([]*Stats, 0, n)
+
+	for _, bds := range bdss {
+		for _, stats := range bds {
+			results = append(results, stats)
+		}
+	}
+
+	sortStats(results)
+
+	return results
+}
+
+// sortStats sorts the given stats in the default LargestFirst order.
+func sortStats(results []*Stats) {
+	SortStats(results, LargestFirst)
+}
+
+// WithExpectedDirectories makes BoMDirectoryStats() pre-allocate space for the
+// given number of BoM directories, avoiding the cost of growing its map as it
+// goes if you already know roughly how many there will be. It has no effect
+// when spilling.
+func WithExpectedDirectories(n int) StatsOption {
+	return func(so *statsOptions) {
+		so.capacity = max(n, 0)
+	}
+}
+
+// SortOrder determines the order of stats returned by BoMDirectoryStats().
+type SortOrder int
+
+const (
+	// LargestFirst sorts stats largest Size first. This is the default.
+	LargestFirst SortOrder = iota
+
+	// SmallestFirst sorts stats smallest Size first, useful for finding small
+	// directories that could be consolidated.
+	SmallestFirst
+
+	// OldestFirst sorts stats by OldestMTime, oldest first, then largest Size
+	// first, so that the most archivable directories come first.
+	OldestFirst
+
+	// MostFilesFirst sorts stats largest Count first, then largest Size first,
+	// for reporting on inode usage instead of disk usage.
+	MostFilesFirst
+
+	// ColdestFirst sorts stats largest ColdFraction() first, then largest Size
+	// first, so that the directories most safe to archive wholesale come
+	// first. Only useful WithTotals().
+	ColdestFirst
+)
+
+// WithSortOrder makes BoMDirectoryStats() return its results in the given
+// order, instead of the default LargestFirst.
+func WithSortOrder(order SortOrder) StatsOption {
+	return func(so *statsOptions) {
+		so.order = order
+	}
+}
+
+// SortStats sorts the given stats in the given order. Stats that are the same
+// according to the order (such as those with 0 Size) are then sorted shallowest
+// Directory first, then alphabetically by Directory, so the order is always
+// deterministic.
+func SortStats(stats []*Stats, order SortOrder) {
+	slices.SortFunc(stats, func(a, b *Stats) int {
+		if n := order.compare(a, b); n != 0 {
+			return n
+		}
+
+		if n := cmp.Compare(strings.Count(a.Directory, "/"), strings.Count(b.Directory, "/")); n != 0 {
+			return n
+		}
+
+		return cmp.Compare(a.Directory, b.Directory)
+	})
+}
+
+func (o SortOrder) compare(a, b *Stats) int {
+	switch o {
+	case SmallestFirst:
+		return cmp.Compare(a.Size, b.Size)
+	case OldestFirst:
+		if n := cmp.Compare(a.OldestMTime, b.OldestMTime); n != 0 {
+			return n
+		}
+	case MostFilesFirst:
+		if n := cmp.Compare(b.Count, a.Count); n != 0 {
+			return n
+		}
+	case ColdestFirst:
+		if n := cmp.Compare(b.ColdFraction(), a.ColdFraction()); n != 0 {
+			return n
+		}
+	case LargestFirst:
+	}
+
+	return cmp.Compare(b.Size, a.Size)
+}
+
+// PrintOption is an option that alters the output of PrintBoMDirectoryStats().
+type PrintOption func(*printOptions)
+
+// WriterFactory creates the named output file, returning a writer for it.
+type WriterFactory func(name string) (io.WriteCloser, error)
+
+type printOptions struct {
+	bomColumn     bool
+	noRoot        bool
+	unit          SizeUnit
+	rounding      RoundingMode
+	comment       string
+	tree          bool
+	own           bool
+	index         *GIDToBoM
+	create        WriterFactory
+	renameOutputs bool
+	rename        func(oldpath, newpath string) error
+	createRetries int
+	createBackoff time.Duration
+	splitTopDir   bool
+	splitCold     bool
+	coldThreshold float64
+	hardlinks     bool
+	coldFraction  bool
+	cost          bool
+	minBoMSize    int64
+	minBoMCount   uint64
+	removeStale   bool
+	ownerNames    bool
+	emptyBoMs     []string
+	bytesColumn   bool
+	maxRows       int
+	thousands     bool
+}
+
+func newPrintOptions(opts []PrintOption) *printOptions {
+	po := &printOptions{
+		create:        createFile,
+		renameOutputs: true,
+		rename:        os.Rename,
+	}
+
+	for _, opt := range opts {
+		opt(po)
+	}
+
+	return po
+}
+
+func createFile(name string) (io.WriteCloser, error) {
+	return os.Create(name)
+}
+
+// WithBoMColumn makes PrintBoMDirectoryStats() prepend the BoM name as the
+// first column of every row, so that the BoM of each row is still known if
+// the per-BoM files are concatenated.
+func WithBoMColumn() PrintOption {
+	return func(po *printOptions) {
+		po.bomColumn = true
+	}
+}
+
+// WithoutRoot makes PrintBoMDirectoryStats() skip the "/" row of each BoM,
+// which always holds the BoM's grand total.
+func WithoutRoot() PrintOption {
+	return func(po *printOptions) {
+		po.noRoot = true
+	}
+}
+
+// WithSizeUnit makes PrintBoMDirectoryStats() print sizes in the given unit,
+// instead of the default GiB.
+func WithSizeUnit(unit SizeUnit) PrintOption {
+	return func(po *printOptions) {
+		po.unit = unit
+	}
+}
+
+// WithMetadataComment makes PrintBoMDirectoryStats() start each file with a
+// comment line recording the given age threshold, generation time and our
+// Version, like:
+//
+//	# stats-parse age=7y generated=2024-05-09T13:34:25Z version=v1.0.0
+func WithMetadataComment(age string, generated time.Time) PrintOption {
+	return func(po *printOptions) {
+		po.comment = fmt.Sprintf("# stats-parse age=%s generated=%s version=%s\n",
+			age, generated.Format(time.RFC3339), Version)
+	}
+}
+
+// RoundingMode determines how sizes are rounded to 2 decimal places.
+type RoundingMode int
+
+const (
+	// RoundNearest rounds to the nearest value, per fmt's %.2f.
+	RoundNearest RoundingMode = iota
+
+	// RoundHalfUp rounds to the nearest value, with halves rounded up.
+	RoundHalfUp
+
+	// RoundUp rounds up, so that only a size of 0 is printed as 0.00.
+	RoundUp
+
+	// Truncate rounds down.
+	Truncate
+)
+
+const ErrBadRoundingMode = Error("invalid rounding mode")
+
+// ParseRoundingMode returns the RoundingMode named "nearest", "half-up", "up"
+// or "truncate".
+func ParseRoundingMode(name string) (RoundingMode, error) {
+	switch name {
+	case "nearest":
+		return RoundNearest, nil
+	case "half-up":
+		return RoundHalfUp, nil
+	case "up":
+		return RoundUp, nil
+	case "truncate":
+		return Truncate, nil
+	default:
+		return RoundNearest, ErrBadRoundingMode
+	}
+}
+
+// round divides the given size by the given divisor, rounding the result to 2
+// decimal places. Rounding is done in integer arithmetic on the size, so that
+// values that are exactly on a hundredth aren't pushed over or under it by
+// floating point error.
+func (r RoundingMode) round(size, divisor int64) float64 {
+	const hundredths = 100
+
+	if r == RoundNearest {
+		return float64(size) / float64(divisor)
+	}
+
+	whole, rem := floorDiv(size, divisor)
+	floor := whole*hundredths + rem*hundredths/divisor
+	fracRem := rem * hundredths % divisor
+
+	switch r {
+	case RoundHalfUp:
+		if 2*fracRem >= divisor { //nolint:mnd
+			floor++
+		}
+	case RoundUp:
+		if fracRem != 0 {
+			floor++
+		}
+	case Truncate, RoundNearest:
+	}
+
+	return float64(floor) / hundredths
+}
+
+// floorDiv returns a divided by b rounded down, and the non-negative
+// remainder, for a positive b.
+func floorDiv(a, b int64) (int64, int64) {
+	q, r := a/b, a%b
+	if r < 0 {
+		q--
+		r += b
+	}
+
+	return q, r
+}
+
+// WithRounding makes PrintBoMDirectoryStats() round sizes using the given
+// RoundingMode, instead of the default RoundNearest.
+func WithRounding(mode RoundingMode) PrintOption {
+	return func(po *printOptions) {
+		po.rounding = mode
+	}
+}
+
+// WithOwnColumns makes PrintBoMDirectoryStats() add 2 more columns to each
+// row: the number and size of the files directly in the directory (as opposed
+// to nested anywhere within it).
+func WithOwnColumns() PrintOption {
+	return func(po *printOptions) {
+		po.own = true
+	}
+}
+
+// WithBytesColumn makes PrintBoMDirectoryStats() start each file with a header
+// row naming the columns, and print each size in exact bytes as well as in the
+// size unit, so that rows look like:
+//
+//	directory	count	bytes	GiB
+//
+// This is the recommended format, since it can be read by both people and
+// programs without any ambiguity or loss of precision.
+func WithBytesColumn() PrintOption {
+	return func(po *printOptions) {
+		po.bytesColumn = true
+	}
+}
+
+// WithColdSplit makes PrintBoMDirectoryStats() further split each BoM's output
+// in to a [prefix].[bom].cold.tsv file of the directories with a ColdFraction()
+// of at least the given threshold, and a [prefix].[bom].recent.tsv file of the
+// rest, for a two-tier report. Only useful if the stats were made WithTotals().
+func WithColdSplit(threshold float64) PrintOption {
+	return func(po *printOptions) {
+		po.splitCold = true
+		po.coldThreshold = threshold
+	}
+}
+
+// WithTopDirSplit makes PrintBoMDirectoryStats() further split each BoM's
+// output in to a file per top level directory (the first path segment after
+// root), for BoMs that span multiple areas. The "/" row of each BoM is not
+// output, since it doesn't belong to any one top level directory; the row for
+// the top level directory itself gives the total for the file instead.
+func WithTopDirSplit() PrintOption {
+	return func(po *printOptions) {
+		po.splitTopDir = true
+	}
+}
+
+// WithMinBoMSize makes PrintBoMDirectoryStats() not write anything for BoMs
+// whose total Size (the sum of the OwnSizes of their Stats) is less than the
+// given number of bytes, to avoid lots of files for BoMs with trivial amounts
+// of data.
+func WithMinBoMSize(bytes int64) PrintOption {
+	return func(po *printOptions) {
+		po.minBoMSize = bytes
+	}
+}
+
+// WithMinBoMCount is like WithMinBoMSize(), but for BoMs whose total Count
+// (the number of files, and so inodes, they use) is less than the given count.
+func WithMinBoMCount(count uint64) PrintOption {
+	return func(po *printOptions) {
+		po.minBoMCount = count
+	}
+}
+
+// WithHardlinkColumn makes PrintBoMDirectoryStats() add a column to each row
+// (after any WithOwnColumns() columns) giving the number of files nested in the
+// directory that have more than 1 hardlink.
+func WithHardlinkColumn() PrintOption {
+	return func(po *printOptions) {
+		po.hardlinks = true
+	}
+}
+
+// WithColdFractionColumn makes PrintBoMDirectoryStats() add a column to each
+// row (after any WithHardlinkColumn() column) giving the ColdFraction() of the
+// directory. Only useful if the stats were made WithTotals().
+func WithColdFractionColumn() PrintOption {
+	return func(po *printOptions) {
+		po.coldFraction = true
+	}
+}
+
+// WithCostColumn makes PrintBoMDirectoryStats() add a column to each row
+// (after any WithColdFractionColumn() column) giving the Cost of the directory
+// to 2 decimal places. Only useful if the stats were made WithGIDCosts().
+func WithCostColumn() PrintOption {
+	return func(po *printOptions) {
+		po.cost = true
+	}
+}
+
+// WithIndex makes PrintBoMDirectoryStats() also write an "index.tsv" file, in
+// the same directory as the output files, listing the original BoM name (per
+// the given GIDToBoM) and path of every output file created:
+//
+//	BoM name	Output path
+func WithIndex(gtb *GIDToBoM) PrintOption {
+	return func(po *printOptions) {
+		po.index = gtb
+	}
+}
+
+// WithWriterFactory makes PrintBoMDirectoryStats() create its output files
+// using the given WriterFactory, instead of os.Create(). The files are created
+// with their final names, since the WriterFactory's destination may not
+// support renaming.
+func WithWriterFactory(create WriterFactory) PrintOption {
+	return func(po *printOptions) {
+		po.create = create
+		po.renameOutputs = false
+	}
+}
+
+// WithCreateRetries makes PrintBoMDirectoryStats() retry failed output file
+// creation, and failed renames of output files to their final names, up to the
+// given number of times, waiting the given backoff before the first retry and
+// doubling it before each subsequent one.
+func WithCreateRetries(retries int, backoff time.Duration) PrintOption {
+	return func(po *printOptions) {
+		po.createRetries = retries
+		po.createBackoff = backoff
+	}
+}
+
+// PrintBoMDirectoryStats takes BoMDirectoryStats() stats and writes them as
+// a TSV:
+//
+//	Directory	Count	Size
+//
+// With one line per Stats and one file per BoM area, with files named after
+// the given path suffixed with ".[bom name].tsv" (or ".[bom name].[top
+// directory].tsv" if using WithTopDirSplit(), or ".[bom name].part0001.tsv"
+// etc. if using WithMaxRowsPerFile()).
+//
+// Unless using WithWriterFactory(), each file is written under a temporary
+// name with a ".tmp" suffix, and only renamed to its final name once every
+// file has been written and closed successfully, so each file is replaced
+// atomically, and a failure while writing leaves all the previous files in
+// place. The renames themselves are not atomic as a group though: if one fails,
+// the files renamed before it will already have been replaced. Any index is
+// written and stale files removed only after every rename succeeded.
+func PrintBoMDirectoryStats(path string, stats []*Stats, opts ...PrintOption) error {
+	po := newPrintOptions(opts)
+	writers := make(map[string]*outputFile)
+	index := newOutputIndex()
+	files := &outputFiles{}
+
+	defer files.discard()
+
+	stats = po.arrange(stats)
+
+	for _, s := range stats {
+		if po.skip(s) {
+			continue
+		}
+
+		key := po.fileKey(s)
+
+		file, ok := writers[key]
+		if !ok || po.full(file) {
+			var err error
+
+			file, err = po.openOutputFile(path, key, s.BoM, file, index)
+			if err != nil {
+				return err
+			}
+
+			writers[key] = file
+			files.add(file)
+		}
+
+		file.rows++
+
+		if err := po.printRow(file, s); err != nil {
+			return err
+		}
+	}
+
+	if err := po.writeEmptyBoMFiles(path, index, files); err != nil {
+		return err
+	}
+
+	if err := files.commit(); err != nil {
+		return err
+	}
+
+	indexPath := filepath.Join(filepath.Dir(path), "index.tsv")
+
+	if err := po.writeIndex(indexPath, index); err != nil {
+		return err
+	}
+
+	return po.removeStaleFiles(path, index.paths, indexPath)
+}
+
+// createWithRetries creates the named file using our WriterFactory, retrying
+// with backoff on transient failures as configured.
+func (po *printOptions) createWithRetries(name string) (io.WriteCloser, error) {
+	var w io.WriteCloser
+
+	err := po.withRetries(func() error {
+		var err error
+
+		w, err = po.create(name)
+
+		return err
+	})
+
+	return w, err
+}
+
+// renameWithRetries renames oldpath to newpath, retrying with backoff on
+// transient failures as configured.
+func (po *printOptions) renameWithRetries(oldpath, newpath string) error {
+	return po.withRetries(func() error {
+		return po.rename(oldpath, newpath)
+	})
+}
+
+// withRetries calls op until it succeeds, it fails with an error that isn't
+// transient, or we have run out of retries, returning its last error.
+func (po *printOptions) withRetries(op func() error) error {
+	backoff := po.createBackoff
+
+	for retry := 0; ; retry++ {
+		err := op()
+		if err == nil || retry >= po.createRetries || !isTransient(err) {
+			return err
+		}
+
+		time.Sleep(backoff)
+
+		backoff *= 2
+	}
+}
+
+// isTransient returns true if the given error is one that might not happen
+// again if we retry, such as a timeout, or a stale handle on a network
+// filesystem. Errors like a missing directory or lack of permission are not
+// transient.
+func isTransient(err error) bool {
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return true
+	}
+
+	for _, errno := range []syscall.Errno{syscall.EAGAIN, syscall.ESTALE, syscall.EINTR, syscall.EBUSY} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithEmptyBoMFiles makes PrintBoMDirectoryStats() also create a file for each
+// of the given BoMs (eg. from GIDToBoM.BoMs()) that had no directories to
+// output. These files are empty apart from any metadata comment, so that every
+// expected output file always exists, and a missing file means a failure.
+func WithEmptyBoMFiles(boms []string) PrintOption {
+	return func(po *printOptions) {
+		po.emptyBoMs = boms
+	}
+}
+
+// writeEmptyBoMFiles creates an output file containing just our header for
+// each of our emptyBoMs that isn't already in the given index, adding them to
+// the given outputFiles.
+func (po *printOptions) writeEmptyBoMFiles(path string, index *outputIndex, files *outputFiles) error {
+	written := make(map[string]bool, len(index.boms))
+
+	for _, bom := range index.boms {
+		written[string(bom)] = true
+	}
+
+	for _, bom := range po.emptyBoMs {
+		if written[bom] {
+			continue
+		}
+
+		name := fmt.Sprintf("%s.%s.tsv", path, bom)
+
+		file, err := po.createOutputFile(name)
+		if err != nil {
+			return err
+		}
+
+		files.add(file)
+
+		if err = po.printHeader(file); err != nil {
+			return err
+		}
+
+		index.add([]byte(bom), name)
+	}
+
+	return nil
+}
+
+// printHeader prints the lines that should appear at the start of each file.
+func (po *printOptions) printHeader(w io.Writer) error {
+	if _, err := io.WriteString(w, po.comment); err != nil {
+		return err
+	}
+
+	if !po.bytesColumn {
+		return nil
+	}
+
+	_, err := io.WriteString(w, po.headerRow())
+
+	return err
+}
+
+// headerRow returns the tab separated names of the columns printRow() prints,
+// ending in a newline.
+func (po *printOptions) headerRow() string {
+	var cols []string
+
+	if po.bomColumn {
+		cols = append(cols, "bom")
+	}
+
+	cols = append(cols, "directory", "count", "bytes", po.unit.String())
+
+	if po.own {
+		cols = append(cols, "own_count", "own_bytes", "own_"+po.unit.String())
+	}
+
+	if po.hardlinks {
+		cols = append(cols, "hardlinked")
+	}
+
+	if po.coldFraction {
+		cols = append(cols, "cold_fraction")
+	}
+
+	if po.cost {
+		cols = append(cols, "cost")
+	}
+
+	return strings.Join(cols, "\t") + "\n"
+}
+
+// arrange returns the given stats in the order they should be printed, minus
+// those of BoMs that are too small to print at all.
+func (po *printOptions) arrange(stats []*Stats) []*Stats {
+	stats = po.withoutSmallBoMs(stats)
+
+	if po.tree {
+		return treeOrder(stats)
+	}
+
+	return stats
+}
+
+// withoutSmallBoMs returns the given stats minus those of any BoM whose total
+// Size is less than our minBoMSize, or whose total Count is less than our
+// minBoMCount. Like groupBoMsLargestFirst(), a BoM's totals are the sums of the
+// OwnCounts and OwnSizes of its Stats, so that they are correct even if there
+// is no "/" directory, eg. due to WithRoot() or WithPathKey().
+func (po *printOptions) withoutSmallBoMs(stats []*Stats) []*Stats {
+	if po.minBoMSize <= 0 && po.minBoMCount == 0 {
+		return stats
+	}
+
+	sizes := make(map[string]int64)
+	counts := make(map[string]uint64)
+
+	for _, s := range stats {
+		sizes[string(s.BoM)] += s.OwnSize
+		counts[string(s.BoM)] += s.OwnCount
+	}
+
+	kept := make([]*Stats, 0, len(stats))
+
+	for _, s := range stats {
+		bom := string(s.BoM)
+
+		if sizes[bom] >= po.minBoMSize && counts[bom] >= po.minBoMCount {
+			kept = append(kept, s)
+		}
+	}
+
+	return kept
+}
+
+// skip returns true if the given Stats should not be printed.
+func (po *printOptions) skip(s *Stats) bool {
+	return (po.noRoot || po.splitTopDir) && s.Directory == "/"
+}
+
+// fileKey returns the part of the output file name that identifies which file
+// the given Stats should be printed to.
+func (po *printOptions) fileKey(s *Stats) string {
+	key := string(s.BoM)
+
+	if po.splitTopDir {
+		key += "." + topDir(s.Directory)
+	}
+
+	if po.splitCold {
+		key += "." + po.coldOrRecent(s)
+	}
+
+	return key
+}
+
+// coldOrRecent returns "cold" if the given Stats has a ColdFraction() of at
+// least our coldThreshold, otherwise "recent".
+func (po *printOptions) coldOrRecent(s *Stats) string {
+	if s.ColdFraction() >= po.coldThreshold {
+		return "cold"
+	}
+
+	return "recent"
+}
+
+// topDir returns the first path segment after root of the given directory.
+func topDir(dir string) string {
+	top, _, _ := strings.Cut(strings.TrimPrefix(dir, "/"), "/")
+
+	return top
+}
+
+func (po *printOptions) printRow(w io.Writer, s *Stats) error {
+	if po.bomColumn {
+		if _, err := fmt.Fprintf(w, "%s\t", s.BoM); err != nil {
+			return err
+		}
+	}
+
+	dir := s.Directory
+	if po.tree {
+		dir = treeName(dir)
+	}
+
+	if _, err := fmt.Fprintf(w, "%s\t%d\t%s", dir, s.Count, po.formatSize(s.Size)); err != nil {
+		return err
+	}
+
+	if po.own {
+		if _, err := fmt.Fprintf(w, "\t%d\t%s", s.OwnCount, po.formatSize(s.OwnSize)); err != nil {
+			return err
+		}
+	}
+
+	if po.hardlinks {
+		if _, err := fmt.Fprintf(w, "\t%d", s.HardlinkedFiles); err != nil {
+			return err
+		}
+	}
+
+	if po.coldFraction {
+		if _, err := fmt.Fprintf(w, "\t%.4f", s.ColdFraction()); err != nil {
+			return err
+		}
+	}
+
+	if po.cost {
+		if _, err := fmt.Fprintf(w, "\t%.2f", s.Cost); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
+
+// WithMaxRowsPerFile makes PrintBoMDirectoryStats() split each BoM's output in
+// to part files of at most the given number of rows (plus any header), named
+// like [prefix].[bom].part0001.tsv, [prefix].[bom].part0002.tsv etc.
+func WithMaxRowsPerFile(rows int) PrintOption {
+	return func(po *printOptions) {
+		po.maxRows = rows
+	}
+}
+
+// outputFile is an output file being written by PrintBoMDirectoryStats(),
+// possibly under a temporary name.
+type outputFile struct {
+	io.WriteCloser
+	name   string
+	tmp    string
+	rows   int
+	part   int
+	closed bool
+	rename func(oldpath, newpath string) error
+}
+
+// createOutputFile creates an outputFile that will end up with the given name.
+// It is written under a temporary name if we rename outputs.
+func (po *printOptions) createOutputFile(name string) (*outputFile, error) {
+	tmp := name
+	if po.renameOutputs {
+		tmp += tmpSuffix
+	}
+
+	w, err := po.createWithRetries(tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &outputFile{WriteCloser: w, name: name, tmp: tmp, rename: po.renameWithRetries}, nil
+}
+
+// close closes the file if it isn't already closed.
+func (f *outputFile) close() error {
+	if f.closed {
+		return nil
+	}
+
+	f.closed = true
+
+	return f.Close()
+}
+
+// finalise renames the file from its temporary name to its final name, if they
+// differ.
+func (f *outputFile) finalise() error {
+	if f.tmp == f.name {
+		return nil
+	}
+
+	return f.rename(f.tmp, f.name)
+}
+
+// outputFiles are the outputFiles being written by PrintBoMDirectoryStats().
+type outputFiles struct {
+	files     []*outputFile
+	committed bool
+}
+
+func (o *outputFiles) add(file *outputFile) {
+	o.files = append(o.files, file)
+}
+
+// commit closes all the files, and only if they all closed without error,
+// renames them to their final names. If a rename fails, the files already
+// renamed are not rolled back.
+func (o *outputFiles) commit() error {
+	var errs []error
+
+	for _, file := range o.files {
+		errs = append(errs, file.close())
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	for _, file := range o.files {
+		if err := file.finalise(); err != nil {
+			return err
+		}
+	}
+
+	o.committed = true
+
+	return nil
+}
+
+// discard closes all the files and removes any temporary ones, unless commit()
+// succeeded.
+func (o *outputFiles) discard() {
+	if o.committed {
+		return
+	}
+
+	for _, file := range o.files {
+		file.close() //nolint:errcheck
+
+		if file.tmp != file.name {
+			os.Remove(file.tmp)
+		}
+	}
+}
+
+// full returns true if the given outputFile has the most rows we allow.
+func (po *printOptions) full(file *outputFile) bool {
+	return po.maxRows > 0 && file.rows >= po.maxRows
+}
+
+// openOutputFile creates the output file for the given key and BoM, starting it
+// with our header. If previous is not nil, it is closed, and the new file is
+// the next part after it.
+func (po *printOptions) openOutputFile(path, key string, bom []byte, previous *outputFile,
+	index *outputIndex) (*outputFile, error) {
+	part := 1
+
+	if previous != nil {
+		if err := previous.close(); err != nil {
+			return nil, err
+		}
+
+		part = previous.part + 1
+	}
+
+	name := fmt.Sprintf("%s.%s.tsv", path, key)
+	if po.maxRows > 0 {
+		name = fmt.Sprintf("%s.%s.part%04d.tsv", path, key, part)
+	}
+
+	file, err := po.createOutputFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file.part = part
+
+	index.add(bom, name)
+
+	return file, po.printHeader(file)
+}
+
+// formatSize returns the given size in our size unit, preceded by the exact
+// size in bytes and a tab if WithBytesColumn() was used.
+func (po *printOptions) formatSize(size int64) string {
+	if po.bytesColumn {
+		return fmt.Sprintf("%d\t%.2f", size, po.convertSize(size))
+	}
+
+	return fmt.Sprintf("%.2f", po.convertSize(size))
+}
+
+// convertSize converts the given size in bytes to our unit, rounded per our
+// rounding mode.
+func (po *printOptions) convertSize(size int64) float64 {
+	return po.rounding.round(size, po.unit.divisor())
+}
@@ -26,12 +26,21 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"cmp"
+	"fmt"
 	"io"
+	"slices"
 	"strconv"
+	"unicode"
 )
 
 const (
 	ErrInvalidGID     = Error("invalid GID: GID does not belong to any BoMs")
+	ErrEmptyBoM       = Error("invalid bom.gids line: empty BoM name")
+	ErrNoBoMs         = Error("invalid bom.gids data: no BoMs defined")
+	ErrInvertedRange  = Error("invalid GID range: start is greater than end")
+	ErrUnknownBoM     = Error("BoM does not appear in the bom.gids data")
+	defaultGIDLabel   = "*"
 	numBomGIDsColumns = 2
 )
 
@@ -39,50 +48,160 @@ const (
 //
 //	bom1\tgid1,gid2
 //	bom2\tgid3,gid4,gid5
+//	bom3\tgid6-gid10,gid11
+//
+// Where gid6-gid10 is an inclusive range of GIDs.
 //
 // and can tell you which BoM any particular GID belongs to.
 type GIDToBoM struct {
-	gidToBom map[int][]byte
+	gidToBom   map[int][]byte
+	ranges     []bomGIDRange
+	names      map[string]string
+	defaultBoM []byte
+}
+
+// GIDRange is an inclusive range of GIDs. A single GID is a range where Start
+// and End are the same.
+type GIDRange struct {
+	Start int
+	End   int
+}
+
+// Contains returns true if the given GID is within the range.
+func (r GIDRange) Contains(gid int) bool {
+	return gid >= r.Start && gid <= r.End
+}
+
+// String returns the range as it would appear in bom.gids data.
+func (r GIDRange) String() string {
+	if r.Start == r.End {
+		return strconv.Itoa(r.Start)
+	}
+
+	return strconv.Itoa(r.Start) + "-" + strconv.Itoa(r.End)
+}
+
+// bomGIDRange is a GIDRange that belongs to a BoM. Ranges are kept as ranges,
+// rather than expanded in to each of their GIDs, so that a huge range doesn't
+// use a huge amount of memory.
+type bomGIDRange struct {
+	GIDRange
+	bom []byte
+}
+
+// GIDToBoMOption is an option that alters how NewGIDToBoM() parses bom.gids
+// data.
+type GIDToBoMOption func(*bomGIDsParser)
+
+// WithCaseFolding makes NewGIDToBoM() treat BoM names that only differ by case
+// as the same BoM, using the casing of the first variant seen. A warning is
+// logged for each variant that gets merged.
+func WithCaseFolding() GIDToBoMOption {
+	return func(bgp *bomGIDsParser) {
+		bgp.canonicalBoMs = make(map[string][]byte)
+	}
+}
+
+// RequireBoMs makes NewGIDToBoM() return ErrNoBoMs if the bom.gids data
+// doesn't define any BoMs, since otherwise every GID would later be found to
+// be invalid.
+func RequireBoMs() GIDToBoMOption {
+	return func(bgp *bomGIDsParser) {
+		bgp.requireBoMs = true
+	}
+}
+
+// bomGIDsParser holds the state needed while parsing bom.gids data.
+type bomGIDsParser struct {
+	canonicalBoMs map[string][]byte
+	names         map[string]string
+	requireBoMs   bool
 }
 
 // NewGIDToBoM parses the given bom.gids data and returns a GIDTOBoM that can
 // tell you the BoM area a GID belongs to.
-func NewGIDToBoM(r io.Reader) (*GIDToBoM, error) {
-	gidToBom, err := parseBomGIDsData(r)
-	if err != nil {
+func NewGIDToBoM(r io.Reader, opts ...GIDToBoMOption) (*GIDToBoM, error) {
+	bgp := &bomGIDsParser{names: make(map[string]string)}
+
+	for _, opt := range opts {
+		opt(bgp)
+	}
+
+	p := &GIDToBoM{
+		gidToBom: make(map[int][]byte),
+		names:    bgp.names,
+	}
+
+	if err := bgp.parseBomGIDsData(r, p); err != nil {
 		return nil, err
 	}
 
-	return &GIDToBoM{
-		gidToBom: gidToBom,
-	}, nil
-}
+	if bgp.requireBoMs && len(p.gidToBom) == 0 && len(p.ranges) == 0 {
+		return nil, ErrNoBoMs
+	}
 
-func parseBomGIDsData(r io.Reader) (map[int][]byte, error) {
-	gidToBom := make(map[int][]byte)
+	return p, nil
+}
 
+func (bgp *bomGIDsParser) parseBomGIDsData(r io.Reader, p *GIDToBoM) error {
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
-		line := bytes.TrimSpace(scanner.Bytes())
+		line := trimBomGIDsLine(scanner.Bytes())
 
 		bom, gids, err := parseBomGIDsLine(line)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		for _, gid := range gids {
-			gidToBom[gid] = bom
+		bom = bgp.canonicalBoM(bom)
+		bgp.recordName(bom, line)
+
+		for _, gr := range gids {
+			p.add(gr, bom)
 		}
 	}
 
-	if scanner.Err() != nil {
-		return nil, scanner.Err()
+	return scanner.Err()
+}
+
+// add makes the GIDs in the given range belong to the given BoM. Single GIDs
+// go in our map, while wider ranges are stored as ranges. Like a single GID
+// seen again, a later range takes precedence over earlier GIDs and ranges it
+// overlaps.
+func (p *GIDToBoM) add(gr GIDRange, bom []byte) {
+	if gr.Start == gr.End {
+		p.gidToBom[gr.Start] = bom
+
+		return
+	}
+
+	for gid := range p.gidToBom {
+		if gr.Contains(gid) {
+			delete(p.gidToBom, gid)
+		}
 	}
 
-	return gidToBom, nil
+	p.ranges = append(p.ranges, bomGIDRange{GIDRange: gr, bom: bom})
 }
 
-func parseBomGIDsLine(line []byte) ([]byte, []int, error) {
+// recordName remembers the original name of the given BoM from the given
+// bom.gids line, if we didn't already know it.
+func (bgp *bomGIDsParser) recordName(bom, line []byte) {
+	if _, ok := bgp.names[string(bom)]; ok {
+		return
+	}
+
+	rawBoM, _, _ := bytes.Cut(line, []byte{'\t'})
+	bgp.names[string(bom)] = string(rawBoM)
+}
+
+// trimBomGIDsLine removes trailing whitespace from the given line. Leading
+// whitespace is left alone, since a leading tab indicates an empty BoM name.
+func trimBomGIDsLine(line []byte) []byte {
+	return bytes.TrimRightFunc(line, unicode.IsSpace)
+}
+
+func parseBomGIDsLine(line []byte) ([]byte, []GIDRange, error) {
 	cols := bytes.Split(line, []byte{'\t'})
 	if len(cols) != numBomGIDsColumns {
 		return nil, nil, Error("invalid bom.gids line: " + string(line))
@@ -91,7 +210,11 @@ func parseBomGIDsLine(line []byte) ([]byte, []int, error) {
 	rawBoM, gidsCSV := cols[0], cols[1]
 
 	bom := refomatBoM(rawBoM)
-	gids, err := gidsCSVtoGIDs(gidsCSV)
+	if len(bom) == 0 {
+		return nil, nil, ErrEmptyBoM
+	}
+
+	gids, err := gidsCSVtoRanges(gidsCSV)
 
 	return bom, gids, err
 }
@@ -100,30 +223,203 @@ func refomatBoM(rawBoM []byte) []byte {
 	return bytes.ReplaceAll(rawBoM, []byte{' '}, []byte{})
 }
 
-func gidsCSVtoGIDs(gidsCSV []byte) ([]int, error) {
+// ValidateBomGIDs checks every line of the given bom.gids data, returning an
+// error for each malformed line (with its line number), rather than stopping
+// at the first one like NewGIDToBoM() does. Returns nil if the data is valid.
+func ValidateBomGIDs(r io.Reader) []error {
+	var errs []error
+
+	scanner := bufio.NewScanner(r)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		if _, _, err := parseBomGIDsLine(trimBomGIDsLine(scanner.Bytes())); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", lineNum, err))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// canonicalBoM returns the first seen case variant of the given BoM if we are
+// case folding, otherwise returns the given BoM.
+func (bgp *bomGIDsParser) canonicalBoM(bom []byte) []byte {
+	if bgp.canonicalBoMs == nil {
+		return bom
+	}
+
+	folded := string(bytes.ToLower(bom))
+
+	canonical, ok := bgp.canonicalBoMs[folded]
+	if !ok {
+		bgp.canonicalBoMs[folded] = bom
+
+		return bom
+	}
+
+	if !bytes.Equal(canonical, bom) {
+		l.Warnf("merging BoM %s in to %s", bom, canonical)
+	}
+
+	return canonical
+}
+
+// gidsCSVtoRanges parses a comma separated list of GIDs, where each item can
+// also be an inclusive range like 1000-1010. Ranges are not expanded.
+func gidsCSVtoRanges(gidsCSV []byte) ([]GIDRange, error) {
 	gidStrs := bytes.Split(gidsCSV, []byte{','})
-	gids := make([]int, len(gidStrs))
+	ranges := make([]GIDRange, 0, len(gidStrs))
 
-	for i, gidStr := range gidStrs {
-		gid, err := strconv.Atoi(string(gidStr))
+	for _, gidStr := range gidStrs {
+		start, end, err := parseGIDRange(gidStr)
 		if err != nil {
 			return nil, err
 		}
 
-		gids[i] = gid
+		ranges = append(ranges, GIDRange{Start: start, End: end})
+	}
+
+	return ranges, nil
+}
+
+// parseGIDRange parses a GID range like 1000-1010 in to its start and end, or
+// a single GID in to a range of just that GID.
+func parseGIDRange(gidStr []byte) (int, int, error) {
+	startStr, endStr, isRange := bytes.Cut(gidStr, []byte{'-'})
+
+	start, err := strconv.Atoi(string(startStr))
+	if err != nil || !isRange {
+		return start, start, err
+	}
+
+	end, err := strconv.Atoi(string(endStr))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if start > end {
+		return 0, 0, fmt.Errorf("%w: %s", ErrInvertedRange, gidStr)
 	}
 
-	return gids, nil
+	return start, end, nil
 }
 
 // GetBom returns the BoM that the given group belongs to. Returns an error
-// if the given GID did not appear in the bom.gids data parsed.
+// if the given GID did not appear in the bom.gids data parsed, unless
+// SetDefaultBoM() was used.
 func (p *GIDToBoM) GetBom(gid int) ([]byte, error) {
-	bom, ok := p.gidToBom[gid]
+	if bom, ok := p.gidToBom[gid]; ok {
+		return bom, nil
+	}
 
-	if !ok {
-		return nil, ErrInvalidGID
+	for i := len(p.ranges) - 1; i >= 0; i-- {
+		if p.ranges[i].Contains(gid) {
+			return p.ranges[i].bom, nil
+		}
+	}
+
+	if p.defaultBoM != nil {
+		return p.defaultBoM, nil
+	}
+
+	return nil, ErrInvalidGID
+}
+
+// Alias merges the given alias BoM in to the given canonical BoM, so that the
+// GIDs of the alias now belong to the canonical BoM, and the alias no longer
+// exists. Both are the normalised BoM names (without spaces). Returns
+// ErrUnknownBoM if either BoM is not in the bom.gids data.
+func (p *GIDToBoM) Alias(alias, canonical string) error {
+	_, aliasKnown := p.names[alias]
+	_, canonicalKnown := p.names[canonical]
+
+	if !aliasKnown || !canonicalKnown {
+		return ErrUnknownBoM
+	}
+
+	canonicalBoM := []byte(canonical)
+
+	for gid, bom := range p.gidToBom {
+		if string(bom) == alias {
+			p.gidToBom[gid] = canonicalBoM
+		}
+	}
+
+	for i := range p.ranges {
+		if string(p.ranges[i].bom) == alias {
+			p.ranges[i].bom = canonicalBoM
+		}
+	}
+
+	delete(p.names, alias)
+
+	return nil
+}
+
+// SetDefaultBoM makes GetBom() return the given BoM for GIDs that aren't in the
+// bom.gids data, instead of an error.
+func (p *GIDToBoM) SetDefaultBoM(bom string) {
+	p.defaultBoM = []byte(bom)
+
+	if _, ok := p.names[bom]; !ok {
+		p.names[bom] = bom
+	}
+}
+
+// WriteMapping writes the GID to BoM mapping that GetBom() uses to the given
+// writer as TSV rows of GID and BoM, sorted by GID. GID ranges are written as
+// a single row like "1000-1010", sorted by their start. If SetDefaultBoM() was
+// used, there is a final row of "*" and the default BoM.
+func (p *GIDToBoM) WriteMapping(w io.Writer) error {
+	rows := make([]bomGIDRange, 0, len(p.gidToBom)+len(p.ranges))
+
+	for gid, bom := range p.gidToBom {
+		rows = append(rows, bomGIDRange{GIDRange: GIDRange{Start: gid, End: gid}, bom: bom})
+	}
+
+	rows = append(rows, p.ranges...)
+
+	slices.SortStableFunc(rows, func(a, b bomGIDRange) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+
+	bw := bufio.NewWriter(w)
+
+	for _, row := range rows {
+		fmt.Fprintf(bw, "%s\t%s\n", row.GIDRange, row.bom)
+	}
+
+	if p.defaultBoM != nil {
+		fmt.Fprintf(bw, "%s\t%s\n", defaultGIDLabel, p.defaultBoM)
+	}
+
+	return bw.Flush()
+}
+
+// BoMs returns the (normalised) names of all the BoMs in the bom.gids data,
+// sorted by name.
+func (p *GIDToBoM) BoMs() []string {
+	boms := make([]string, 0, len(p.names))
+
+	for bom := range p.names {
+		boms = append(boms, bom)
+	}
+
+	slices.Sort(boms)
+
+	return boms
+}
+
+// BoMName returns the original name of the given BoM, as it appeared in the
+// bom.gids data before normalisation (such as the removal of spaces). Returns
+// the given BoM itself if it did not appear in the bom.gids data.
+func (p *GIDToBoM) BoMName(bom []byte) string {
+	if name, ok := p.names[string(bom)]; ok {
+		return name
 	}
 
-	return bom, nil
+	return string(bom)
 }
@@ -0,0 +1,169 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// maxDeepestPaths is the most paths per BoM that DeepestPaths() will retain.
+const maxDeepestPaths = 1000
+
+// DeepPath is a file path and the number of directories it is nested within.
+type DeepPath struct {
+	BoM   []byte
+	Path  string
+	Depth int
+}
+
+// deepestTracker retains the n deepest paths it is given.
+type deepestTracker struct {
+	n          int
+	paths      []*DeepPath
+	shallowest int
+}
+
+// add considers the given path for retention, only converting it to a string
+// if it is deep enough to keep.
+func (dt *deepestTracker) add(bom, path []byte, depth int) {
+	if len(dt.paths) < dt.n {
+		dt.paths = append(dt.paths, &DeepPath{BoM: bom, Path: string(path), Depth: depth})
+
+		if depth < dt.paths[dt.shallowest].Depth {
+			dt.shallowest = len(dt.paths) - 1
+		}
+
+		return
+	}
+
+	if depth <= dt.paths[dt.shallowest].Depth {
+		return
+	}
+
+	dt.paths[dt.shallowest] = &DeepPath{BoM: bom, Path: string(path), Depth: depth}
+
+	for i, dp := range dt.paths {
+		if dp.Depth < dt.paths[dt.shallowest].Depth {
+			dt.shallowest = i
+		}
+	}
+}
+
+// DeepestPaths returns the n deepest paths of the files older than the given
+// duration in each BoM, to help diagnose runaway directory nesting. The paths
+// themselves must be retained, so n is capped at 1000, using memory for at most
+// that many paths per BoM.
+//
+// The results are sorted by BoM, then deepest first, then path.
+func DeepestPaths(sp *StatsParser, gp *GIDToBoM, d time.Duration, n int) ([]*DeepPath, error) {
+	n = min(n, maxDeepestPaths)
+	if n <= 0 {
+		return nil, nil
+	}
+
+	sp.FilterForFilesOlderThan(d)
+
+	trackers := make(map[string]*deepestTracker)
+
+	for sp.Scan() {
+		bom, err := gp.GetBom(int(sp.GID))
+		if err != nil {
+			return nil, err
+		}
+
+		dt, ok := trackers[string(bom)]
+		if !ok {
+			dt = &deepestTracker{n: n}
+			trackers[string(bom)] = dt
+		}
+
+		dt.add(bom, sp.Path, bytes.Count(sp.Path, []byte{'/'}))
+	}
+
+	if err := sp.Err(); err != nil {
+		return nil, err
+	}
+
+	return sortDeepPaths(trackers), nil
+}
+
+func sortDeepPaths(trackers map[string]*deepestTracker) []*DeepPath {
+	var results []*DeepPath
+
+	for _, dt := range trackers {
+		results = append(results, dt.paths...)
+	}
+
+	slices.SortFunc(results, func(a, b *DeepPath) int {
+		if n := cmp.Compare(string(a.BoM), string(b.BoM)); n != 0 {
+			return n
+		}
+
+		if n := cmp.Compare(b.Depth, a.Depth); n != 0 {
+			return n
+		}
+
+		return cmp.Compare(a.Path, b.Path)
+	})
+
+	return results
+}
+
+// PrintDeepestPaths takes DeepestPaths() results and writes them as a TSV:
+//
+//	Depth	Path
+//
+// With one file per BoM area, named after the given path suffixed with
+// ".[bom name].deepest.tsv".
+func PrintDeepestPaths(path string, paths []*DeepPath, opts ...PrintOption) error {
+	po := newPrintOptions(opts)
+	writers := make(map[string]io.WriteCloser)
+
+	for _, dp := range paths {
+		file, ok := writers[string(dp.BoM)]
+		if !ok {
+			var err error
+
+			file, err = po.createWithRetries(fmt.Sprintf("%s.%s.deepest.tsv", path, dp.BoM))
+			if err != nil {
+				return err
+			}
+
+			defer file.Close()
+
+			writers[string(dp.BoM)] = file
+		}
+
+		if _, err := fmt.Fprintf(file, "%d\t%s\n", dp.Depth, dp.Path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
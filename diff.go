@@ -0,0 +1,144 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// StatsDelta holds the change in the number and size of files nested within a
+// directory between 2 sets of Stats.
+type StatsDelta struct {
+	BoM       []byte
+	Directory string
+	Count     int64
+	Size      int64 // in bytes
+}
+
+// DiffStats compares the given before and after Stats (eg. from last month's
+// and this month's runs), returning a StatsDelta for every BoM directory whose
+// count or size changed. Directories only in one of the sets are treated as
+// having nothing in the other.
+//
+// The results are sorted by largest Size increase first.
+func DiffStats(before, after []*Stats) []*StatsDelta {
+	deltas := make(map[string]*StatsDelta)
+
+	for _, s := range before {
+		d := deltaFor(deltas, s)
+		d.Count -= int64(s.Count)
+		d.Size -= s.Size
+	}
+
+	for _, s := range after {
+		d := deltaFor(deltas, s)
+		d.Count += int64(s.Count)
+		d.Size += s.Size
+	}
+
+	return sortStatsDeltas(deltas)
+}
+
+func deltaFor(deltas map[string]*StatsDelta, s *Stats) *StatsDelta {
+	key := bomDirKey(s.BoM, s.Directory)
+
+	d, ok := deltas[key]
+	if !ok {
+		d = &StatsDelta{BoM: s.BoM, Directory: s.Directory}
+		deltas[key] = d
+	}
+
+	return d
+}
+
+func sortStatsDeltas(deltas map[string]*StatsDelta) []*StatsDelta {
+	results := make([]*StatsDelta, 0, len(deltas))
+
+	for _, d := range deltas {
+		if d.Count != 0 || d.Size != 0 {
+			results = append(results, d)
+		}
+	}
+
+	slices.SortFunc(results, func(a, b *StatsDelta) int {
+		if n := cmp.Compare(b.Size, a.Size); n != 0 {
+			return n
+		}
+
+		if n := cmp.Compare(string(a.BoM), string(b.BoM)); n != 0 {
+			return n
+		}
+
+		return cmp.Compare(a.Directory, b.Directory)
+	})
+
+	return results
+}
+
+// PrintStatsDeltas takes DiffStats() deltas and writes them as a TSV:
+//
+//	Directory	Count change	Size change
+//
+// With one line per StatsDelta and one file per BoM area, with files named
+// after the given path suffixed with ".[bom name].delta.tsv". The size unit
+// and rounding PrintOptions are respected, and deltas with no change in count
+// and a size change that rounds to 0 are not printed, since they are likely
+// just due to the rounding of sizes in a TSV parsed by ParseStatsTSV(). Like
+// PrintBoMDirectoryStats(), the files are written under temporary names and
+// only renamed once they have all been closed successfully.
+func PrintStatsDeltas(path string, deltas []*StatsDelta, opts ...PrintOption) error {
+	po := newPrintOptions(opts)
+	writers := make(map[string]*outputFile)
+	files := &outputFiles{}
+
+	defer files.discard()
+
+	for _, d := range deltas {
+		size := fmt.Sprintf("%.2f", po.convertSize(d.Size))
+		if d.Count == 0 && (size == "0.00" || size == "-0.00") {
+			continue
+		}
+
+		file, ok := writers[string(d.BoM)]
+		if !ok {
+			var err error
+
+			file, err = po.createOutputFile(fmt.Sprintf("%s.%s.delta.tsv", path, d.BoM))
+			if err != nil {
+				return err
+			}
+
+			writers[string(d.BoM)] = file
+			files.add(file)
+		}
+
+		if _, err := fmt.Fprintf(file, "%s\t%d\t%s\n", d.Directory, d.Count, size); err != nil {
+			return err
+		}
+	}
+
+	return files.commit()
+}
@@ -0,0 +1,186 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"io"
+	"slices"
+	"time"
+)
+
+// DirectoryUserStats holds the Stats of a directory, along with the Stats of
+// the top users (by Size) that own files nested within it.
+type DirectoryUserStats struct {
+	*Stats
+	Users []*OwnerStats
+}
+
+// userDirectoryStats is a bomDirectoryStats that also accumulates per-UID
+// stats for each directory.
+type userDirectoryStats struct {
+	bomDirectoryStats
+	users map[*Stats]map[int64]*OwnerStats
+	uid   int64
+	file  *Stats
+}
+
+// statsFor returns the Stats for the given BoM and directory, creating it if
+// necessary. Since accumulateDirStats() calls this once for every directory
+// the current file is nested within, this is also where the current file gets
+// added to the current user's stats for the directory.
+func (u *userDirectoryStats) statsFor(bom []byte, dir string) *Stats {
+	s := u.bomDirectoryStats.statsFor(bom, dir)
+
+	users, ok := u.users[s]
+	if !ok {
+		users = make(map[int64]*OwnerStats)
+		u.users[s] = users
+	}
+
+	ostats, ok := users[u.uid]
+	if !ok {
+		ostats = &OwnerStats{Owner: u.uid, BoM: bom}
+		users[u.uid] = ostats
+	}
+
+	ostats.Count += u.file.Count
+	ostats.Size += u.file.Size
+
+	return s
+}
+
+// BoMDirectoryUserStats is like BoMDirectoryStats(), but also breaks down each
+// directory's stats by the UIDs that own the files nested within it, keeping
+// only the topK largest users per directory (or all of them if topK is 0).
+func BoMDirectoryUserStats(sp *StatsParser, gp *GIDToBoM, d time.Duration,
+	topK int) ([]*DirectoryUserStats, error) {
+	sp.FilterForFilesOlderThan(d)
+
+	u := &userDirectoryStats{
+		bomDirectoryStats: make(bomDirectoryStats),
+		users:             make(map[*Stats]map[int64]*OwnerStats),
+	}
+
+	for sp.Scan() {
+		bom, err := gp.GetBom(int(sp.GID))
+		if err != nil {
+			return nil, err
+		}
+
+		u.uid = sp.UID
+		u.file = fileStats(sp)
+
+		accumulateDirStats(sp.Path, u.file, bom, u)
+	}
+
+	if err := sp.Err(); err != nil {
+		return nil, err
+	}
+
+	return u.results(topK), nil
+}
+
+// results returns our Stats sorted like BoMDirectoryStats(), each with its top
+// K users.
+func (u *userDirectoryStats) results(topK int) []*DirectoryUserStats {
+	stats := sortBoMDirectoryStats(u.bomDirectoryStats)
+	results := make([]*DirectoryUserStats, len(stats))
+
+	for i, s := range stats {
+		results[i] = &DirectoryUserStats{
+			Stats: s,
+			Users: topUsers(u.users[s], topK),
+		}
+	}
+
+	return results
+}
+
+// topUsers returns the given users sorted largest Size first (then by UID),
+// limited to the first topK if topK is greater than 0.
+func topUsers(users map[int64]*OwnerStats, topK int) []*OwnerStats {
+	sorted := make([]*OwnerStats, 0, len(users))
+
+	for _, ostats := range users {
+		sorted = append(sorted, ostats)
+	}
+
+	slices.SortFunc(sorted, func(a, b *OwnerStats) int {
+		if n := cmp.Compare(b.Size, a.Size); n != 0 {
+			return n
+		}
+
+		return cmp.Compare(a.Owner, b.Owner)
+	})
+
+	if topK > 0 && len(sorted) > topK {
+		sorted = sorted[:topK]
+	}
+
+	return sorted
+}
+
+type jsonUser struct {
+	UID   int64  `json:"uid"`
+	Count uint64 `json:"count"`
+	Size  int64  `json:"size_bytes"`
+}
+
+type jsonDirectory struct {
+	BoM       string     `json:"bom"`
+	Directory string     `json:"directory"`
+	Count     uint64     `json:"count"`
+	Size      int64      `json:"size_bytes"`
+	Users     []jsonUser `json:"users"`
+}
+
+// WriteDirectoryUserStatsJSON writes the given BoMDirectoryUserStats() results
+// to the given writer as a JSON array, with one object per directory that nests
+// its users:
+//
+//	[{"bom":"...","directory":"...","count":1,"size_bytes":1,
+//	  "users":[{"uid":1,"count":1,"size_bytes":1}]}]
+func WriteDirectoryUserStatsJSON(w io.Writer, stats []*DirectoryUserStats) error {
+	dirs := make([]jsonDirectory, len(stats))
+
+	for i, s := range stats {
+		users := make([]jsonUser, len(s.Users))
+
+		for j, ostats := range s.Users {
+			users[j] = jsonUser{UID: ostats.Owner, Count: ostats.Count, Size: ostats.Size}
+		}
+
+		dirs[i] = jsonDirectory{
+			BoM:       string(s.BoM),
+			Directory: s.Directory,
+			Count:     s.Count,
+			Size:      s.Size,
+			Users:     users,
+		}
+	}
+
+	return json.NewEncoder(w).Encode(dirs)
+}
@@ -0,0 +1,98 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/base64"
+	"time"
+)
+
+// Entry is a snapshot of the details of a single entry in wrstat stats data,
+// along with the AgeMetric of the StatsParser it came from.
+type Entry struct {
+	Path      []byte
+	Size      int64
+	UID       int64
+	GID       int64
+	ATime     int64
+	MTime     int64
+	CTime     int64
+	EntryType byte
+	Inode     int64
+	Nlink     int64
+	AgeMetric AgeMetric
+}
+
+// Entry returns the details of the entry most recently read by Scan().
+//
+// Unlike the Path property, which is overwritten by the next Scan(), the
+// returned Entry's Path is a copy owned by the Entry, so it remains valid.
+func (p *StatsParser) Entry() Entry {
+	return Entry{
+		Path:      append([]byte(nil), p.Path...),
+		Size:      p.Size,
+		UID:       p.UID,
+		GID:       p.GID,
+		ATime:     p.ATime,
+		MTime:     p.MTime,
+		CTime:     p.CTime,
+		EntryType: p.EntryType,
+		Inode:     p.Inode,
+		Nlink:     p.Nlink,
+		AgeMetric: p.ageMetric,
+	}
+}
+
+// ParseLine parses a single line of stats data (without its newline) in to an
+// Entry, for when you get lines from somewhere other than an io.Reader. No
+// filters are applied. Any error is one of ErrTooFewColumns, ErrBadNumber,
+// ErrNumberTooLarge, ErrEmptyColumn, ErrEmptyFileSize, ErrBadPath or
+// ErrPathTooLong, classifying the problem with the line.
+// (ErrTruncatedInput can only come from Scan(), which knows where its input
+// ends.)
+func ParseLine(line []byte) (Entry, error) {
+	p := &StatsParser{
+		pathBuffer: make([]byte, base64.StdEncoding.DecodedLen(maxBase64EncodedPathLength)),
+		lineBytes:  line,
+		lineLength: len(line),
+	}
+
+	encodedPath, ok := p.parseColumns()
+	if ok {
+		ok = p.decodePath(encodedPath)
+	}
+
+	if !ok {
+		return Entry{}, p.error
+	}
+
+	return p.Entry(), nil
+}
+
+// IsOlderThan returns true if this entry is older than the given cutoff, with
+// its age determined by its AgeMetric in the same way as
+// StatsParser.FilterForFilesOlderThan() does.
+func (e Entry) IsOlderThan(cutoff time.Time) bool {
+	return e.AgeMetric.time(e.ATime, e.MTime, e.CTime) <= cutoff.Unix()
+}
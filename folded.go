@@ -0,0 +1,91 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const foldedRoot = "root"
+
+// WriteBoMDirectoryStatsFolded writes the given stats (as returned by
+// BoMDirectoryStats()) as "folded stacks" for flame graph tools, one file per
+// BoM area, named after the given path suffixed with ".[bom name].folded", with
+// lines like:
+//
+//	root;lustre;scratch122;tol 26440
+//
+// The sizes are the OwnSize of each directory, so that the flame graph tools
+// sum them to get the cumulative sizes. Directories with an OwnSize of 0 are
+// left out.
+func WriteBoMDirectoryStatsFolded(path string, stats []*Stats) error {
+	boms, bomStats := groupByBoM(stats)
+
+	for _, bom := range boms {
+		if err := writeFoldedFile(fmt.Sprintf("%s.%s.folded", path, bom), bomStats[bom]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFoldedFile writes the given stats of a single BoM to the given file as
+// folded stacks.
+func writeFoldedFile(name string, stats []*Stats) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(f)
+
+	for _, s := range stats {
+		if s.OwnSize == 0 {
+			continue
+		}
+
+		fmt.Fprintf(bw, "%s %d\n", foldedStack(s.Directory), s.OwnSize)
+	}
+
+	err = bw.Flush()
+	if errc := f.Close(); err == nil {
+		err = errc
+	}
+
+	return err
+}
+
+// foldedStack converts the given directory to a folded stack of its path
+// segments, starting with foldedRoot.
+func foldedStack(dir string) string {
+	if dir == "/" {
+		return foldedRoot
+	}
+
+	return foldedRoot + strings.ReplaceAll(dir, "/", ";")
+}
@@ -1,11 +1,18 @@
 module github.com/sb10/stats-parse
 
-go 1.21.1
+go 1.22
 
-require github.com/smartystreets/goconvey v1.8.1
+require (
+	github.com/smartystreets/goconvey v1.8.1
+	github.com/xitongsys/parquet-go v1.5.5-0.20201110004701-b09c49d6d457
+	github.com/xitongsys/parquet-go-source v0.0.0-20200817004010-026bad9b25d0
+)
 
 require (
+	github.com/apache/thrift v0.14.2 // indirect
+	github.com/golang/snappy v0.0.1 // indirect
 	github.com/gopherjs/gopherjs v1.17.2 // indirect
 	github.com/jtolds/gls v4.20.0+incompatible // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
 	github.com/smarty/assertions v1.15.0 // indirect
 )
@@ -0,0 +1,72 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"os"
+)
+
+// WriteBoMDirectoryStatsGob writes the given stats (as returned by
+// BoMDirectoryStats()) to a single file at the given path in Go's gob format.
+// Unlike PrintBoMDirectoryStats(), this is lossless, keeping every field of
+// every Stats, and can be quickly read back with ReadBoMDirectoryStatsGob(), eg.
+// to MergeStats() or DiffStats() with the results of another run.
+func WriteBoMDirectoryStatsGob(path string, stats []*Stats) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(f)
+
+	err = gob.NewEncoder(bw).Encode(stats)
+	if err == nil {
+		err = bw.Flush()
+	}
+
+	if errc := f.Close(); err == nil {
+		err = errc
+	}
+
+	return err
+}
+
+// ReadBoMDirectoryStatsGob reads back the stats written to the given path by
+// WriteBoMDirectoryStatsGob().
+func ReadBoMDirectoryStatsGob(path string) ([]*Stats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var stats []*Stats
+
+	err = gob.NewDecoder(bufio.NewReader(f)).Decode(&stats)
+
+	return stats, err
+}
@@ -0,0 +1,118 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// outputIndex records the output files created for each BoM.
+type outputIndex struct {
+	boms  [][]byte
+	paths []string
+}
+
+func newOutputIndex() *outputIndex {
+	return &outputIndex{}
+}
+
+func (oi *outputIndex) add(bom []byte, path string) {
+	oi.boms = append(oi.boms, bom)
+	oi.paths = append(oi.paths, path)
+}
+
+// writeIndex writes the given index to the given path as a TSV of original
+// BoM name and output path, if WithIndex() was used. Like the output files, it
+// is written under a temporary name first if we rename outputs.
+func (po *printOptions) writeIndex(path string, index *outputIndex) error {
+	if po.index == nil {
+		return nil
+	}
+
+	file, err := po.createOutputFile(path)
+	if err != nil {
+		return err
+	}
+
+	files := &outputFiles{}
+	files.add(file)
+
+	defer files.discard()
+
+	for i, bom := range index.boms {
+		if _, err = fmt.Fprintf(file, "%s\t%s\n", po.index.BoMName(bom), index.paths[i]); err != nil {
+			return err
+		}
+	}
+
+	return files.commit()
+}
+
+// bomFromIndex looks for the given output file in the index.tsv at the given
+// path, returning the file's (normalised) BoM, whether that BoM has other
+// output files as well, and whether the file was found. A missing index is not
+// an error.
+func bomFromIndex(indexPath, path string) (string, bool, bool, error) {
+	f, err := os.Open(indexPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, false, nil
+	} else if err != nil {
+		return "", false, false, err
+	}
+
+	defer f.Close()
+
+	var (
+		bom   string
+		found bool
+	)
+
+	files := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		name, output, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+
+		name = string(refomatBoM([]byte(name)))
+		files[name]++
+
+		if filepath.Base(output) == filepath.Base(path) {
+			bom, found = name, true
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return "", false, false, fmt.Errorf("%s: %w", indexPath, err)
+	}
+
+	return bom, files[bom] > 1, found, nil
+}
@@ -0,0 +1,57 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+)
+
+const inputBufferSize = 1024 * 1024
+
+var gzipMagic = []byte{0x1f, 0x8b} //nolint:gochecknoglobals
+
+// DecompressIfGzipped returns a reader that gives the uncompressed form of the
+// given reader's data, which may or may not be gzip compressed.
+//
+// The first bytes are peeked at to detect gzip data, blocking until enough
+// bytes have arrived, so it is safe to use on pipes and FIFOs where short reads
+// are common. No data is consumed by the detection.
+func DecompressIfGzipped(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, inputBufferSize)
+
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if !bytes.Equal(magic, gzipMagic) {
+		return br, nil
+	}
+
+	return gzip.NewReader(br)
+}
@@ -0,0 +1,71 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io"
+	"log"
+)
+
+// logLevel determines which messages a leveledLogger prints.
+type logLevel int
+
+const (
+	logQuiet logLevel = iota
+	logNormal
+	logVerbose
+)
+
+// leveledLogger is a log.Logger that always prints errors, prints warnings
+// unless quiet, and only prints verbose messages when verbose.
+type leveledLogger struct {
+	*log.Logger
+	level logLevel
+}
+
+func newLeveledLogger(w io.Writer, level logLevel) *leveledLogger {
+	return &leveledLogger{
+		Logger: log.New(w, "", 0),
+		level:  level,
+	}
+}
+
+// Errorf prints an error message, regardless of level.
+func (ll *leveledLogger) Errorf(format string, v ...any) {
+	ll.Printf("ERROR: "+format, v...)
+}
+
+// Warnf prints a warning message, unless our level is quiet.
+func (ll *leveledLogger) Warnf(format string, v ...any) {
+	if ll.level >= logNormal {
+		ll.Printf("WARNING: "+format, v...)
+	}
+}
+
+// Verbosef prints an informational message, only if our level is verbose.
+func (ll *leveledLogger) Verbosef(format string, v ...any) {
+	if ll.level >= logVerbose {
+		ll.Printf(format, v...)
+	}
+}
@@ -24,74 +24,728 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const helpText = `stats-parse parses wrstat stats.gz files quickly, in low mem.
 
-It requires a bom.gids file generated like:
+It requires a bom.gids file generated from a CSV file of unix group name and
+BoM area like:
 
-cat /nfs/wrstat/bom.areas | perl -e '%b; while (<>) { chomp; ($g, $b) =
-	split(",", $_); $gid = getgrnam($g); push(@{$b{$b}}, $gid); } for $b (sort
-	keys %b) { print "$b\t", join(",", @{$b{$b}}), "\n" }' > bom.gids
+stats-parse gen-bom-gids -areas /nfs/wrstat/bom.areas > bom.gids
 
-Specify the path to this file with -b, and also pipe in the uncompressed data
-from one or more wrstat stats.gz files.
+Specify the path to this file with -b, and also pipe in the data from one or
+more wrstat stats.gz files (either uncompressed, or still gzip compressed).
 
-It will produce tsv output with columns:
+It will produce tsv output with a header row and columns:
 * directory
-* number of files older than -a years nested within the directory
-* size of files (GiB) older than -a years nested within the directory
-Where age is determined using the oldest of c and m time. One file per BoM area
-will be created, named [-p].[bom area].tsv.
+* count: number of files older than -a years nested within the directory
+* bytes: size of files older than -a years nested within the directory
+* GiB: that size in GiB (or GB with -gb)
+With -legacy, there is no header row or bytes column.
+Where age is determined using the oldest of c and m time (or, with -metric
+newest-am, the newest of a and m time). One file per BoM area will be created,
+named [-p].[bom area].tsv.
 
-Usage: zcat wrstat.stats.gz | stats-parse -a <int> -b <path>
+If you run it separately on different stats.gz files (eg. per shard), you can
+combine the resulting output files in to one file per BoM area, summing the
+counts and sizes of the same directories, with:
+
+stats-parse merge -o combined shard1.ToL.tsv shard2.ToL.tsv [...]
+
+Files written with -legacy have no header row saying what unit their sizes are
+in, so can only be merged by also giving merge -legacy, and -gb if they were
+written with -gb (in which case the combined files are also in GB).
+
+Usage: zcat wrstat.stats.gz | stats-parse [-a <int> | -d <age>] -b <path>
+   or: stats-parse [-a <int> | -d <age>] -b <path> [-parallel <int>] *.stats.gz
 Options:
-  -h          this help text
-  -o <string> prefix path to output files
-  -a <int>    age of files to report on (years, per oldest of c&mtime)
-  -b <string> path to bom.gids file
+  -h           this help text
+  -o <string>  prefix path to output files
+  -a <int>     age of files to report on (years, per oldest of c&mtime)
+  -d <string>  age of files to report on as a duration, instead of -a, eg. 5y,
+               18mo, 2w, 30d or 43800h
+               (if neither -a nor -d are supplied, the age is taken from the
+               STATS_PARSE_AGE environment variable, as years or like -d,
+               defaulting to 7 years)
+  -b <string>  path to bom.gids file
+  -metric <string>
+               how to determine age: oldest-cm (default; oldest of c&mtime) or
+               newest-am (newest of a&mtime)
+  -path-encoding <string>
+               base64 padding of the paths in the stats data: padded (default),
+               unpadded, or any to accept both
+  -bom-column  prepend the BoM area as the first column of every row
+  -allow-empty only warn, instead of failing, if no stats data is piped in
+  -group-by <string>
+               instead of by directory, group files by the first capture group
+               of this regular expression matched against their paths, eg.
+               '/project_([^/]+)/'; files that don't match are grouped as
+               "unmatched"
+  -project-roots <string>
+               instead of by directory, group files by the nearest of their
+               ancestors in this comma separated list of directories; files
+               not within any of them are grouped as "other"
+  -root <string>
+               only report on files nested within this directory, outputting
+               rows for it and its subdirectories, but not its ancestors
+  -spill <int> limit memory use by spilling to disk after this many directories
+  -parallel <int>
+               when stats files are given as arguments instead of piping to
+               stdin, parse them using this many workers (default the number of
+               CPUs); ignored with options that change how stats are aggregated
+               or sorted, or with -future
+  -input-list <string>
+               path to a file listing stats files to parse (before any given as
+               arguments), one per line; blank lines and lines starting with #
+               are ignored
+  -fold-path-case
+               lowercase all paths, so that paths that only differ by case are
+               treated as the same
+  -normalise-paths
+               collapse repeated slashes and remove "." segments in paths (but
+               not ".." segments), so that eg. /a//b and /a/./b are treated as
+               /a/b
+  -exclude-gids <string>
+               comma separated GIDs (or ranges like 1000-1010) whose files should
+               be ignored
+  -depth-cap <int>
+               count files nested deeper than this many directories in their
+               ancestor directory at this depth
+  -max-segments <int>
+               skip, with a warning, any path with more than this many
+               segments, to guard against pathologically deep paths
+  -dump-mapping <string>
+               write the GID to BoM area mapping actually used (eg. after
+               -fold-case) to this file, as tsv of gid and BoM area
+  -fold-case   treat BoM areas whose names only differ by case as the same
+  -since-file <string>
+               path to a previous run's output file for a BoM area; also write
+               [prefix].[bom].delta.tsv with the changes since then (a file
+               written with -legacy, which has no header row, can only be
+               read with -legacy, and -gb if it was written with -gb)
+  -deepest <int>
+               instead of directory stats, write [prefix].[bom].deepest.tsv
+               listing the depth and path of the n (at most 1000) most deeply
+               nested files in each BoM area
+  -now <string>
+               RFC3339 time (eg. 2024-05-09T13:34:25Z) that ages are relative
+               to, instead of the current time; use the time the stats were
+               collected for reproducible results from archived stats files
+  -future <string>
+               write the paths of files whose mtime or ctime is in the future
+               to this file (the number of them is always logged as a warning)
+  -ndjson      instead of tsv files, write every row of every BoM area to stdout
+               as gzip compressed newline delimited JSON objects with keys
+               bom, directory, count and size_bytes
+  -folded      also write [prefix].[bom area].folded files of "folded stacks" of
+               the sizes of the files directly in each directory, for flame
+               graph tools
+  -gob         also write [prefix].gob, a lossless binary copy of all the stats
+               that is fast for Go programs to read back
+  -largest-boms-first
+               with -ndjson, group the rows by BoM area, with the BoM areas with
+               the largest total size first
+  -check       warn about any directory whose count or size isn't the sum of
+               its subdirectories and own files; can't be used with
+               -direct-only or -min-cold
+  -clean       delete any other [prefix].*.tsv files, such as those of BoM
+               areas that no longer exist, and any index.tsv if -index wasn't
+               used
+  -all-boms    also write an output file, empty apart from any -m comment, for
+               every BoM area in the bom.gids file that had no old files, so
+               that every expected output file always exists
+  -index       also write an index.tsv listing the BoM area and path of every
+               output file
+  -max-rows-per-file <int>
+               split each BoM area's output in to part files of at most this
+               many rows (plus header), named [prefix].[bom area].part0001.tsv
+               etc.
+  -legacy      output the old format, without the header row and bytes column
+  -own         add columns for the number and size of files directly in each
+               directory
+  -direct-only only output directories that directly contain old files, not
+               those that only have old files in their subdirectories
+  -smallest-first
+               sort directories smallest first, instead of largest first
+  -inodes      sort directories by the number of files (and so inodes) nested
+               within them, most first, instead of largest first
+  -sort-by-age sort directories by the mtime of their least recently modified
+               file, oldest first, instead of largest first
+  -split-top   also split output files by top level directory, naming them
+               [prefix].[bom].[top directory].tsv
+  -hardlinks   add a column for the number of files with more than 1 hardlink
+  -cold        add a column for the fraction of each directory's size that is
+               made up of old files (this makes reading the stats data slower)
+  -min-cold <float>
+               implies -cold, and only output directories with at least this
+               fraction of their size made up of old files, eg. 0.9
+  -sort-by-cold
+               sort directories by the fraction of their size made up of old
+               files, most first, instead of largest first; implies -cold
+  -split-cold <float>
+               implies -cold, and split each BoM area's output in to
+               [prefix].[bom area].cold.tsv for directories with at least this
+               fraction of their size made up of old files, eg. 0.5, and
+               [prefix].[bom area].recent.tsv for the rest
+  -tree        output directories as an indented tree of basenames
+  -m           start each file with a comment line recording the age, time and
+               version
+  -round <string>
+               how to round sizes: nearest (default), half-up, up or truncate
+  -gb          output sizes in decimal GB (1000^3 bytes) instead of GiB
+  -min-bom-size <float>
+               do not output anything for BoM areas whose total size (in GiB, or
+               GB with -gb) is less than this
+  -min-bom-count <int>
+               do not output anything for BoM areas with fewer files than this
+  -no-root     do not output the "/" row (the grand total) of each BoM area
+  -progress    every 10s, report the percentage of stdin read so far on stderr
+               (or the number of lines read, if stdin isn't a regular file)
+  -q           quiet: only log errors
+  -v           verbose: also log the timings and counts of each phase
+  -summary     also write a human readable summary of the results (the number
+               of BoM areas, directories and files, and their size, in total and
+               for each BoM area) to stderr, with thousands separators
 `
 
 const (
-	hoursInDay  = 24
-	daysPerYear = 356
+	createRetries    = 5
+	createBackoff    = 100 * time.Millisecond
+	progressInterval = 10 * time.Second
+	ageEnvVar        = "STATS_PARSE_AGE"
+)
+
+const (
+	ErrNoBoMGIDsFile   = Error("you must provide the path to bom.gids file")
+	ErrBadAge          = Error("age must be greater than 0, and -a at most 292 years")
+	ErrQuietAndVerbose = Error("-q and -v are mutually exclusive")
+	ErrAgeAndDuration  = Error("-a and -d are mutually exclusive")
+	ErrSortOrders      = Error("-smallest-first, -sort-by-age, -sort-by-cold and -inodes are mutually exclusive")
+	ErrBadColdFraction = Error("-min-cold and -split-cold must be between 0 and 1")
+	ErrNoAreasFile     = Error("you must provide the path to bom.areas file")
+	ErrNoMergeFiles    = Error("you must provide the output files to merge")
+	ErrBadParallel     = Error("-parallel must not be negative")
+	ErrCheckFiltered   = Error("-check can't be used with -direct-only or -min-cold, which remove rows it needs")
+	ErrBadOutputName   = Error("output file name is not like [prefix].[bom].tsv with no other dots, and isn't in an index.tsv")
+	ErrPartialOutput   = Error("-since-file is one of several files split from a BoM's output, not all of it")
+
+	genBoMGIDsCommand = "gen-bom-gids"
+	mergeCommand      = "merge"
 )
 
-var l = log.New(os.Stderr, "", 0) //nolint:gochecknoglobals
+var l = newLeveledLogger(os.Stderr, logNormal) //nolint:gochecknoglobals
+
+// cliOptions holds the options supplied on the command line.
+type cliOptions struct {
+	help        bool
+	prefix      string
+	bomGidsFile string
+	age         int
+	ageDuration string
+	maxAge      time.Duration
+	ageLabel    string
+	ageMetric   AgeMetric
+	pathEnc     PathEncoding
+	spill       int
+	allowEmpty  bool
+	excludeGIDs []GIDRange
+	foldCase    bool
+	foldPaths   bool
+	normalise   bool
+	depthCap    int
+	maxSegments int
+	bomColumn   bool
+	noRoot      bool
+	gb          bool
+	minBoMSize  float64
+	rounding    RoundingMode
+	metadata    bool
+	tree        bool
+	splitTop    bool
+	smallest    bool
+	byAge       bool
+	inodes      bool
+	minBoMCount uint64
+	own         bool
+	directOnly  bool
+	hardlinks   bool
+	cold        bool
+	minCold     float64
+	byCold      bool
+	splitCold   float64
+	index       bool
+	clean       bool
+	check       bool
+	sinceFile   string
+	deepest     int
+	futureFile  string
+	now         time.Time
+	ndjson      bool
+	bomsBySize  bool
+	folded      bool
+	gob         bool
+	allBoMs     bool
+	root        string
+	legacy      bool
+	progress    bool
+	pathKey     *regexp.Regexp
+	projRoots   []string
+	maxRows     int
+	mappingFile string
+	parallel    int
+	inputList   string
+	summary     bool
+	files       []string
+	quiet       bool
+	verbose     bool
+}
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == genBoMGIDsCommand {
+		genBoMGIDs(os.Args[2:])
+
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == mergeCommand {
+		mergeOutputs(os.Args[2:])
+
+		return
+	}
+
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		exitHelp("ERROR: " + err.Error())
+	}
+
+	if opts.help {
+		exitHelp("")
+	}
+
+	l.level = logLevelFromFlags(opts.quiet, opts.verbose)
+
+	gtb := parseBoMGIDsFile(opts.bomGidsFile, opts.gidToBoMOptions()...)
+
+	if opts.mappingFile != "" {
+		dumpMapping(gtb, opts.mappingFile)
+	}
+
+	if opts.deepest > 0 {
+		printDeepestPaths(gtb, opts)
+
+		return
+	}
+
+	start := time.Now()
+	stats := parseInput(gtb, opts, opts.statsOptions()...)
+
+	if opts.summary {
+		printSummary(stats, time.Since(start), opts.printOptions(gtb))
+	}
+
+	if opts.check {
+		for _, err := range ValidateStats(stats) {
+			l.Warnf("%s", err)
+		}
+	}
+
+	writeOutputs(gtb, opts, stats)
+}
+
+// printSummary writes a summary of the given stats, which took the given time
+// to parse, to stderr, with thousands separators to make it easy to read.
+func printSummary(stats []*Stats, elapsed time.Duration, opts []PrintOption) {
+	summary := summarise(stats)
+	summary.Elapsed = elapsed
+
+	if err := PrintRunSummary(os.Stderr, summary, append(opts, WithThousandsSeparators())...); err != nil {
+		die(err)
+	}
+}
+
+// writeOutputs writes the given stats as tsv files, or to stdout as NDJSON, and
+// also writes the deltas since a previous run if requested.
+func writeOutputs(gtb *GIDToBoM, opts *cliOptions, stats []*Stats) {
 	var (
-		help        = flag.Bool("h", false, "print help text")
-		prefix      string
-		bomGidsFile string
-		age         int
+		sinceBoM string
+		before   []*Stats
 	)
 
-	flag.StringVar(&prefix, "o", "output", "prefix path to output files")
-	flag.StringVar(&bomGidsFile, "b", "", "path to bom.gids file")
-	flag.IntVar(&age, "a", defaultAge, "age of files to report on (years, per oldest of c&mtime)")
-	flag.Parse()
+	if opts.sinceFile != "" {
+		sinceBoM, before = readSinceFile(opts.sinceFile, newStatsTSVParser(opts.legacy, opts.sizeUnit()))
+	}
 
-	if *help {
-		exitHelp("")
+	if opts.ndjson {
+		if err := WriteGzippedBoMDirectoryStatsNDJSON(os.Stdout, stats); err != nil {
+			die(err)
+		}
+	} else {
+		printStats(opts.prefix, stats, opts.printOptions(gtb)...)
+	}
+
+	if opts.sinceFile != "" {
+		printDeltas(opts.prefix, sinceBoM, before, stats, opts.printOptions(gtb)...)
+	}
+
+	if opts.folded {
+		if err := WriteBoMDirectoryStatsFolded(opts.prefix, stats); err != nil {
+			die(err)
+		}
+	}
+
+	if opts.gob {
+		if err := WriteBoMDirectoryStatsGob(opts.prefix+".gob", stats); err != nil {
+			die(err)
+		}
+	}
+}
+
+// genBoMGIDs implements the gen-bom-gids subcommand, writing bom.gids data
+// generated from the -areas file to stdout.
+func genBoMGIDs(args []string) {
+	fs := flag.NewFlagSet(genBoMGIDsCommand, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	areas := fs.String("areas", "", "path to bom.areas file")
+
+	if err := fs.Parse(args); err != nil {
+		exitHelp("ERROR: " + err.Error())
+	}
+
+	if *areas == "" {
+		exitHelp("ERROR: " + ErrNoAreasFile.Error())
+	}
+
+	if err := writeBoMGIDs(*areas, os.Stdout, lookupGroupGID); err != nil {
+		die(err)
+	}
+}
+
+// writeBoMGIDs generates bom.gids data from the given bom.areas file, and
+// writes it to the given writer if it is valid.
+func writeBoMGIDs(areasPath string, w io.Writer, lookup GroupLookup) error {
+	f, err := os.Open(areasPath)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var buf bytes.Buffer
+
+	if err = GenerateBoMGIDs(f, &buf, lookup); err != nil {
+		return fmt.Errorf("%s: %w", areasPath, err)
+	}
+
+	if errs := ValidateBomGIDs(bytes.NewReader(buf.Bytes())); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	_, err = buf.WriteTo(w)
+
+	return err
+}
+
+// parseArgs parses the given command line arguments in to cliOptions,
+// returning an error if they are not valid.
+func parseArgs(args []string) (*cliOptions, error) {
+	opts := &cliOptions{}
+
+	fs := flag.NewFlagSet("stats-parse", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.help, "h", false, "print help text")
+	fs.StringVar(&opts.prefix, "o", "output", "prefix path to output files")
+	fs.StringVar(&opts.bomGidsFile, "b", "", "path to bom.gids file")
+	fs.IntVar(&opts.age, "a", defaultAge, "age of files to report on (years, per oldest of c&mtime)")
+	fs.StringVar(&opts.ageDuration, "d", "", "age of files to report on as a duration, instead of -a")
+	fs.Func("metric", "how to determine age: oldest-cm (default) or newest-am", func(name string) error {
+		var err error
+
+		opts.ageMetric, err = ParseAgeMetric(name)
+
+		return err
+	})
+	fs.Func("path-encoding", "base64 padding of paths in the stats data: padded (default), unpadded or any",
+		func(name string) error {
+			var err error
+
+			opts.pathEnc, err = ParsePathEncoding(name)
+
+			return err
+		})
+	fs.BoolVar(&opts.allowEmpty, "allow-empty", false, "only warn, instead of failing, if no stats data is piped in")
+	fs.Func("group-by", "regular expression whose capture group is the key to group paths by", func(expr string) error {
+		var err error
+
+		opts.pathKey, err = regexp.Compile(expr)
+
+		return err
+	})
+	fs.Func("project-roots", "comma separated directories to group files by the nearest of", func(roots string) error {
+		opts.projRoots = strings.Split(roots, ",")
+
+		return nil
+	})
+	fs.StringVar(&opts.root, "root", "", "only report on this directory and the directories within it")
+	fs.IntVar(&opts.spill, "spill", 0, "limit memory use by spilling to disk after this many directories")
+	fs.IntVar(&opts.parallel, "parallel", 0, "parse stats files given as arguments using this many workers")
+	fs.StringVar(&opts.inputList, "input-list", "", "path to a file listing stats files to parse, one per line")
+	fs.BoolVar(&opts.foldPaths, "fold-path-case", false, "lowercase all paths, so that case variants are the same")
+	fs.BoolVar(&opts.normalise, "normalise-paths", false, "collapse repeated slashes and \".\" segments in paths")
+	fs.Func("exclude-gids", "comma separated GIDs (or ranges) whose files should be ignored", func(gids string) error {
+		var err error
+
+		opts.excludeGIDs, err = gidsCSVtoRanges([]byte(gids))
+
+		return err
+	})
+	fs.IntVar(&opts.depthCap, "depth-cap", 0, "count files nested deeper than this in their ancestor at this depth")
+	fs.IntVar(&opts.maxSegments, "max-segments", 0, "skip, with a warning, paths with more segments than this")
+	fs.StringVar(&opts.mappingFile, "dump-mapping", "", "write the GID to BoM area mapping used to this file")
+	fs.BoolVar(&opts.foldCase, "fold-case", false, "treat BoM areas whose names only differ by case as the same")
+	fs.BoolVar(&opts.bomColumn, "bom-column", false, "prepend the BoM area as the first column of every row")
+	fs.BoolVar(&opts.noRoot, "no-root", false, "do not output the \"/\" row of each BoM area")
+	fs.StringVar(&opts.sinceFile, "since-file", "", "path to a previous run's output file to write changes since")
+	fs.IntVar(&opts.deepest, "deepest", 0, "instead of directory stats, report the n deepest files per BoM area")
+	fs.Func("now", "RFC3339 time that ages are relative to, instead of the current time", func(now string) error {
+		var err error
+
+		opts.now, err = time.Parse(time.RFC3339, now)
+
+		return err
+	})
+	fs.StringVar(&opts.futureFile, "future", "", "write the paths of files with times in the future to this file")
+	fs.BoolVar(&opts.ndjson, "ndjson", false, "write gzip compressed NDJSON to stdout instead of tsv files")
+	fs.BoolVar(&opts.folded, "folded", false, "also write folded stack files for flame graph tools")
+	fs.BoolVar(&opts.gob, "gob", false, "also write [prefix].gob, a lossless binary copy of the stats")
+	fs.BoolVar(&opts.bomsBySize, "largest-boms-first", false, "group rows by BoM area, largest BoM areas first")
+	fs.BoolVar(&opts.check, "check", false, "warn about directories whose counts or sizes don't sum")
+	fs.BoolVar(&opts.clean, "clean", false, "delete any other [prefix].*.tsv files, such as those of BoM areas that no longer exist")
+	fs.BoolVar(&opts.allBoMs, "all-boms", false, "also write empty files for BoM areas with no old files")
+	fs.BoolVar(&opts.index, "index", false, "also write an index.tsv listing the BoM area and path of every output file")
+	fs.IntVar(&opts.maxRows, "max-rows-per-file", 0, "split each BoM area's output in to parts of this many rows")
+	fs.BoolVar(&opts.legacy, "legacy", false, "output the old format without a header row or bytes column")
+	fs.BoolVar(&opts.own, "own", false, "add columns for the number and size of files directly in each directory")
+	fs.BoolVar(&opts.directOnly, "direct-only", false, "only output directories that directly contain old files")
+	fs.BoolVar(&opts.byAge, "sort-by-age", false, "sort directories by their oldest mtime, oldest first")
+	fs.BoolVar(&opts.inodes, "inodes", false, "sort directories by the number of files (inodes) they use, most first")
+	fs.BoolVar(&opts.smallest, "smallest-first", false, "sort directories smallest first, instead of largest first")
+	fs.BoolVar(&opts.splitTop, "split-top", false, "also split output files by top level directory")
+	fs.BoolVar(&opts.hardlinks, "hardlinks", false, "add a column for the number of files with more than 1 hardlink")
+	fs.BoolVar(&opts.cold, "cold", false, "add a column for the fraction of each directory's size that is old")
+	fs.Float64Var(&opts.minCold, "min-cold", 0, "only output directories with at least this fraction of their size old")
+	fs.BoolVar(&opts.byCold, "sort-by-cold", false, "sort directories by the fraction of their size that is old, most first")
+	fs.Float64Var(&opts.splitCold, "split-cold", 0, "split output in to cold and recent files at this fraction old")
+	fs.BoolVar(&opts.tree, "tree", false, "output directories as an indented tree of basenames")
+	fs.BoolVar(&opts.metadata, "m", false, "start each file with a comment line recording the age, time and version")
+	fs.Func("round", "how to round sizes: nearest (default), half-up, up or truncate", func(name string) error {
+		var err error
+
+		opts.rounding, err = ParseRoundingMode(name)
+
+		return err
+	})
+	fs.Float64Var(&opts.minBoMSize, "min-bom-size", 0, "do not output BoM areas whose total size is less than this")
+	fs.Uint64Var(&opts.minBoMCount, "min-bom-count", 0, "do not output BoM areas with fewer files than this")
+	fs.BoolVar(&opts.gb, "gb", false, "output sizes in decimal GB (1000^3 bytes) instead of GiB")
+	fs.BoolVar(&opts.progress, "progress", false, "periodically report progress reading stdin on stderr")
+	fs.BoolVar(&opts.quiet, "q", false, "quiet: only log errors")
+	fs.BoolVar(&opts.verbose, "v", false, "verbose: also log the timings and counts of each phase")
+	fs.BoolVar(&opts.summary, "summary", false, "also write a human readable summary of the results to stderr")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if opts.help {
+		return opts, nil
+	}
+
+	opts.files = fs.Args()
+
+	if err := opts.addInputList(); err != nil {
+		return nil, err
+	}
+
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return opts, opts.setMaxAge(flagsSet(fs))
+}
+
+// addInputList prepends the stats file paths listed in our -input-list file, if
+// any, to our files.
+func (o *cliOptions) addInputList() error {
+	if o.inputList == "" {
+		return nil
+	}
+
+	f, err := os.Open(o.inputList)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	listed, err := readInputList(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", o.inputList, err)
+	}
+
+	o.files = append(listed, o.files...)
+
+	return nil
+}
+
+// readInputList returns the paths in the given list, one per line, ignoring
+// blank lines and # comments.
+func readInputList(r io.Reader) ([]string, error) {
+	var paths []string
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		paths = append(paths, line)
+	}
+
+	return paths, scanner.Err()
+}
+
+// flagsSet returns the names of the flags that were set on the command line.
+func flagsSet(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	return set
+}
+
+// setMaxAge sets maxAge and ageLabel from either -a or -d, falling back on the
+// ageEnvVar environment variable if neither were set.
+func (o *cliOptions) setMaxAge(set map[string]bool) error {
+	if set["a"] && set["d"] {
+		return ErrAgeAndDuration
+	}
+
+	if !set["a"] && !set["d"] {
+		if env := os.Getenv(ageEnvVar); env != "" {
+			return o.setMaxAgeFromEnv(env)
+		}
+	}
+
+	if !set["d"] {
+		o.maxAge = time.Duration(o.age) * year
+		o.ageLabel = fmt.Sprintf("%dy", o.age)
+
+		return nil
+	}
+
+	var err error
+
+	o.maxAge, err = ParseAge(o.ageDuration)
+	if err == nil && o.maxAge <= 0 {
+		err = ErrBadAge
+	}
+
+	o.ageLabel = o.ageDuration
+
+	return err
+}
+
+// setMaxAgeFromEnv sets maxAge and ageLabel from the given value of the
+// ageEnvVar environment variable, which can be a whole number of years like -a,
+// or a duration like -d.
+func (o *cliOptions) setMaxAgeFromEnv(env string) error {
+	if _, err := strconv.Atoi(env); err == nil {
+		env += "y"
+	}
+
+	maxAge, err := ParseAge(env)
+	if err == nil && maxAge <= 0 {
+		err = ErrBadAge
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", ageEnvVar, err)
 	}
 
-	if bomGidsFile == "" {
-		exitHelp("ERROR: you must provide the path to bom.gids file")
+	o.maxAge = maxAge
+	o.ageLabel = env
+
+	return nil
+}
+
+func (o *cliOptions) validate() error {
+	if o.bomGidsFile == "" {
+		return ErrNoBoMGIDsFile
+	}
+
+	if o.age <= 0 || int64(o.age) > math.MaxInt64/int64(year) {
+		return ErrBadAge
+	}
+
+	if o.quiet && o.verbose {
+		return ErrQuietAndVerbose
+	}
+
+	if countTrue(o.smallest, o.byAge, o.byCold, o.inodes) > 1 {
+		return ErrSortOrders
+	}
+
+	if o.minCold < 0 || o.minCold > 1 || o.splitCold < 0 || o.splitCold > 1 {
+		return ErrBadColdFraction
+	}
+
+	if o.parallel < 0 {
+		return ErrBadParallel
+	}
+
+	if o.check && (o.directOnly || o.minCold > 0) {
+		return ErrCheckFiltered
 	}
 
-	if age <= 0 {
-		exitHelp("ERROR: -a must be greater than 0")
+	return nil
+}
+
+// wantsCold returns true if any of the options that need the fraction of each
+// directory that is old were supplied.
+func (o *cliOptions) wantsCold() bool {
+	return o.cold || o.minCold > 0 || o.byCold || o.splitCold > 0
+}
+
+// countTrue returns the number of the given bools that are true.
+func countTrue(bools ...bool) int {
+	n := 0
+
+	for _, b := range bools {
+		if b {
+			n++
+		}
 	}
 
-	gtb := parseBoMGIDsFile(bomGidsFile)
-	stats := parseStdin(gtb, age)
-	printStats(prefix, stats)
+	return n
 }
 
 // exitHelp prints help text and exits 0, unless a message is passed in which
@@ -107,7 +761,45 @@ func exitHelp(msg string) {
 	os.Exit(0)
 }
 
-func parseBoMGIDsFile(path string) *GIDToBoM {
+func logLevelFromFlags(quiet, verbose bool) logLevel {
+	switch {
+	case quiet:
+		return logQuiet
+	case verbose:
+		return logVerbose
+	default:
+		return logNormal
+	}
+}
+
+// dumpMapping writes the given GIDToBoM's mapping to the given file.
+func dumpMapping(gtb *GIDToBoM, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		die(err)
+	}
+
+	err = gtb.WriteMapping(f)
+	if errc := f.Close(); err == nil {
+		err = errc
+	}
+
+	if err != nil {
+		die(err)
+	}
+}
+
+func (o *cliOptions) gidToBoMOptions() []GIDToBoMOption {
+	opts := []GIDToBoMOption{RequireBoMs()}
+
+	if o.foldCase {
+		opts = append(opts, WithCaseFolding())
+	}
+
+	return opts
+}
+
+func parseBoMGIDsFile(path string, opts ...GIDToBoMOption) *GIDToBoM {
 	bomGIDsFile, err := os.Open(path)
 	if err != nil {
 		die(err)
@@ -115,33 +807,647 @@ func parseBoMGIDsFile(path string) *GIDToBoM {
 
 	defer bomGIDsFile.Close()
 
-	gtb, err := NewGIDToBoM(bomGIDsFile)
+	validateBoMGIDsFile(bomGIDsFile)
+
+	gtb, err := NewGIDToBoM(bomGIDsFile, opts...)
 	if err != nil {
-		die(err)
+		die(fmt.Errorf("%s: %w", path, err))
 	}
 
 	return gtb
 }
 
-func parseStdin(gtb *GIDToBoM, age int) []*Stats {
-	p := NewStatsParser(os.Stdin)
+// validateBoMGIDsFile logs all the problems with the given bom.gids file and
+// exits if there are any, otherwise seeks back to the start of the file.
+func validateBoMGIDsFile(f *os.File) {
+	errs := ValidateBomGIDs(f)
+	for _, err := range errs {
+		l.Errorf("%s: %s", f.Name(), err)
+	}
+
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		die(err)
+	}
+}
+
+func (o *cliOptions) statsOptions() []StatsOption {
+	var opts []StatsOption
+
+	if o.spill > 0 {
+		opts = append(opts, WithSpillThreshold(o.spill, ""))
+	}
+
+	if o.root != "" {
+		opts = append(opts, WithRoot(o.root))
+	}
+
+	if o.pathKey != nil {
+		opts = append(opts, WithPathKey(o.pathKey))
+	}
+
+	if o.projRoots != nil {
+		opts = append(opts, WithProjectRoots(o.projRoots))
+	}
+
+	if o.directOnly {
+		opts = append(opts, WithDirectFilesOnly())
+	}
+
+	if o.bomsBySize {
+		opts = append(opts, WithLargestBoMsFirst())
+	}
+
+	if o.smallest {
+		opts = append(opts, WithSortOrder(SmallestFirst))
+	}
+
+	if o.byAge {
+		opts = append(opts, WithSortOrder(OldestFirst))
+	}
+
+	if o.inodes {
+		opts = append(opts, WithSortOrder(MostFilesFirst))
+	}
+
+	if o.byCold {
+		opts = append(opts, WithSortOrder(ColdestFirst))
+	}
+
+	if o.wantsCold() {
+		opts = append(opts, WithMinColdFraction(o.minCold))
+	}
+
+	return opts
+}
+
+// newStdinParser returns a StatsParser of the stats data piped in to stdin,
+// configured according to the given cliOptions, along with a function to call
+// when you've finished parsing.
+func newStdinParser(cliOpts *cliOptions) (*StatsParser, func()) {
+	var (
+		stdin io.Reader = os.Stdin
+		done            = func() {}
+	)
+
+	if cliOpts.progress {
+		pr := NewProgressReader(os.Stdin, InputSize(os.Stdin))
+		done = pr.Report(os.Stderr, progressInterval)
+		stdin = pr
+	}
+
+	r, err := DecompressIfGzipped(stdin)
+	if err != nil {
+		die(err)
+	}
+
+	return newConfiguredParser(r, cliOpts), done
+}
+
+// newFilesParser returns a StatsParser of the stats data in the given files
+// (each of which may be gzip compressed), read one after the other, configured
+// according to the given cliOptions, along with a function to call when you've
+// finished parsing, which closes the files.
+func newFilesParser(paths []string, cliOpts *cliOptions) (*StatsParser, func()) {
+	readers := make([]io.Reader, len(paths))
+	files := make([]*os.File, len(paths))
+
+	done := func() {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}
+
+	for i, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			done()
+			die(err)
+		}
+
+		files[i] = f
+
+		readers[i], err = DecompressIfGzipped(f)
+		if err != nil {
+			done()
+			die(fmt.Errorf("%s: %w", path, err))
+		}
+	}
+
+	return newConfiguredParser(io.MultiReader(readers...), cliOpts), done
+}
+
+// newConfiguredParser returns a StatsParser of the given stats data configured
+// according to the given cliOptions.
+func newConfiguredParser(r io.Reader, cliOpts *cliOptions) *StatsParser {
+	p := NewStatsParser(r)
+	p.SetAgeMetric(cliOpts.ageMetric)
+	p.SetPathEncoding(cliOpts.pathEnc)
+
+	if cliOpts.foldPaths {
+		p.FoldPathCase()
+	}
+
+	if cliOpts.normalise {
+		p.NormalisePaths()
+	}
+
+	if !cliOpts.now.IsZero() {
+		p.SetNow(cliOpts.now)
+	}
+
+	p.CapDepth(cliOpts.depthCap)
+	p.MaxPathSegments(cliOpts.maxSegments)
+
+	if len(cliOpts.excludeGIDs) > 0 {
+		p.FilterOutGIDRanges(cliOpts.excludeGIDs)
+	}
+
+	return p
+}
+
+// newInputParser returns a StatsParser of the stats files given on the command
+// line, or else stdin, along with a function to call when you've finished
+// parsing.
+func newInputParser(cliOpts *cliOptions) (*StatsParser, func()) {
+	if len(cliOpts.files) == 0 {
+		return newStdinParser(cliOpts)
+	}
+
+	return newFilesParser(cliOpts.files, cliOpts)
+}
+
+// parseInput parses the stats files given on the command line, or else stdin,
+// and returns the resulting stats. Files are parsed in parallel if possible.
+func parseInput(gtb *GIDToBoM, cliOpts *cliOptions, opts ...StatsOption) []*Stats {
+	if workers := cliOpts.workers(); workers > 1 {
+		if cliOpts.canParseInParallel(opts) {
+			return parseFilesInParallel(gtb, cliOpts, workers)
+		}
+
+		cliOpts.warnSerialParsing(workers)
+	}
+
+	p, done := newInputParser(cliOpts)
+	defer done()
+
+	return parseStats(p, gtb, cliOpts, opts...)
+}
+
+// canParseInParallel returns true if parseFilesInParallel() supports our
+// options. It doesn't support any StatsOptions, nor writing a -future report.
+func (o *cliOptions) canParseInParallel(opts []StatsOption) bool {
+	return len(opts) == 0 && o.futureFile == ""
+}
+
+// warnSerialParsing says that our files will be parsed one after the other,
+// even though the given number of workers could have been used. It's only a
+// warning if parallel parsing was explicitly asked for with -parallel.
+func (o *cliOptions) warnSerialParsing(workers int) {
+	const msg = "the options used do not support parallel parsing; parsing %d stats files serially instead of with %d workers"
+
+	if o.parallel > 1 {
+		l.Warnf(msg, len(o.files), workers)
+
+		return
+	}
+
+	l.Verbosef(msg, len(o.files), workers)
+}
+
+// workers returns the number of workers that should parse our files: -parallel
+// if set, otherwise the number of CPUs, but no more than the number of files.
+func (o *cliOptions) workers() int {
+	workers := o.parallel
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+
+	return min(workers, len(o.files))
+}
+
+// parseFilesInParallel splits the stats files given on the command line between
+// the given number of workers, and parses them with
+// BoMDirectoryStatsParallel().
+func parseFilesInParallel(gtb *GIDToBoM, cliOpts *cliOptions, workers int) []*Stats {
+	sps := make([]*StatsParser, workers)
+
+	for i := range sps {
+		var paths []string
+
+		for j := i; j < len(cliOpts.files); j += workers {
+			paths = append(paths, cliOpts.files[j])
+		}
+
+		p, done := newFilesParser(paths, cliOpts)
+		defer done()
+
+		p.CountFutureFiles(nil)
 
-	stats, err := BoMDirectoryStats(p, gtb, time.Duration(age*daysPerYear*hoursInDay)*time.Hour)
+		sps[i] = p
+	}
+
+	l.Verbosef("parsing %d stats files with %d workers", len(cliOpts.files), workers)
+
+	start := time.Now()
+
+	stats, err := BoMDirectoryStatsParallel(sps, gtb, cliOpts.maxAge, workers)
 	if err != nil {
 		die(err)
 	}
 
+	var parsed, future, tooDeep uint64
+
+	for _, p := range sps {
+		parsed += p.EntriesParsed()
+		future += p.FutureFiles()
+		tooDeep += p.TooDeep()
+	}
+
+	if parsed == 0 {
+		if !cliOpts.allowEmpty {
+			die(ErrNoData)
+		}
+
+		l.Warnf("%s", ErrNoData)
+	}
+
+	l.Verbosef("parsed stats in %s, giving %d directories", time.Since(start), len(stats))
+
+	warnFutureFiles(future)
+	warnTooDeep(tooDeep, cliOpts.maxSegments)
+
+	return stats
+}
+
+// parseStats parses the given StatsParser's data and returns the resulting
+// stats.
+func parseStats(p *StatsParser, gtb *GIDToBoM, cliOpts *cliOptions, opts ...StatsOption) []*Stats {
+	closeFutureReport := countFutureFiles(p, cliOpts.futureFile)
+	defer closeFutureReport()
+
+	l.Verbosef("parsing stats")
+
+	start := time.Now()
+
+	stats, counts, err := BoMDirectoryStatsWithCounts(p, gtb, cliOpts.maxAge, opts...)
+	if errors.Is(err, ErrNoData) && cliOpts.allowEmpty {
+		l.Warnf("%s", err)
+	} else if err != nil {
+		die(err)
+	}
+
+	l.Verbosef("parsed stats in %s, giving %d directories in %d BoMs",
+		time.Since(start), len(stats), len(counts))
+
+	for bom, count := range counts {
+		l.Verbosef("BoM %s has %d directories", bom, count)
+	}
+
+	warnFutureFiles(p.FutureFiles())
+	warnTooDeep(p.TooDeep(), cliOpts.maxSegments)
+
 	return stats
 }
 
-func printStats(prefix string, stats []*Stats) {
-	err := PrintBoMDirectoryStats(prefix, stats)
+// warnFutureFiles warns about the given number of files with times in the
+// future, if there were any.
+func warnFutureFiles(n uint64) {
+	if n > 0 {
+		l.Warnf("%d files have an mtime or ctime in the future", n)
+	}
+}
+
+// warnTooDeep warns about the given number of entries skipped for having more
+// than the given -max-segments, if there were any.
+func warnTooDeep(n uint64, maxSegments int) {
+	if n > 0 {
+		l.Warnf("skipped %d paths with more than %d segments", n, maxSegments)
+	}
+}
+
+// countFutureFiles makes the given StatsParser count files with times in the
+// future, writing their paths to the given file if it isn't blank. Returns a
+// function that closes that file.
+func countFutureFiles(p *StatsParser, path string) func() {
+	if path == "" {
+		p.CountFutureFiles(nil)
+
+		return func() {}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		die(err)
+	}
+
+	w := bufio.NewWriter(f)
+	p.CountFutureFiles(w)
+
+	return func() {
+		if err := w.Flush(); err != nil {
+			die(err)
+		}
+
+		if err := f.Close(); err != nil {
+			die(err)
+		}
+	}
+}
+
+// printDeepestPaths writes the deepest file paths of each BoM in the stats files
+// given on the command line, or else the stats data piped in to stdin.
+func printDeepestPaths(gtb *GIDToBoM, cliOpts *cliOptions) {
+	p, done := newInputParser(cliOpts)
+
+	paths, err := DeepestPaths(p, gtb, cliOpts.maxAge, cliOpts.deepest)
+	done()
+
+	if err != nil {
+		die(err)
+	}
+
+	if err = PrintDeepestPaths(cliOpts.prefix, paths, WithCreateRetries(createRetries, createBackoff)); err != nil {
+		die(err)
+	}
+}
+
+// sizeUnit returns the unit our output sizes are in.
+func (o *cliOptions) sizeUnit() SizeUnit {
+	if o.gb {
+		return GB
+	}
+
+	return GiB
+}
+
+func (o *cliOptions) printOptions(gtb *GIDToBoM) []PrintOption {
+	opts := []PrintOption{WithCreateRetries(createRetries, createBackoff)}
+
+	if o.bomColumn {
+		opts = append(opts, WithBoMColumn())
+	}
+
+	if o.noRoot {
+		opts = append(opts, WithoutRoot())
+	}
+
+	unit := o.sizeUnit()
+
+	if o.gb {
+		opts = append(opts, WithSizeUnit(unit))
+	}
+
+	if o.minBoMSize > 0 {
+		opts = append(opts, WithMinBoMSize(int64(o.minBoMSize*float64(unit.divisor()))))
+	}
+
+	if o.minBoMCount > 0 {
+		opts = append(opts, WithMinBoMCount(o.minBoMCount))
+	}
+
+	if o.rounding != RoundNearest {
+		opts = append(opts, WithRounding(o.rounding))
+	}
+
+	if o.index {
+		opts = append(opts, WithIndex(gtb))
+	}
+
+	if o.clean {
+		opts = append(opts, WithStaleFileRemoval())
+	}
+
+	if o.allBoMs {
+		opts = append(opts, WithEmptyBoMFiles(gtb.BoMs()))
+	}
+
+	if !o.legacy {
+		opts = append(opts, WithBytesColumn())
+	}
+
+	if o.maxRows > 0 {
+		opts = append(opts, WithMaxRowsPerFile(o.maxRows))
+	}
+
+	if o.own {
+		opts = append(opts, WithOwnColumns())
+	}
+
+	if o.hardlinks {
+		opts = append(opts, WithHardlinkColumn())
+	}
+
+	if o.wantsCold() {
+		opts = append(opts, WithColdFractionColumn())
+	}
+
+	if o.splitCold > 0 {
+		opts = append(opts, WithColdSplit(o.splitCold))
+	}
+
+	if o.tree {
+		opts = append(opts, WithTreeLayout())
+	}
+
+	if o.splitTop {
+		opts = append(opts, WithTopDirSplit())
+	}
+
+	if o.metadata {
+		opts = append(opts, WithMetadataComment(o.ageLabel, time.Now()))
+	}
+
+	return opts
+}
+
+func printStats(prefix string, stats []*Stats, opts ...PrintOption) {
+	start := time.Now()
+
+	err := PrintBoMDirectoryStats(prefix, stats, opts...)
+	if err != nil {
+		die(err)
+	}
+
+	l.Verbosef("wrote output files in %s", time.Since(start))
+}
+
+// statsTSVParser is a function like ParseStatsTSV().
+type statsTSVParser func(r io.Reader, bom string) ([]*Stats, error)
+
+// newStatsTSVParser returns ParseStatsTSV(), unless legacy is true, in which case
+// it returns a parser that also accepts files without a header row, taking their
+// sizes to be in the given unit.
+func newStatsTSVParser(legacy bool, unit SizeUnit) statsTSVParser {
+	if !legacy {
+		return ParseStatsTSV
+	}
+
+	return func(r io.Reader, bom string) ([]*Stats, error) {
+		return ParseStatsTSVWithUnit(r, bom, unit)
+	}
+}
+
+// readSinceFile returns the BoM of the given previous output file, and its
+// Stats parsed with the given parser. This must be done before we write any
+// output files, since they may replace or remove the previous one.
+func readSinceFile(sinceFile string, parse statsTSVParser) (string, []*Stats) {
+	bom, partial, err := bomFromOutputFile(sinceFile)
+	if err != nil {
+		die(err)
+	}
+
+	if partial {
+		die(fmt.Errorf("%s: %w", sinceFile, ErrPartialOutput))
+	}
+
+	f, err := os.Open(sinceFile)
+	if err != nil {
+		die(err)
+	}
+
+	defer f.Close()
+
+	before, err := parse(f, bom)
+	if err != nil {
+		die(fmt.Errorf("%s: %w", sinceFile, err))
+	}
+
+	return bom, before
+}
+
+// printDeltas writes the changes between the given previous Stats of the given
+// BoM and the stats for the same BoM.
+func printDeltas(prefix, bom string, before, stats []*Stats, opts ...PrintOption) {
+	var after []*Stats
+
+	for _, s := range stats {
+		if string(s.BoM) == bom {
+			after = append(after, s)
+		}
+	}
+
+	if err := PrintStatsDeltas(prefix, DiffStats(before, after), opts...); err != nil {
+		die(err)
+	}
+}
+
+// mergeOutputs implements the merge subcommand, combining the given output files
+// in to one output file per BoM, named with the -o prefix.
+func mergeOutputs(args []string) {
+	fs := flag.NewFlagSet(mergeCommand, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	prefix := fs.String("o", "output", "prefix path to output files")
+	legacy := fs.Bool("legacy", false, "the files to merge have no header row, as written with -legacy")
+	gb := fs.Bool("gb", false, "sizes are in decimal GB (1000^3 bytes) instead of GiB")
+
+	if err := fs.Parse(args); err != nil {
+		exitHelp("ERROR: " + err.Error())
+	}
+
+	if fs.NArg() == 0 {
+		exitHelp("ERROR: " + ErrNoMergeFiles.Error())
+	}
+
+	unit := GiB
+	if *gb {
+		unit = GB
+	}
+
+	stats, err := mergeOutputFiles(fs.Args(), newStatsTSVParser(*legacy, unit))
 	if err != nil {
 		die(err)
 	}
+
+	if err = PrintBoMDirectoryStats(*prefix, stats, WithBytesColumn(), WithSizeUnit(unit)); err != nil {
+		die(err)
+	}
+}
+
+// mergeOutputFiles parses the given output files with the given parser, and
+// returns their merged Stats. The BoM of each file is taken from its name.
+func mergeOutputFiles(paths []string, parse statsTSVParser) ([]*Stats, error) {
+	sets := make([][]*Stats, 0, len(paths))
+
+	for _, path := range paths {
+		stats, err := parseOutputFile(path, parse)
+		if err != nil {
+			return nil, err
+		}
+
+		sets = append(sets, stats)
+	}
+
+	return MergeStats(sets...), nil
+}
+
+// parseOutputFile parses the given [prefix].[bom].tsv file back in to Stats with
+// the given parser.
+func parseOutputFile(path string, parse statsTSVParser) ([]*Stats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	bom, _, err := bomFromOutputFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := parse(f, bom)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return stats, nil
+}
+
+// partSuffix matches the suffix WithMaxRowsPerFile() adds to output file names.
+var partSuffix = regexp.MustCompile(`\.part[0-9]{4,}$`) //nolint:gochecknoglobals
+
+// bomFromOutputFile returns the BoM of the given output file, and whether the
+// file is only one of several that were written for that BoM.
+//
+// If there is an index.tsv in the same directory that lists the file, the BoM
+// is taken from that. Otherwise the name must be like [prefix].[bom].tsv,
+// optionally with a .cold or .recent and then a .partNNNN suffix before the
+// .tsv, where neither the prefix nor the BoM contains a dot; any other name is
+// rejected with ErrBadOutputName, since it can't be told apart from eg. a
+// WithTopDirSplit() file or a delta file. Such files need their index.
+func bomFromOutputFile(path string) (string, bool, error) {
+	bom, partial, found, err := bomFromIndex(filepath.Join(filepath.Dir(path), "index.tsv"), path)
+	if found || err != nil {
+		return bom, partial, err
+	}
+
+	name, isTSV := strings.CutSuffix(filepath.Base(path), ".tsv")
+	if !isTSV {
+		return "", false, fmt.Errorf("%s: %w", path, ErrBadOutputName)
+	}
+
+	trimmed := partSuffix.ReplaceAllString(name, "")
+
+	for _, suffix := range []string{".cold", ".recent"} {
+		trimmed = strings.TrimSuffix(trimmed, suffix)
+	}
+
+	prefix, bom, ok := strings.Cut(trimmed, ".")
+	if !ok || prefix == "" || bom == "" || strings.Contains(bom, ".") {
+		return "", false, fmt.Errorf("%s: %w", path, ErrBadOutputName)
+	}
+
+	return bom, trimmed != name, nil
 }
 
 func die(err error) {
-	l.Printf("ERROR: %s", err.Error())
+	l.Errorf("%s", err)
 	os.Exit(1)
 }
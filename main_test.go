@@ -24,16 +24,32 @@
 package main
 
 import (
+	"archive/tar"
 	"bufio"
+	"bytes"
 	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"os"
+	"os/user"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
 )
 
 const epochWhenTestFileWasCreated = 1715261665
@@ -59,6 +75,7 @@ func TestParseStats(t *testing.T) {
 				if i == 0 {
 					So(string(p.Path), ShouldEqual, "/lustre/scratch122/tol/teams/blaxter/users/am75/assemblies/dataset/ilXesSexs1.2_genomic.fna") //nolint:lll
 					So(p.Size, ShouldEqual, 646315412)
+					So(p.UID, ShouldEqual, 21967)
 					So(p.GID, ShouldEqual, 15078)
 					So(p.MTime, ShouldEqual, 1698792671)
 					So(p.CTime, ShouldEqual, 1698917473)
@@ -74,6 +91,35 @@ func TestParseStats(t *testing.T) {
 			So(p.Err(), ShouldBeNil)
 		})
 
+		Convey("you can collect independent Entry snapshots of each entry", func() {
+			var entries []Entry
+
+			for p.Scan() {
+				entries = append(entries, p.Entry())
+			}
+
+			So(p.Err(), ShouldBeNil)
+			So(len(entries), ShouldEqual, 18890)
+
+			So(entries[0], ShouldResemble, Entry{
+				Path:      []byte("/lustre/scratch122/tol/teams/blaxter/users/am75/assemblies/dataset/ilXesSexs1.2_genomic.fna"),
+				Size:      646315412,
+				UID:       21967,
+				GID:       15078,
+				ATime:     1699895920,
+				MTime:     1698792671,
+				CTime:     1698917473,
+				EntryType: fileType,
+				Inode:     144116446803265182,
+				Nlink:     1,
+			})
+			So(string(entries[1].Path), ShouldEqual, "/lustre/scratch122/tol/teams/blaxter/users/am75/assemblies/dataset/ilOpeBrum1.1_genomic.fna.fai") //nolint:lll
+			So(entries[1].Size, ShouldEqual, 1529)
+
+			So(&entries[0].Path[0] == &entries[1].Path[0], ShouldBeFalse)
+			So(&entries[0].Path[0] == &p.pathBuffer[0], ShouldBeFalse)
+		})
+
 		Convey("you can extract info for files older than the specified age", func() {
 			p.FilterForFilesOlderThan(yearsRelativeToTestFileCreation(7))
 
@@ -98,6 +144,156 @@ func TestParseStats(t *testing.T) {
 			So(p.Err(), ShouldBeNil)
 		})
 
+		Convey("you can extract info for files of an exact size", func() {
+			p.FilterForExactSize(0)
+
+			i := 0
+			for p.Scan() {
+				So(p.Size, ShouldEqual, 0)
+				So(p.EntryType, ShouldEqual, fileType)
+
+				i++
+			}
+			So(i, ShouldEqual, 140)
+
+			So(p.Err(), ShouldBeNil)
+		})
+
+		Convey("you can extract info for files of a specific nonzero size", func() {
+			p.FilterForExactSize(2020)
+
+			i := 0
+			for p.Scan() {
+				So(p.Size, ShouldEqual, 2020)
+
+				i++
+			}
+			So(i, ShouldEqual, 147)
+		})
+
+		Convey("filters combine so entries must pass all of them", func() {
+			p.FilterForExactSize(3192)
+			p.FilterForFilesOlderThan(yearsRelativeToTestFileCreation(7))
+
+			i := 0
+			for p.Scan() {
+				So(string(p.Path), ShouldEqual, "/lustre/scratch122/tol/teams/blaxter/users/cc51/software/samtools-1.9/htslib-1.9/hfile_net.c") //nolint:lll
+
+				i++
+			}
+			So(i, ShouldEqual, 1)
+		})
+
+		Convey("you can resume parsing from a recorded offset", func() {
+			data, errr := io.ReadAll(testStatsReader(t))
+			So(errr, ShouldBeNil)
+
+			p = NewStatsParser(bytes.NewReader(data))
+			So(p.Offset(), ShouldEqual, 0)
+
+			var first []Entry
+			for len(first) < 9445 && p.Scan() {
+				first = append(first, p.Entry())
+			}
+
+			offset := p.Offset()
+			So(offset, ShouldBeGreaterThan, 0)
+			So(data[offset-1], ShouldEqual, '\n')
+
+			p, errr = NewStatsParserAt(bytes.NewReader(data), offset)
+			So(errr, ShouldBeNil)
+
+			var rest []Entry
+			for p.Scan() {
+				rest = append(rest, p.Entry())
+			}
+
+			So(p.Err(), ShouldBeNil)
+			So(p.Offset(), ShouldEqual, len(data))
+			So(len(first)+len(rest), ShouldEqual, 18890)
+
+			p = NewStatsParser(bytes.NewReader(data))
+
+			var all []Entry
+			for p.Scan() {
+				all = append(all, p.Entry())
+			}
+
+			So(append(first, rest...), ShouldResemble, all)
+		})
+
+		Convey("you can get the raw bytes of the latest line", func() {
+			first := statsLine("/a/file1", 10, 808, 0, 0, 0)
+			second := statsLine("/a/file2", 20, 1736, 0, 0, 0)
+
+			p = NewStatsParser(strings.NewReader(first + second))
+			So(p.Line(), ShouldBeNil)
+
+			So(p.Scan(), ShouldBeTrue)
+			So(string(p.Line()), ShouldEqual, strings.TrimSuffix(first, "\n"))
+
+			So(p.Scan(), ShouldBeTrue)
+			So(string(p.Line()), ShouldEqual, strings.TrimSuffix(second, "\n"))
+
+			p = NewStatsParser(strings.NewReader(first + second))
+			p.FilterOutGIDs([]int{808})
+
+			So(p.Scan(), ShouldBeTrue)
+			So(p.GID, ShouldEqual, 1736)
+			So(string(p.Line()), ShouldEqual, strings.TrimSuffix(second, "\n"))
+		})
+
+		Convey("with no filters every entry is returned", func() {
+			n := 0
+			for p.Scan() {
+				n++
+			}
+
+			So(p.Err(), ShouldBeNil)
+			So(n, ShouldEqual, 18890)
+			So(p.EntriesParsed(), ShouldEqual, n)
+
+			p = NewStatsParser(testStatsReader(t))
+			p.FilterForFiles()
+
+			files := 0
+			for p.Scan() {
+				So(p.EntryType, ShouldEqual, fileType)
+				files++
+			}
+
+			So(files, ShouldBeLessThan, n)
+			So(p.EntriesParsed(), ShouldEqual, n)
+		})
+
+		Convey("you can limit the number of entries returned", func() {
+			p.Limit(5)
+
+			var entries []Entry
+			for p.Scan() {
+				entries = append(entries, p.Entry())
+			}
+
+			So(p.Err(), ShouldBeNil)
+			So(len(entries), ShouldEqual, 5)
+			So(entries[0].Size, ShouldEqual, 646315412)
+			So(entries[1].Size, ShouldEqual, 1529)
+
+			Convey("counting only entries that pass the filters", func() {
+				p = NewStatsParser(testStatsReader(t))
+				p.FilterForExactSize(2020)
+				p.Limit(5)
+
+				i := 0
+				for p.Scan() {
+					So(p.Size, ShouldEqual, 2020)
+
+					i++
+				}
+				So(i, ShouldEqual, 5)
+			})
+		})
+
 		Convey("the age filter gives different results with different ages", func() {
 			p.FilterForFilesOlderThan(yearsRelativeToTestFileCreation(6))
 
@@ -111,6 +307,252 @@ func TestParseStats(t *testing.T) {
 		})
 	})
 
+	Convey("Given files accessed recently but modified long ago", t, func() {
+		old := time.Now().Add(-10 * 365 * 24 * time.Hour).Unix()
+		recent := time.Now().Add(-24 * time.Hour).Unix()
+		data := statsLine("/a/accessed", 1, 1, recent, old, old) +
+			statsLine("/a/untouched", 2, 1, old, old, old) +
+			statsLine("/a/modified", 3, 1, old, recent, old)
+
+		Convey("they are old using the default OldestOfCM metric", func() {
+			p := NewStatsParser(strings.NewReader(data))
+			p.FilterForFilesOlderThan(5 * 365 * 24 * time.Hour)
+
+			var paths []string
+
+			for p.Scan() {
+				paths = append(paths, string(p.Path))
+			}
+
+			So(paths, ShouldResemble, []string{"/a/accessed", "/a/untouched", "/a/modified"})
+		})
+
+		Convey("they are excluded using the NewestOfAM metric", func() {
+			p := NewStatsParser(strings.NewReader(data))
+			p.SetAgeMetric(NewestOfAM)
+			p.FilterForFilesOlderThan(5 * 365 * 24 * time.Hour)
+
+			var paths []string
+
+			for p.Scan() {
+				paths = append(paths, string(p.Path))
+			}
+
+			So(paths, ShouldResemble, []string{"/a/untouched"})
+		})
+
+		Convey("separate mtime and ctime cutoffs must both be satisfied", func() {
+			twoYears := time.Now().Add(-2 * 365 * 24 * time.Hour).Unix()
+			data := statsLine("/b/both", 1, 1, recent, old, twoYears) +
+				statsLine("/b/recent_ctime", 2, 1, old, old, recent) +
+				statsLine("/b/recent_mtime", 3, 1, old, twoYears, old) +
+				statsLine("/b/neither", 4, 1, old, recent, recent)
+
+			p := NewStatsParser(strings.NewReader(data))
+			p.FilterForMTimeAndCTimeOlderThan(5*365*24*time.Hour, 365*24*time.Hour)
+			So(p.AgeFiltered(), ShouldBeTrue)
+
+			var paths []string
+
+			for p.Scan() {
+				paths = append(paths, string(p.Path))
+			}
+
+			So(paths, ShouldResemble, []string{"/b/both"})
+
+			p = NewStatsParser(strings.NewReader(data))
+			p.FilterForMTimeAndCTimeOlderThan(5*365*24*time.Hour, 365*24*time.Hour)
+			p.SetNow(time.Now().Add(-18 * 30 * 24 * time.Hour))
+
+			paths = nil
+
+			for p.Scan() {
+				paths = append(paths, string(p.Path))
+			}
+
+			So(paths, ShouldBeEmpty)
+		})
+
+		Convey("metrics can be parsed from their names", func() {
+			m, err := ParseAgeMetric("newest-am")
+			So(err, ShouldBeNil)
+			So(m, ShouldEqual, NewestOfAM)
+
+			m, err = ParseAgeMetric("oldest-cm")
+			So(err, ShouldBeNil)
+			So(m, ShouldEqual, OldestOfCM)
+
+			_, err = ParseAgeMetric("foo")
+			So(err, ShouldEqual, ErrBadAgeMetric)
+		})
+	})
+
+	Convey("Given a small number of entries", t, func() {
+		now := time.Now().Unix()
+
+		var data string
+		for i := int64(1); i <= 8; i++ {
+			mtime := now * (i % 2)
+			data += statsLine(fmt.Sprintf("/a/%d", i), i, 1, mtime, mtime, mtime)
+		}
+
+		p := NewStatsParser(strings.NewReader(data))
+
+		sizes := func() []int64 {
+			var sizes []int64
+			for p.Scan() {
+				sizes = append(sizes, p.Size)
+			}
+
+			So(p.Err(), ShouldBeNil)
+
+			return sizes
+		}
+
+		Convey("you can sample every nth entry", func() {
+			p.Sample(3)
+			So(sizes(), ShouldResemble, []int64{3, 6})
+		})
+
+		Convey("sampling applies to the entries that pass the filters", func() {
+			p.Sample(3)
+			p.FilterForFilesOlderThan(time.Hour)
+			So(sizes(), ShouldResemble, []int64{6})
+		})
+
+		Convey("sampling every 1 entry returns them all", func() {
+			p.Sample(1)
+			So(len(sizes()), ShouldEqual, 8)
+		})
+	})
+
+	Convey("Given a StatsParser of re-readable data, you can Clone it", t, func() {
+		data, err := io.ReadAll(testStatsReader(t))
+		So(err, ShouldBeNil)
+
+		p := NewStatsParser(bytes.NewReader(data))
+		p.SetNow(time.Unix(epochWhenTestFileWasCreated, 0))
+		p.FilterForFiles()
+
+		old, err := p.Clone()
+		So(err, ShouldBeNil)
+		So(old.now, ShouldEqual, epochWhenTestFileWasCreated)
+		old.FilterForFilesOlderThan(7 * year)
+
+		recent, err := p.Clone()
+		So(err, ShouldBeNil)
+		recent.FilterForFilesOlderThan(time.Nanosecond)
+
+		var numOld, numRecent, numAll int
+
+		for old.Scan() {
+			numOld++
+
+			if recent.Scan() {
+				numRecent++
+			}
+		}
+
+		for recent.Scan() {
+			numRecent++
+		}
+
+		for p.Scan() {
+			numAll++
+		}
+
+		So(old.Err(), ShouldBeNil)
+		So(recent.Err(), ShouldBeNil)
+		So(numOld, ShouldBeGreaterThan, 0)
+		So(numOld, ShouldBeLessThan, numRecent)
+		So(numRecent, ShouldEqual, numAll)
+		So(old.EntriesParsed(), ShouldEqual, 18890)
+		So(recent.EntriesParsed(), ShouldEqual, 18890)
+
+		Convey("but not if it can't be re-read", func() {
+			_, err = NewStatsParser(testStatsReader(t)).Clone()
+			So(err, ShouldEqual, ErrNotReReadable)
+		})
+
+		Convey("starting from the offset it was created at", func() {
+			p, err = NewStatsParserAt(bytes.NewReader(data), int64(bytes.IndexByte(data, '\n')+1))
+			So(err, ShouldBeNil)
+
+			clone, errc := p.Clone()
+			So(errc, ShouldBeNil)
+
+			for clone.Scan() {
+			}
+
+			So(clone.EntriesParsed(), ShouldEqual, 18889)
+			So(clone.Offset(), ShouldEqual, len(data))
+		})
+	})
+
+	Convey("Entry.IsOlderThan respects the AgeMetric", t, func() {
+		entry := Entry{ATime: 300, MTime: 200, CTime: 100}
+
+		Convey("by default using the oldest of c and mtime", func() {
+			So(entry.IsOlderThan(time.Unix(150, 0)), ShouldBeTrue)
+			So(entry.IsOlderThan(time.Unix(100, 0)), ShouldBeTrue)
+			So(entry.IsOlderThan(time.Unix(50, 0)), ShouldBeFalse)
+		})
+
+		Convey("or the newest of a and mtime", func() {
+			entry.AgeMetric = NewestOfAM
+			So(entry.IsOlderThan(time.Unix(350, 0)), ShouldBeTrue)
+			So(entry.IsOlderThan(time.Unix(300, 0)), ShouldBeTrue)
+			So(entry.IsOlderThan(time.Unix(250, 0)), ShouldBeFalse)
+		})
+
+		Convey("with the metric of the StatsParser the Entry came from", func() {
+			p := NewStatsParser(strings.NewReader(statsLine("/a/file", 1, 808, 300, 200, 100)))
+			p.SetAgeMetric(NewestOfAM)
+			So(p.Scan(), ShouldBeTrue)
+
+			parsed := p.Entry()
+			So(parsed.AgeMetric, ShouldEqual, NewestOfAM)
+			So(parsed.IsOlderThan(time.Unix(250, 0)), ShouldBeFalse)
+			So(parsed.IsOlderThan(time.Unix(300, 0)), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given stats data with files modified in the future", t, func() {
+		future := time.Now().Add(year).Unix()
+		data := statsLine("/a/old", 1, 808, 0, 0, 0) +
+			statsLine("/a/future-mtime", 2, 808, 0, future, 0) +
+			statsLine("/a/future-ctime", 3, 808, 0, 0, future) +
+			statsLine("/a/future", 4, 808, 0, future, future) +
+			strings.ReplaceAll(statsLine("/a/future-dir", 4, 808, 0, future, future), "\tf\t", "\td\t")
+
+		p := NewStatsParser(strings.NewReader(data))
+		p.FilterForFilesOlderThan(time.Hour)
+
+		Convey("you can count them and report their paths, regardless of filters", func() {
+			var report bytes.Buffer
+
+			p.CountFutureFiles(&report)
+
+			var paths []string
+			for p.Scan() {
+				paths = append(paths, string(p.Path))
+			}
+
+			So(p.Err(), ShouldBeNil)
+			So(paths, ShouldResemble, []string{"/a/old", "/a/future-mtime", "/a/future-ctime"})
+			So(p.FutureFiles(), ShouldEqual, 3)
+			So(report.String(), ShouldEqual, "/a/future-mtime\n/a/future-ctime\n/a/future\n")
+		})
+
+		Convey("they are not counted by default", func() {
+			for p.Scan() {
+			}
+
+			So(p.Err(), ShouldBeNil)
+			So(p.FutureFiles(), ShouldEqual, 0)
+		})
+	})
+
 	Convey("Scan generates Err() when", t, func() {
 		Convey("first column is not base64 encoded", func() {
 			p := NewStatsParser(strings.NewReader("this is invalid since it has spaces\t1\t1\t1\t1\t1\t1\tf\t1\t1\td\n"))
@@ -118,12 +560,66 @@ func TestParseStats(t *testing.T) {
 			So(p.Err(), ShouldEqual, ErrBadPath)
 		})
 
+		Convey("the path is unpadded base64, unless a lenient path encoding is set", func() {
+			unpadded := base64.RawStdEncoding.EncodeToString([]byte("/a/file")) + "\t1\t1\t1\t1\t1\t1\tf\t1\t1\td\n"
+			padded := base64.StdEncoding.EncodeToString([]byte("/a/b")) + "\t1\t1\t1\t1\t1\t1\tf\t1\t1\td\n"
+
+			p := NewStatsParser(strings.NewReader(unpadded))
+			So(p.Scan(), ShouldBeFalse)
+			So(p.Err(), ShouldEqual, ErrBadPath)
+
+			p = NewStatsParser(strings.NewReader(unpadded))
+			p.SetPathEncoding(UnpaddedBase64)
+			So(p.Scan(), ShouldBeTrue)
+			So(string(p.Path), ShouldEqual, "/a/file")
+
+			p = NewStatsParser(strings.NewReader(padded + unpadded))
+			p.SetPathEncoding(AnyPaddingBase64)
+			So(p.Scan(), ShouldBeTrue)
+			So(string(p.Path), ShouldEqual, "/a/b")
+			So(p.Scan(), ShouldBeTrue)
+			So(string(p.Path), ShouldEqual, "/a/file")
+			So(p.Scan(), ShouldBeFalse)
+			So(p.Err(), ShouldBeNil)
+
+			enc, err := ParsePathEncoding("any")
+			So(err, ShouldBeNil)
+			So(enc, ShouldEqual, AnyPaddingBase64)
+
+			_, err = ParsePathEncoding("loose")
+			So(err, ShouldEqual, ErrBadPathEncoding)
+		})
+
+		Convey("the encoded path is longer than the maximum", func() {
+			longPath := "/" + strings.Repeat("a", base64.StdEncoding.DecodedLen(maxBase64EncodedPathLength))
+			encodedPath := base64.StdEncoding.EncodeToString([]byte(longPath))
+			So(len(encodedPath), ShouldBeGreaterThan, maxBase64EncodedPathLength)
+
+			p := NewStatsParser(strings.NewReader(encodedPath + "\t1\t1\t1\t1\t1\t1\tf\t1\t1\td\n"))
+			So(p.Scan(), ShouldBeFalse)
+			So(p.Err(), ShouldEqual, ErrPathTooLong)
+
+			maxPath := strings.Repeat("a", base64.StdEncoding.DecodedLen(maxBase64EncodedPathLength))
+			encodedPath = base64.StdEncoding.EncodeToString([]byte(maxPath))
+			So(len(encodedPath), ShouldEqual, maxBase64EncodedPathLength)
+
+			p = NewStatsParser(strings.NewReader(encodedPath + "\t1\t1\t1\t1\t1\t1\tf\t1\t1\td\n"))
+			So(p.Scan(), ShouldBeTrue)
+			So(string(p.Path), ShouldEqual, maxPath)
+		})
+
 		Convey("there are not enough tab separated columns", func() {
 			encodedPath := "L2x1c3RyZS9zY3JhdGNoMTIyL3RvbC90ZWFtcy9ibGF4dGVyL3VzZXJzL2FtNzUvYXNzZW1ibGllcy9kYXRhc2V0L2lsWGVzU2V4czEuMl9nZW5vbWljLmZuYQ==" //nolint:lll
 
-			p := NewStatsParser(strings.NewReader(encodedPath + "\t1\t1\t1\t1\t1\t1\tf\t1\t1\td\n"))
+			p := NewStatsParser(strings.NewReader(encodedPath + "\t1\t1\t1\t1\t1\t1\tf\t1\t2\td\n"))
+			So(p.Scan(), ShouldBeTrue)
+			So(p.Err(), ShouldBeNil)
+			So(p.Nlink, ShouldEqual, 2)
+
+			p = NewStatsParser(strings.NewReader(encodedPath + "\t1\t1\t1\t1\t1\t1\tf\t"))
 			So(p.Scan(), ShouldBeTrue)
 			So(p.Err(), ShouldBeNil)
+			So(p.Nlink, ShouldEqual, 0)
 
 			p = NewStatsParser(strings.NewReader(encodedPath + "\t1\t1\t1\t1\t1\n"))
 			So(p.Scan(), ShouldBeFalse)
@@ -149,6 +645,70 @@ func TestParseStats(t *testing.T) {
 			So(p.Scan(), ShouldBeFalse)
 			So(p.Err(), ShouldEqual, ErrTooFewColumns)
 
+			Convey("or the input is truncated in the final line", func() {
+				p = NewStatsParser(strings.NewReader(encodedPath + "\t1\t1\t1\t1\t1\t1\tf\t1\t1\td\n" +
+					encodedPath + "\t1\t1"))
+				So(p.Scan(), ShouldBeTrue)
+				So(p.Scan(), ShouldBeFalse)
+				So(p.Err(), ShouldEqual, ErrTruncatedInput)
+
+				p = NewStatsParser(strings.NewReader(encodedPath[:10]))
+				So(p.Scan(), ShouldBeFalse)
+				So(p.Err(), ShouldEqual, ErrTruncatedInput)
+
+				p = NewStatsParser(strings.NewReader(encodedPath + "\t1\t1\t1\t1\t1\t1\tf\t1\t1\td"))
+				So(p.Scan(), ShouldBeTrue)
+				So(p.Scan(), ShouldBeFalse)
+				So(p.Err(), ShouldBeNil)
+			})
+
+			Convey("or a number column contains a non-digit", func() {
+				p = NewStatsParser(strings.NewReader(encodedPath + "\t1\t1\tx\t1\t1\t1\tf\t1\t1\td\n"))
+				So(p.Scan(), ShouldBeFalse)
+				So(p.Err(), ShouldEqual, ErrBadNumber)
+
+				p = NewStatsParser(strings.NewReader(encodedPath + "\t1\t1\t1\t1\t1\t1\tf\t-1\t1\td\n"))
+				So(p.Scan(), ShouldBeFalse)
+				So(p.Err(), ShouldEqual, ErrBadNumber)
+			})
+
+			Convey("or a number column is empty", func() {
+				p = NewStatsParser(strings.NewReader(encodedPath + "\t1\t1\t\t1\t1\t1\tf\t1\t1\td\n"))
+				So(p.Scan(), ShouldBeFalse)
+				So(p.Err(), ShouldEqual, ErrEmptyColumn)
+				So(p.GID, ShouldEqual, 0)
+
+				_, err := ParseLine([]byte(encodedPath + "\t1\t1\t\t1\t1\t1\tf\t"))
+				So(err, ShouldEqual, ErrEmptyColumn)
+			})
+
+			Convey("or a file's size column is empty, unless you set a size for that", func() {
+				emptyDirSize := encodedPath + "\t\t1\t1\t1\t1\t1\td\t1\t1\td\n"
+				emptyFileSize := encodedPath + "\t\t1\t1\t1\t1\t1\tf\t1\t1\td\n"
+
+				p = NewStatsParser(strings.NewReader(emptyDirSize + emptyFileSize))
+				So(p.Scan(), ShouldBeTrue)
+				So(p.EntryType, ShouldEqual, 'd')
+				So(p.Size, ShouldEqual, 0)
+				So(p.Scan(), ShouldBeFalse)
+				So(p.Err(), ShouldEqual, ErrEmptyFileSize)
+
+				p = NewStatsParser(strings.NewReader(emptyFileSize + emptyDirSize))
+				p.SetMissingFileSize(-1)
+				So(p.Scan(), ShouldBeTrue)
+				So(p.Size, ShouldEqual, -1)
+				So(p.Scan(), ShouldBeTrue)
+				So(p.Size, ShouldEqual, 0)
+				So(p.Scan(), ShouldBeFalse)
+				So(p.Err(), ShouldBeNil)
+			})
+
+			Convey("or the entry type column is empty", func() {
+				p = NewStatsParser(strings.NewReader(encodedPath + "\t1\t1\t1\t1\t1\t1\t\t1\t1\td\n"))
+				So(p.Scan(), ShouldBeFalse)
+				So(p.Err(), ShouldEqual, ErrTooFewColumns)
+			})
+
 			Convey("but not for blank lines", func() {
 				p = NewStatsParser(strings.NewReader("\n"))
 				So(p.Scan(), ShouldBeTrue)
@@ -185,9 +745,76 @@ func TestGIDToBoM(t *testing.T) {
 		})
 	})
 
-	Convey("Given invalid bomgids data, GIDToBoM fails to parse", t, func() {
-		_, err := NewGIDToBoM(strings.NewReader("bom\tgid\n"))
-		So(err, ShouldNotBeNil)
+	Convey("Given bomgids data with case-variant BoM names", t, func() {
+		data := "HumanGenetics\t1,2\nHumangenetics\t3\nCASM\t4\n"
+
+		Convey("they are distinct by default", func() {
+			p, err := NewGIDToBoM(strings.NewReader(data))
+			So(err, ShouldBeNil)
+
+			bom, err := p.GetBom(3)
+			So(err, ShouldBeNil)
+			So(string(bom), ShouldEqual, "Humangenetics")
+		})
+
+		Convey("they are merged when case folding, with a warning", func() {
+			logged := captureLogs()
+
+			p, err := NewGIDToBoM(strings.NewReader(data), WithCaseFolding())
+			So(err, ShouldBeNil)
+
+			for _, gid := range []int{1, 2, 3} {
+				bom, errg := p.GetBom(gid)
+				So(errg, ShouldBeNil)
+				So(string(bom), ShouldEqual, "HumanGenetics")
+			}
+
+			bom, err := p.GetBom(4)
+			So(err, ShouldBeNil)
+			So(string(bom), ShouldEqual, "CASM")
+
+			So(logged.String(), ShouldEqual, "WARNING: merging BoM Humangenetics in to HumanGenetics\n")
+		})
+	})
+
+	Convey("Given bomgids data with BoM names containing spaces", t, func() {
+		p, err := NewGIDToBoM(strings.NewReader("Human Genetics\t1736\nCASM\t808\n"))
+		So(err, ShouldBeNil)
+
+		bom, err := p.GetBom(1736)
+		So(err, ShouldBeNil)
+		So(string(bom), ShouldEqual, "HumanGenetics")
+		So(p.BoMName(bom), ShouldEqual, "Human Genetics")
+		So(p.BoMName([]byte("CASM")), ShouldEqual, "CASM")
+		So(p.BoMName([]byte("unknown")), ShouldEqual, "unknown")
+
+		Convey("you can write an index of the output file for each original BoM name", func() {
+			f, err := os.Open("test2.stats")
+			So(err, ShouldBeNil)
+
+			defer f.Close()
+
+			stats, err := BoMDirectoryStats(NewStatsParser(f), p, yearsRelativeToTestFileCreation(7))
+			So(err, ShouldBeNil)
+
+			tempDir := t.TempDir()
+			prefix := filepath.Join(tempDir, "output")
+
+			err = PrintBoMDirectoryStats(prefix, stats, WithIndex(p))
+			So(err, ShouldBeNil)
+
+			b, err := os.ReadFile(filepath.Join(tempDir, "index.tsv"))
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "Human Genetics\t"+prefix+".HumanGenetics.tsv\nCASM\t"+prefix+".CASM.tsv\n")
+
+			_, err = os.Stat(prefix + ".HumanGenetics.tsv")
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("Given invalid bomgids data, GIDToBoM fails to parse", t, func() {
+		_, err := NewGIDToBoM(strings.NewReader("bom\tgid\n"))
+		So(err, ShouldNotBeNil)
 
 		_, err = NewGIDToBoM(strings.NewReader("bom\t123\t456\n"))
 		So(err, ShouldNotBeNil)
@@ -198,6 +825,203 @@ func TestGIDToBoM(t *testing.T) {
 		p, err := NewGIDToBoM(strings.NewReader(""))
 		So(err, ShouldBeNil)
 		So(len(p.gidToBom), ShouldEqual, 0)
+
+		Convey("unless BoMs are required", func() {
+			_, err = NewGIDToBoM(strings.NewReader(""), RequireBoMs())
+			So(err, ShouldEqual, ErrNoBoMs)
+
+			_, err = NewGIDToBoM(strings.NewReader("bom\t123\n"), RequireBoMs())
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("Given bomgids data with GID ranges", t, func() {
+		Convey("a range includes every GID in it", func() {
+			p, err := NewGIDToBoM(strings.NewReader("bom1\t1000-1010\n"))
+			So(err, ShouldBeNil)
+			So(len(p.gidToBom), ShouldEqual, 0)
+			So(len(p.ranges), ShouldEqual, 1)
+
+			for _, gid := range []int{1000, 1005, 1010} {
+				bom, errg := p.GetBom(gid)
+				So(errg, ShouldBeNil)
+				So(string(bom), ShouldEqual, "bom1")
+			}
+
+			_, err = p.GetBom(1011)
+			So(err, ShouldEqual, ErrInvalidGID)
+		})
+
+		Convey("ranges and single GIDs can be mixed", func() {
+			gids, err := gidsCSVtoRanges([]byte("5,10-12,20,30-30"))
+			So(err, ShouldBeNil)
+			So(gids, ShouldResemble, []GIDRange{{5, 5}, {10, 12}, {20, 20}, {30, 30}})
+		})
+
+		Convey("huge ranges are not expanded", func() {
+			p, err := NewGIDToBoM(strings.NewReader("Small\t5\nBig\t1-200000000\nOther\t300000000\n"))
+			So(err, ShouldBeNil)
+			So(len(p.gidToBom), ShouldEqual, 1)
+
+			for gid, expected := range map[int]string{1: "Big", 5: "Big", 200000000: "Big", 300000000: "Other"} {
+				bom, errg := p.GetBom(gid)
+				So(errg, ShouldBeNil)
+				So(string(bom), ShouldEqual, expected)
+			}
+
+			_, err = p.GetBom(200000001)
+			So(err, ShouldEqual, ErrInvalidGID)
+
+			var buf strings.Builder
+
+			So(p.WriteMapping(&buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "1-200000000\tBig\n300000000\tOther\n")
+		})
+
+		Convey("later GIDs and ranges take precedence over earlier ones", func() {
+			p, err := NewGIDToBoM(strings.NewReader("A\t1-100\nB\t50\nC\t40-60\nD\t45\n"))
+			So(err, ShouldBeNil)
+
+			for gid, expected := range map[int]string{1: "A", 39: "A", 40: "C", 45: "D", 50: "C", 61: "A"} {
+				bom, errg := p.GetBom(gid)
+				So(errg, ShouldBeNil)
+				So(string(bom), ShouldEqual, expected)
+			}
+
+			So(p.Alias("C", "B"), ShouldBeNil)
+
+			bom, errg := p.GetBom(50)
+			So(errg, ShouldBeNil)
+			So(string(bom), ShouldEqual, "B")
+		})
+
+		Convey("inverted ranges are rejected", func() {
+			_, err := NewGIDToBoM(strings.NewReader("bom1\t1010-1000\n"))
+			So(errors.Is(err, ErrInvertedRange), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "1010-1000")
+
+			errs := ValidateBomGIDs(strings.NewReader("bom1\t1,1010-1000\n"))
+			So(len(errs), ShouldEqual, 1)
+			So(errs[0].Error(), ShouldStartWith, "line 1: ")
+
+			_, err = gidsCSVtoRanges([]byte("10-x"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a GIDToBoM with aliased BoMs", t, func() {
+		p, err := NewGIDToBoM(strings.NewReader("CASM\t808\nCancerGenetics\t809,810\nToL\t15295\n"))
+		So(err, ShouldBeNil)
+
+		err = p.Alias("CancerGenetics", "CASM")
+		So(err, ShouldBeNil)
+		So(p.BoMs(), ShouldResemble, []string{"CASM", "ToL"})
+
+		bom, err := p.GetBom(809)
+		So(err, ShouldBeNil)
+		So(string(bom), ShouldEqual, "CASM")
+
+		So(p.Alias("unknown", "CASM"), ShouldEqual, ErrUnknownBoM)
+		So(p.Alias("ToL", "unknown"), ShouldEqual, ErrUnknownBoM)
+
+		Convey("the dumped mapping shows the canonical BoM", func() {
+			var buf strings.Builder
+
+			So(p.WriteMapping(&buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "808\tCASM\n809\tCASM\n810\tCASM\n15295\tToL\n")
+
+			Convey("along with any default BoM", func() {
+				p.SetDefaultBoM("Other")
+
+				bom, err := p.GetBom(1)
+				So(err, ShouldBeNil)
+				So(string(bom), ShouldEqual, "Other")
+
+				buf.Reset()
+				So(p.WriteMapping(&buf), ShouldBeNil)
+				So(buf.String(), ShouldEndWith, "15295\tToL\n*\tOther\n")
+			})
+		})
+
+		Convey("-dump-mapping writes the mapping to a file", func() {
+			path := filepath.Join(t.TempDir(), "mapping.tsv")
+
+			dumpMapping(p, path)
+
+			b, err := os.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldStartWith, "808\tCASM\n809\tCASM\n")
+		})
+	})
+
+	Convey("ValidateBomGIDs reports every problem in bomgids data", t, func() {
+		errs := ValidateBomGIDs(strings.NewReader(
+			"bom1\t1,2\nbom2\tgid\nbom3\t3\t4\n \t5\nbom4\t6\n\n"))
+		So(len(errs), ShouldEqual, 4)
+		So(errs[0].Error(), ShouldStartWith, "line 2: ")
+		So(errors.Is(errs[0], strconv.ErrSyntax), ShouldBeTrue)
+		So(errs[1].Error(), ShouldEqual, "line 3: invalid bom.gids line: bom3\t3\t4")
+		So(errors.Is(errs[2], ErrEmptyBoM), ShouldBeTrue)
+		So(errs[2].Error(), ShouldStartWith, "line 4: ")
+		So(errs[3].Error(), ShouldStartWith, "line 6: ")
+
+		f, err := os.Open("bom.gids")
+		So(err, ShouldBeNil)
+
+		defer f.Close()
+
+		So(ValidateBomGIDs(f), ShouldBeNil)
+	})
+}
+
+func TestGenerateBoMGIDs(t *testing.T) {
+	Convey("Given a bom.areas file and group resolution", t, func() {
+		areasPath := filepath.Join(t.TempDir(), "bom.areas")
+		err := os.WriteFile(areasPath, []byte("tolgrp1,Tree of Life\ncasmgrp,CASM\ntolgrp2,Tree of Life\n"+
+			"gone,CASM\n"), 0600)
+		So(err, ShouldBeNil)
+
+		gids := map[string]int{"tolgrp1": 15295, "casmgrp": 808, "tolgrp2": 15346}
+		lookup := func(group string) (int, error) {
+			gid, ok := gids[group]
+			if !ok {
+				return 0, user.UnknownGroupError(group)
+			}
+
+			return gid, nil
+		}
+
+		Convey("you can generate bom.gids data from it", func() {
+			logs := captureLogs()
+
+			var buf bytes.Buffer
+
+			err = writeBoMGIDs(areasPath, &buf, lookup)
+			So(err, ShouldBeNil)
+			So(buf.String(), ShouldEqual, "CASM\t808\nTree of Life\t15295,15346\n")
+			So(logs.String(), ShouldContainSubstring, "skipping group gone of area CASM")
+
+			gtb, err := NewGIDToBoM(&buf)
+			So(err, ShouldBeNil)
+
+			bom, err := gtb.GetBom(15346)
+			So(err, ShouldBeNil)
+			So(gtb.BoMName(bom), ShouldEqual, "Tree of Life")
+		})
+
+		Convey("invalid bom.areas data is rejected", func() {
+			var buf bytes.Buffer
+
+			err = GenerateBoMGIDs(strings.NewReader("tolgrp1\n"), &buf, lookup)
+			So(err, ShouldNotBeNil)
+
+			err = GenerateBoMGIDs(strings.NewReader("tolgrp1,\n"), &buf, lookup)
+			So(err, ShouldEqual, ErrEmptyBoM)
+
+			err = writeBoMGIDs(filepath.Join(t.TempDir(), "missing"), &buf, lookup)
+			So(err, ShouldNotBeNil)
+			So(buf.Len(), ShouldEqual, 0)
+		})
 	})
 }
 
@@ -256,6 +1080,113 @@ func TestBoMDirectoryStats(t *testing.T) {
 			So(stats[13].Count, ShouldEqual, 1)
 			So(stats[13].Size, ShouldEqual, stats[12].Size)
 
+			Convey("and they pass validation", func() {
+				So(ValidateStats(stats), ShouldBeNil)
+
+				Convey("unless one is corrupted", func() {
+					stats[10].Size++
+
+					errs := ValidateStats(stats)
+					So(len(errs), ShouldEqual, 2)
+
+					for _, err := range errs {
+						So(errors.Is(err, ErrStatsDontSum), ShouldBeTrue)
+					}
+
+					So(errs[0].Error(), ShouldContainSubstring, " "+stats[9].Directory+": ")
+					So(errs[1].Error(), ShouldContainSubstring, " "+stats[10].Directory+": ")
+				})
+			})
+
+			Convey("with own counts and sizes for the files directly in each directory", func() {
+				bcftools, test, doc := stats[9], stats[10], stats[11]
+				So(bcftools.Directory, ShouldEndWith, "/bcftools-1.19")
+				So(bcftools.Count, ShouldEqual, 5)
+				So(bcftools.OwnCount, ShouldEqual, 0)
+				So(bcftools.OwnSize, ShouldEqual, 0)
+				So(bcftools.Size, ShouldBeGreaterThan, bcftools.OwnSize)
+				So(test.OwnCount, ShouldEqual, 4)
+				So(test.OwnSize, ShouldEqual, test.Size)
+				So(doc.OwnCount, ShouldEqual, 1)
+				So(bcftools.OwnSize+test.OwnSize+doc.OwnSize, ShouldEqual, bcftools.Size)
+
+				var ownCount uint64
+
+				for _, s := range stats {
+					ownCount += s.OwnCount
+				}
+
+				So(ownCount, ShouldEqual, stats[0].Count)
+
+				tempDir := t.TempDir()
+				prefix := filepath.Join(tempDir, "output")
+
+				err = PrintBoMDirectoryStats(prefix, stats[9:12], WithOwnColumns())
+				So(err, ShouldBeNil)
+
+				b, errr := os.ReadFile(prefix + ".ToL.tsv")
+				So(errr, ShouldBeNil)
+				So(string(b), ShouldEqual, bcftools.Directory+"\t5\t0.00\t0\t0.00\n"+
+					test.Directory+"\t4\t0.00\t4\t0.00\n"+doc.Directory+"\t1\t0.00\t1\t0.00\n")
+			})
+
+			Convey("and write them as folded stacks that sum to the total", func() {
+				prefix := filepath.Join(t.TempDir(), "output")
+
+				So(WriteBoMDirectoryStatsFolded(prefix, stats), ShouldBeNil)
+
+				b, errr := os.ReadFile(prefix + ".ToL.folded")
+				So(errr, ShouldBeNil)
+
+				lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+				So(len(lines), ShouldEqual, 3)
+				So(lines, ShouldContain, "root;lustre;scratch122;tol;teams;blaxter;users;cc51;software;bcftools-1.19;doc "+
+					strconv.FormatInt(stats[11].OwnSize, 10))
+
+				var total int64
+
+				for _, line := range lines {
+					_, size, _ := strings.Cut(line, " ")
+
+					n, errp := strconv.ParseInt(size, 10, 64)
+					So(errp, ShouldBeNil)
+
+					total += n
+				}
+
+				So(total, ShouldEqual, stats[0].Size)
+			})
+
+			Convey("and write them losslessly in gob format and read them back", func() {
+				path := filepath.Join(t.TempDir(), "output.gob")
+
+				So(WriteBoMDirectoryStatsGob(path, stats), ShouldBeNil)
+
+				read, errr := ReadBoMDirectoryStatsGob(path)
+				So(errr, ShouldBeNil)
+				So(read, ShouldResemble, stats)
+				So(read[13].OldestMTime, ShouldEqual, stats[13].OldestMTime)
+				So(read[13].OldestMTime, ShouldNotEqual, 0)
+
+				_, errr = ReadBoMDirectoryStatsGob(path + ".missing")
+				So(errr, ShouldNotBeNil)
+			})
+
+			Convey("and you can get just the directories that directly contain old files", func() {
+				direct, errd := BoMDirectoryStats(NewStatsParser(testStatsReader(t)), gtb,
+					yearsRelativeToTestFileCreation(7), WithDirectFilesOnly())
+				So(errd, ShouldBeNil)
+				So(len(direct), ShouldEqual, 3)
+
+				So(direct[0], ShouldResemble, stats[10])
+				So(direct[1], ShouldResemble, stats[11])
+				So(direct[2], ShouldResemble, stats[13])
+
+				for _, s := range direct {
+					So(s.OwnCount, ShouldBeGreaterThan, 0)
+				}
+			})
+
 			Convey("and print them out as a tsv", func() {
 				expectedTSV := `/	6	0.00
 /lustre	6	0.00
@@ -273,144 +1204,3222 @@ func TestBoMDirectoryStats(t *testing.T) {
 /lustre/scratch122/tol/teams/blaxter/users/cc51/software/samtools-1.9/htslib-1.9	1	0.00
 `
 
-				tempDir := t.TempDir()
-				prefix := filepath.Join(tempDir, "output")
+				tempDir := t.TempDir()
+				prefix := filepath.Join(tempDir, "output")
+
+				err = PrintBoMDirectoryStats(prefix, stats)
+				So(err, ShouldBeNil)
+
+				b, errr := os.ReadFile(prefix + ".ToL.tsv")
+				So(errr, ShouldBeNil)
+
+				So(string(b), ShouldEqual, expectedTSV)
+			})
+
+			Convey("and print them out as an indented tree", func() {
+				expectedTree := "/\t6\t0.00\n" +
+					"  lustre\t6\t0.00\n" +
+					"    scratch122\t6\t0.00\n" +
+					"      tol\t6\t0.00\n" +
+					"        teams\t6\t0.00\n" +
+					"          blaxter\t6\t0.00\n" +
+					"            users\t6\t0.00\n" +
+					"              cc51\t6\t0.00\n" +
+					"                software\t6\t0.00\n" +
+					"                  bcftools-1.19\t5\t0.00\n" +
+					"                    test\t4\t0.00\n" +
+					"                    doc\t1\t0.00\n" +
+					"                  samtools-1.9\t1\t0.00\n" +
+					"                    htslib-1.9\t1\t0.00\n"
+
+				tempDir := t.TempDir()
+				prefix := filepath.Join(tempDir, "output")
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithTreeLayout())
+				So(err, ShouldBeNil)
+
+				b, errr := os.ReadFile(prefix + ".ToL.tsv")
+				So(errr, ShouldBeNil)
+				So(string(b), ShouldEqual, expectedTree)
+			})
+
+			Convey("and print them out with different rounding modes", func() {
+				So(stats[0].Size, ShouldEqual, 26440)
+
+				tempDir := t.TempDir()
+				prefix := filepath.Join(tempDir, "output")
+
+				for mode, expected := range map[RoundingMode]string{
+					RoundNearest: "/\t6\t0.00\n",
+					RoundHalfUp:  "/\t6\t0.00\n",
+					RoundUp:      "/\t6\t0.01\n",
+					Truncate:     "/\t6\t0.00\n",
+				} {
+					err = PrintBoMDirectoryStats(prefix, stats[:1], WithRounding(mode))
+					So(err, ShouldBeNil)
+
+					b, errr := os.ReadFile(prefix + ".ToL.tsv")
+					So(errr, ShouldBeNil)
+					So(string(b), ShouldEqual, expected)
+				}
+
+				exact := &Stats{BoM: []byte("ToL"), Directory: "/", Count: 6, Size: 290000000}
+
+				for _, mode := range []RoundingMode{RoundHalfUp, RoundUp, Truncate} {
+					err = PrintBoMDirectoryStats(prefix, []*Stats{exact}, WithRounding(mode), WithSizeUnit(GB))
+					So(err, ShouldBeNil)
+
+					b, errr := os.ReadFile(prefix + ".ToL.tsv")
+					So(errr, ShouldBeNil)
+					So(string(b), ShouldEqual, "/\t6\t0.29\n")
+				}
+			})
+
+			Convey("and print them out without the root row", func() {
+				tempDir := t.TempDir()
+				prefix := filepath.Join(tempDir, "output")
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithoutRoot())
+				So(err, ShouldBeNil)
+
+				b, errr := os.ReadFile(prefix + ".ToL.tsv")
+				So(errr, ShouldBeNil)
+
+				lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+				So(len(lines), ShouldEqual, 13)
+				So(lines[0], ShouldEqual, "/lustre\t6\t0.00")
+				So(lines[len(lines)-1], ShouldEqual,
+					"/lustre/scratch122/tol/teams/blaxter/users/cc51/software/samtools-1.9/htslib-1.9\t1\t0.00")
+
+				for _, line := range lines {
+					So(line, ShouldNotStartWith, "/\t")
+				}
+
+				So(stats[13].Size, ShouldEqual, stats[12].Size)
+				So(stats[10].Size+stats[11].Size, ShouldEqual, stats[9].Size)
+			})
+		})
+
+		Convey("you can find the first BoM with too much old data without reading everything", func() {
+			data := statsLine("/c/f1", 10, 808, 0, 0, 0) +
+				statsLine("/h/f1", 5, 1736, 0, 0, 0) +
+				statsLine("/h/f2", 10, 1736, 0, 0, 0) +
+				statsLine("/c/f2", 10, 808, 0, 0, 0) +
+				statsLine("/c/f3", 10, 808, 0, 0, 0)
+
+			sp := NewStatsParser(strings.NewReader(data))
+
+			bom, errb := BoMOverSize(sp, gtb, time.Hour, 12)
+			So(errb, ShouldBeNil)
+			So(bom, ShouldEqual, "HumanGenetics")
+			So(sp.EntriesParsed(), ShouldEqual, 3)
+
+			bom, errb = BoMOverSize(NewStatsParser(strings.NewReader(data)), gtb, time.Hour, 12,
+				WithRoot("/c"))
+			So(errb, ShouldBeNil)
+			So(bom, ShouldEqual, "CASM")
+
+			sp = NewStatsParser(strings.NewReader(data))
+			bom, errb = BoMOverSize(sp, gtb, time.Hour, 30)
+			So(errb, ShouldBeNil)
+			So(bom, ShouldBeEmpty)
+			So(sp.EntriesParsed(), ShouldEqual, 5)
+
+			_, errb = BoMOverSize(NewStatsParser(strings.NewReader("")), gtb, time.Hour, 30)
+			So(errb, ShouldEqual, ErrNoData)
+
+			bom, errb = BoMOverSize(NewStatsParser(testStatsReader(t)), gtb, yearsRelativeToTestFileCreation(7), 1000)
+			So(errb, ShouldBeNil)
+			So(bom, ShouldEqual, "ToL")
+		})
+
+		Convey("you can get a summary of the results", func() {
+			stats, summary, errb := BoMDirectoryStatsWithSummary(p, gtb, yearsRelativeToTestFileCreation(7))
+			So(errb, ShouldBeNil)
+			So(len(stats), ShouldEqual, 14)
+			So(summary.BoMs, ShouldEqual, 1)
+			So(summary.Directories, ShouldEqual, 14)
+			So(summary.Files, ShouldEqual, 6)
+			So(summary.Bytes, ShouldEqual, 26440)
+			So(summary.Elapsed, ShouldBeGreaterThan, 0)
+			So(summary.PerBoM, ShouldResemble, map[string]*BoMSummary{
+				"ToL": {Files: 6, Bytes: 26440, MinDepth: 10, MaxDepth: 10},
+			})
+
+			_, summary, errb = BoMDirectoryStatsWithSummary(NewStatsParser(strings.NewReader(
+				statsLine("/a/b/c/f", 1, 808, 0, 0, 0)+statsLine("/a/f", 2, 808, 0, 0, 0)+
+					statsLine("/f", 4, 1736, 0, 0, 0))), gtb, time.Hour)
+			So(errb, ShouldBeNil)
+			So(summary.PerBoM["CASM"], ShouldResemble, &BoMSummary{Files: 2, Bytes: 3, MinDepth: 1, MaxDepth: 3})
+			So(summary.PerBoM["HumanGenetics"], ShouldResemble, &BoMSummary{Files: 1, Bytes: 4, MinDepth: 0, MaxDepth: 0})
+
+			_, summary, errb = BoMDirectoryStatsWithSummary(NewStatsParser(strings.NewReader("")), gtb, time.Hour)
+			So(errb, ShouldEqual, ErrNoData)
+			So(summary.BoMs, ShouldEqual, 0)
+			So(summary.Files, ShouldEqual, 0)
+		})
+
+		Convey("you can print a summary with thousands separators, which are never used in the tsv", func() {
+			stats := []*Stats{{BoM: []byte("CASM"), Directory: "/", Count: 18890000, Size: 3 * bytesPerGiB,
+				OwnCount: 18890000, OwnSize: 3 * bytesPerGiB}}
+			summary := summarise(stats)
+
+			var buf bytes.Buffer
+
+			So(PrintRunSummary(&buf, summary, WithThousandsSeparators()), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "BoMs: 1\ndirectories: 1\nfiles: 18,890,000\nsize: 3.00 GiB\n"+
+				"BoM CASM: 18,890,000 files, 3.00 GiB, depth 0-0\n")
+
+			buf.Reset()
+			summary.Elapsed = time.Second
+			summary.Directories = 1234
+
+			So(PrintRunSummary(&buf, summary), ShouldBeNil)
+			So(buf.String(), ShouldStartWith, "BoMs: 1\ndirectories: 1234\nfiles: 18890000\nsize: 3.00 GiB\n"+
+				"elapsed: 1s\n")
+
+			prefix := filepath.Join(t.TempDir(), "output")
+			So(PrintBoMDirectoryStats(prefix, stats, WithThousandsSeparators()), ShouldBeNil)
+
+			b, errr := os.ReadFile(prefix + ".CASM.tsv")
+			So(errr, ShouldBeNil)
+			So(string(b), ShouldEqual, "/\t18890000\t3.00\n")
+
+			po := newPrintOptions([]PrintOption{WithThousandsSeparators()})
+			for n, expected := range map[uint64]string{0: "0", 999: "999", 1000: "1,000", 123456: "123,456",
+				1234567: "1,234,567"} {
+				So(po.formatCount(n), ShouldEqual, expected)
+			}
+		})
+
+		Convey("you can get the number of directories for each BoM", func() {
+			stats, counts, errb := BoMDirectoryStatsWithCounts(p, gtb, yearsRelativeToTestFileCreation(7))
+			So(errb, ShouldBeNil)
+			So(counts, ShouldResemble, map[string]int{"ToL": 14})
+
+			tolRows := 0
+
+			for _, s := range stats {
+				if string(s.BoM) == "ToL" {
+					tolRows++
+				}
+			}
+
+			So(counts["ToL"], ShouldEqual, tolRows)
+		})
+
+		Convey("you can get the stats for different BoMs", func() {
+			f, err = os.Open("test2.stats")
+			So(err, ShouldBeNil)
+
+			defer f.Close()
+
+			p = NewStatsParser(f)
+
+			stats, err := BoMDirectoryStats(p, gtb, yearsRelativeToTestFileCreation(7))
+			So(err, ShouldBeNil)
+			So(len(stats), ShouldEqual, 6)
+
+			So(string(stats[0].BoM), ShouldEqual, "HumanGenetics")
+			So(stats[0].Directory, ShouldEqual, "/")
+			So(stats[0].Count, ShouldEqual, 1)
+			So(stats[0].Size, ShouldEqual, 2523300000)
+			So(stats[1].Directory, ShouldEqual, "/a")
+			So(stats[2].Directory, ShouldEqual, "/a/c")
+
+			So(string(stats[3].BoM), ShouldEqual, "CASM")
+			So(stats[3].Directory, ShouldEqual, "/")
+			So(stats[3].Count, ShouldEqual, 1)
+			So(stats[3].Size, ShouldEqual, 1611000000)
+			So(stats[4].Directory, ShouldEqual, "/a")
+			So(stats[5].Directory, ShouldEqual, "/a/b")
+
+			Convey("and group them by BoM with the largest BoMs first", func() {
+				f, err = os.Open("test2.stats")
+				So(err, ShouldBeNil)
+
+				defer f.Close()
+
+				grouped, errb := BoMDirectoryStats(NewStatsParser(f), gtb, yearsRelativeToTestFileCreation(7),
+					WithSortOrder(SmallestFirst), WithLargestBoMsFirst())
+				So(errb, ShouldBeNil)
+				So(len(grouped), ShouldEqual, 6)
+
+				for i, s := range grouped {
+					expectedBoM := "HumanGenetics"
+					if i >= 3 {
+						expectedBoM = "CASM"
+					}
+
+					So(string(s.BoM), ShouldEqual, expectedBoM)
+				}
+
+				So(grouped[0].Size, ShouldBeGreaterThan, grouped[3].Size)
+
+				for _, i := range []int{1, 2, 4, 5} {
+					So(grouped[i-1].Size, ShouldBeLessThanOrEqualTo, grouped[i].Size)
+				}
+
+				smallestFirst, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader(
+					statsLine("/c/big/f", 10, 808, 0, 0, 0)+statsLine("/c/small/f", 1, 808, 0, 0, 0)+
+						statsLine("/h/f", 5, 1736, 0, 0, 0))), gtb, time.Hour,
+					WithSortOrder(SmallestFirst), WithLargestBoMsFirst())
+				So(errb, ShouldBeNil)
+				So(len(smallestFirst), ShouldEqual, 6)
+				So(string(smallestFirst[0].BoM), ShouldEqual, "CASM")
+				So(smallestFirst[0].Directory, ShouldEqual, "/c/small")
+				So(smallestFirst[1].Directory, ShouldEqual, "/c/big")
+				So(smallestFirst[2].Directory, ShouldEqual, "/")
+				So(string(smallestFirst[3].BoM), ShouldEqual, "CASM")
+				So(string(smallestFirst[4].BoM), ShouldEqual, "HumanGenetics")
+			})
+
+			Convey("and write them as JSON nested by BoM then directory", func() {
+				var buf bytes.Buffer
+
+				err = WriteBoMDirectoryStatsNestedJSON(&buf, stats)
+				So(err, ShouldBeNil)
+
+				var nested map[string]map[string]struct {
+					Count       uint64 `json:"count"`
+					Size        int64  `json:"size_bytes"`
+					OldestMTime int64  `json:"oldest_mtime"`
+				}
+
+				err = json.Unmarshal(buf.Bytes(), &nested)
+				So(err, ShouldBeNil)
+				So(len(nested), ShouldEqual, 2)
+				So(len(nested["HumanGenetics"]), ShouldEqual, 3)
+				So(nested["HumanGenetics"]["/"].Size, ShouldEqual, 2523300000)
+				So(nested["CASM"]["/"].Count, ShouldEqual, 1)
+				So(nested["CASM"]["/a/b"].Size, ShouldEqual, stats[5].Size)
+
+				out := buf.String()
+				So(strings.Index(out, `"HumanGenetics"`), ShouldBeLessThan, strings.Index(out, `"CASM"`))
+				So(strings.Index(out, `"/a":`), ShouldBeLessThan, strings.Index(out, `"/a/c":`))
+			})
+
+			Convey("and write empty files for BoMs without any", func() {
+				boms := gtb.BoMs()
+				So(boms, ShouldContain, "ToL")
+				So(slices.IsSorted(boms), ShouldBeTrue)
+
+				prefix := filepath.Join(t.TempDir(), "output")
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithEmptyBoMFiles(boms))
+				So(err, ShouldBeNil)
+
+				for _, bom := range boms {
+					info, errs := os.Stat(prefix + "." + bom + ".tsv")
+					So(errs, ShouldBeNil)
+
+					if bom == "CASM" || bom == "HumanGenetics" {
+						So(info.Size(), ShouldBeGreaterThan, 0)
+					} else {
+						So(info.Size(), ShouldEqual, 0)
+					}
+				}
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithEmptyBoMFiles(boms),
+					WithMetadataComment("7y", time.Now()))
+				So(err, ShouldBeNil)
+
+				b, errr := os.ReadFile(prefix + ".ToL.tsv")
+				So(errr, ShouldBeNil)
+				So(string(b), ShouldStartWith, "#")
+				So(strings.Count(string(b), "\n"), ShouldEqual, 1)
+			})
+
+			Convey("and write them as a gzip compressed NDJSON stream", func() {
+				var buf bytes.Buffer
+
+				err = WriteGzippedBoMDirectoryStatsNDJSON(&buf, stats)
+				So(err, ShouldBeNil)
+
+				gr, errg := gzip.NewReader(&buf)
+				So(errg, ShouldBeNil)
+
+				type row struct {
+					BoM       string `json:"bom"`
+					Directory string `json:"directory"`
+					Count     uint64 `json:"count"`
+					Size      int64  `json:"size_bytes"`
+				}
+
+				var rows []row
+
+				scanner := bufio.NewScanner(gr)
+				for scanner.Scan() {
+					var r row
+
+					So(json.Unmarshal(scanner.Bytes(), &r), ShouldBeNil)
+
+					rows = append(rows, r)
+				}
+
+				So(scanner.Err(), ShouldBeNil)
+				So(len(rows), ShouldEqual, 6)
+				So(rows[0], ShouldResemble, row{BoM: "HumanGenetics", Directory: "/", Count: 1, Size: 2523300000})
+				So(rows[5].BoM, ShouldEqual, "CASM")
+				So(rows[5].Directory, ShouldEqual, "/a/b")
+				So(rows[5].Size, ShouldEqual, stats[5].Size)
+			})
+
+			Convey("and print them with a header and exact sizes in bytes", func() {
+				prefix := filepath.Join(t.TempDir(), "output")
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithBytesColumn())
+				So(err, ShouldBeNil)
+
+				b, errr := os.ReadFile(prefix + ".HumanGenetics.tsv")
+				So(errr, ShouldBeNil)
+
+				lines := strings.Split(string(b), "\n")
+				So(lines[0], ShouldEqual, "directory\tcount\tbytes\tGiB")
+				So(lines[1], ShouldEqual, "/\t1\t2523300000\t2.35")
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithBytesColumn(), WithBoMColumn(), WithOwnColumns(),
+					WithHardlinkColumn(), WithSizeUnit(GB))
+				So(err, ShouldBeNil)
+
+				b, errr = os.ReadFile(prefix + ".HumanGenetics.tsv")
+				So(errr, ShouldBeNil)
+
+				lines = strings.Split(string(b), "\n")
+				So(lines[0], ShouldEqual,
+					"bom\tdirectory\tcount\tbytes\tGB\town_count\town_bytes\town_GB\thardlinked")
+				So(lines[1], ShouldEqual, "HumanGenetics\t/\t1\t2523300000\t2.52\t0\t0\t0.00\t0")
+
+				Convey("which can be parsed back in to Stats exactly", func() {
+					err = PrintBoMDirectoryStats(prefix, stats, WithBytesColumn(),
+						WithMetadataComment("7y", time.Now()))
+					So(err, ShouldBeNil)
+
+					tsv, errp := os.Open(prefix + ".CASM.tsv")
+					So(errp, ShouldBeNil)
+
+					defer tsv.Close()
+
+					parsed, errp := ParseStatsTSV(tsv, "CASM")
+					So(errp, ShouldBeNil)
+					So(len(parsed), ShouldEqual, 3)
+
+					for i, s := range parsed {
+						So(s.Directory, ShouldEqual, stats[3+i].Directory)
+						So(s.Count, ShouldEqual, stats[3+i].Count)
+						So(s.Size, ShouldEqual, stats[3+i].Size)
+					}
+				})
+			})
+
+			Convey("and parse the printed tsv back in to Stats", func() {
+				prefix := filepath.Join(t.TempDir(), "output")
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithMetadataComment("7y", time.Now()), WithOwnColumns())
+				So(err, ShouldBeNil)
+
+				tsv, errp := os.Open(prefix + ".CASM.tsv")
+				So(errp, ShouldBeNil)
+
+				defer tsv.Close()
+
+				_, errp = ParseStatsTSV(tsv, "CASM")
+				So(errors.Is(errp, ErrNoStatsTSVHeader), ShouldBeTrue)
+				So(errp.Error(), ShouldStartWith, "line 2:")
+
+				_, errp = tsv.Seek(0, io.SeekStart)
+				So(errp, ShouldBeNil)
+
+				parsed, errp := ParseStatsTSVWithUnit(tsv, "CASM", GiB)
+				So(errp, ShouldBeNil)
+				So(len(parsed), ShouldEqual, 3)
+
+				for i, s := range parsed {
+					So(string(s.BoM), ShouldEqual, "CASM")
+					So(s.Directory, ShouldEqual, stats[3+i].Directory)
+					So(s.Count, ShouldEqual, stats[3+i].Count)
+					So(s.Size, ShouldAlmostEqual, stats[3+i].Size, bytesPerGiB/200)
+				}
+
+				Convey("and diff them against new Stats", func() {
+					after := []*Stats{
+						{BoM: []byte("CASM"), Directory: "/", Count: 2, Size: stats[3].Size + bytesPerGiB},
+						{BoM: []byte("CASM"), Directory: "/a", Count: 2, Size: stats[4].Size + bytesPerGiB},
+						{BoM: []byte("CASM"), Directory: "/a/b", Count: 1, Size: stats[5].Size},
+						{BoM: []byte("CASM"), Directory: "/a/d", Count: 1, Size: bytesPerGiB},
+					}
+
+					deltas := DiffStats(parsed, after)
+					So(len(deltas), ShouldEqual, 4)
+					So(deltas[2].Directory, ShouldEqual, "/a/d")
+					So(deltas[2].Count, ShouldEqual, 1)
+					So(deltas[2].Size, ShouldEqual, bytesPerGiB)
+					So(deltas[3].Directory, ShouldEqual, "/a/b")
+					So(deltas[3].Count, ShouldEqual, 0)
+
+					err = PrintStatsDeltas(prefix, deltas)
+					So(err, ShouldBeNil)
+
+					b, errp := os.ReadFile(prefix + ".CASM.delta.tsv")
+					So(errp, ShouldBeNil)
+					So(string(b), ShouldEqual, "/\t1\t1.00\n/a\t1\t1.00\n/a/d\t1\t1.00\n")
+				})
+			})
+
+			Convey("but not parse an invalid tsv", func() {
+				_, errp := ParseStatsTSVWithUnit(strings.NewReader("/\t1\t1.00\n/a\tx\t1.00\n"), "CASM", GiB)
+				So(errors.Is(errp, ErrBadStatsTSV), ShouldBeTrue)
+				So(errp.Error(), ShouldStartWith, "line 2:")
+			})
+
+			Convey("and parse tsvs with other layouts, described by their header", func() {
+				prefix := filepath.Join(t.TempDir(), "output")
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithBytesColumn(), WithBoMColumn(),
+					WithSizeUnit(GB), WithOwnColumns())
+				So(err, ShouldBeNil)
+
+				tsv, errp := os.Open(prefix + ".CASM.tsv")
+				So(errp, ShouldBeNil)
+
+				defer tsv.Close()
+
+				parsed, errp := ParseStatsTSV(tsv, "other")
+				So(errp, ShouldBeNil)
+				So(len(parsed), ShouldEqual, 3)
+
+				for i, s := range parsed {
+					So(string(s.BoM), ShouldEqual, "CASM")
+					So(s.Directory, ShouldEqual, stats[3+i].Directory)
+					So(s.Size, ShouldEqual, stats[3+i].Size)
+				}
+
+				parsed, errp = ParseStatsTSV(strings.NewReader("count\tGB\tdirectory\n1\t0.07\t/a\n"), "CASM")
+				So(errp, ShouldNotBeNil)
+				So(parsed, ShouldBeNil)
+
+				parsed, errp = ParseStatsTSV(strings.NewReader("directory\tcount\tGB\n/a\t1\t0.07\n"), "CASM")
+				So(errp, ShouldBeNil)
+				So(len(parsed), ShouldEqual, 1)
+				So(parsed[0].Size, ShouldEqual, 70000000)
+
+				parsed, errp = ParseStatsTSV(strings.NewReader("bom\tdirectory\tcount\tGiB\tbytes\nToL\t/a\t1\t0.00\t7\n"),
+					"CASM")
+				So(errp, ShouldBeNil)
+				So(len(parsed), ShouldEqual, 1)
+				So(string(parsed[0].BoM), ShouldEqual, "ToL")
+				So(parsed[0].Size, ShouldEqual, 7)
+
+				_, errp = ParseStatsTSV(strings.NewReader("# comment\ndirectory\tcount\tTiB\n/a\t1\t1.00\n"), "CASM")
+				So(errors.Is(errp, ErrBadStatsTSVHeader), ShouldBeTrue)
+				So(errp.Error(), ShouldStartWith, "line 2:")
+
+				_, errp = ParseStatsTSV(strings.NewReader("directory\tbytes\n/a\t1\n"), "CASM")
+				So(errors.Is(errp, ErrBadStatsTSVHeader), ShouldBeTrue)
+			})
+
+			Convey("and parse legacy tsvs without a header only when told their unit", func() {
+				prefix := filepath.Join(t.TempDir(), "output")
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithSizeUnit(GB))
+				So(err, ShouldBeNil)
+
+				b, errr := os.ReadFile(prefix + ".CASM.tsv")
+				So(errr, ShouldBeNil)
+
+				_, errp := ParseStatsTSV(bytes.NewReader(b), "CASM")
+				So(errors.Is(errp, ErrNoStatsTSVHeader), ShouldBeTrue)
+
+				parsed, errp := ParseStatsTSVWithUnit(bytes.NewReader(b), "CASM", GB)
+				So(errp, ShouldBeNil)
+				So(len(parsed), ShouldEqual, 3)
+
+				for i, s := range parsed {
+					So(s.Size, ShouldAlmostEqual, stats[3+i].Size, 5000000)
+				}
+
+				parsed, errp = ParseStatsTSVWithUnit(strings.NewReader("directory\tcount\tbytes\n/a\t1\t7\n"),
+					"CASM", GB)
+				So(errp, ShouldBeNil)
+				So(parsed[0].Size, ShouldEqual, 7)
+
+				opts, errp := parseArgs([]string{"-b", "bom.gids", "-legacy", "-gb"})
+				So(errp, ShouldBeNil)
+
+				_, before := readSinceFile(prefix+".CASM.tsv", newStatsTSVParser(opts.legacy, opts.sizeUnit()))
+				So(len(before), ShouldEqual, 3)
+				So(before[0].Size, ShouldAlmostEqual, stats[3].Size, 5000000)
+			})
+
+			Convey("and remove stale output files from previous runs", func() {
+				dir := t.TempDir()
+				prefix := filepath.Join(dir, "output")
+				stale := prefix + ".OldBoM.tsv"
+				other := filepath.Join(dir, "notes.txt")
+				otherPrefix := filepath.Join(dir, "other.CASM.tsv")
+
+				for _, path := range []string{stale, prefix + ".CASM.tsv", other, otherPrefix} {
+					So(os.WriteFile(path, []byte("old"), 0600), ShouldBeNil)
+				}
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithStaleFileRemoval(), WithIndex(gtb))
+				So(err, ShouldBeNil)
+
+				outputs, errg := filepath.Glob(filepath.Join(dir, "*"))
+				So(errg, ShouldBeNil)
+				So(outputs, ShouldResemble, []string{
+					filepath.Join(dir, "index.tsv"),
+					other,
+					otherPrefix,
+					prefix + ".CASM.tsv",
+					prefix + ".HumanGenetics.tsv",
+				})
+
+				b, errg := os.ReadFile(prefix + ".CASM.tsv")
+				So(errg, ShouldBeNil)
+				So(string(b), ShouldStartWith, "/\t1\t")
+
+				Convey("including an index a later run without WithIndex() doesn't write", func() {
+					err = PrintBoMDirectoryStats(prefix, stats, WithStaleFileRemoval())
+					So(err, ShouldBeNil)
+
+					outputs, errg = filepath.Glob(filepath.Join(dir, "*"))
+					So(errg, ShouldBeNil)
+					So(outputs, ShouldResemble, []string{
+						other,
+						otherPrefix,
+						prefix + ".CASM.tsv",
+						prefix + ".HumanGenetics.tsv",
+					})
+				})
+			})
+
+			Convey("and leave previous output files alone if writing fails", func() {
+				dir := t.TempDir()
+				prefix := filepath.Join(dir, "output")
+				stale := prefix + ".OldBoM.tsv"
+
+				for _, path := range []string{stale, prefix + ".CASM.tsv"} {
+					So(os.WriteFile(path, []byte("old"), 0600), ShouldBeNil)
+				}
+
+				So(os.Mkdir(prefix+".HumanGenetics.tsv"+tmpSuffix, 0700), ShouldBeNil)
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithStaleFileRemoval(), WithIndex(gtb))
+				So(err, ShouldNotBeNil)
+
+				outputs, errg := filepath.Glob(filepath.Join(dir, "*"))
+				So(errg, ShouldBeNil)
+				So(outputs, ShouldResemble, []string{
+					prefix + ".CASM.tsv",
+					prefix + ".HumanGenetics.tsv" + tmpSuffix,
+					stale,
+				})
+
+				b, errg := os.ReadFile(prefix + ".CASM.tsv")
+				So(errg, ShouldBeNil)
+				So(string(b), ShouldEqual, "old")
+			})
+
+			Convey("and not write the index or remove stale files if closing a file fails", func() {
+				dir := t.TempDir()
+				prefix := filepath.Join(dir, "output")
+				stale := prefix + ".OldBoM.tsv"
+
+				So(os.WriteFile(stale, []byte("old"), 0600), ShouldBeNil)
+
+				u := newFakeUploader()
+				u.failClose[prefix+".CASM.tsv"] = true
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithWriterFactory(u.Upload),
+					WithStaleFileRemoval(), WithIndex(gtb))
+				So(errors.Is(err, errFakeClose), ShouldBeTrue)
+				So(u.uploads, ShouldNotContainKey, filepath.Join(dir, "index.tsv"))
+				So(u.uploads[prefix+".HumanGenetics.tsv"].closed, ShouldBeTrue)
+
+				_, errs := os.Stat(stale)
+				So(errs, ShouldBeNil)
+			})
+
+			Convey("and only print those of BoMs above a minimum size", func() {
+				prefix := filepath.Join(t.TempDir(), "output")
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithMinBoMSize(2000000000))
+				So(err, ShouldBeNil)
+
+				outputs, errg := filepath.Glob(prefix + ".*")
+				So(errg, ShouldBeNil)
+				So(outputs, ShouldResemble, []string{prefix + ".HumanGenetics.tsv"})
+
+				opts, errg := parseArgs([]string{"-b", "bom.gids", "-gb", "-min-bom-size", "2"})
+				So(errg, ShouldBeNil)
+
+				po := newPrintOptions(opts.printOptions(nil))
+				So(po.minBoMSize, ShouldEqual, 2000000000)
+			})
+
+			Convey("and only print those of BoMs above a minimum size even without a / directory", func() {
+				data := statsLine("/a/f1", 10, 808, 0, 0, 0) +
+					statsLine("/a/b/f2", 5, 808, 0, 0, 0) +
+					statsLine("/h/f1", 100, 1736, 0, 0, 0)
+
+				rooted, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, time.Hour,
+					WithRoot("/a"))
+				So(errb, ShouldBeNil)
+				So(len(rooted), ShouldEqual, 2)
+
+				prefix := filepath.Join(t.TempDir(), "output")
+
+				err = PrintBoMDirectoryStats(prefix, rooted, WithMinBoMSize(1<<40))
+				So(err, ShouldBeNil)
+
+				outputs, errg := filepath.Glob(prefix + ".*")
+				So(errg, ShouldBeNil)
+				So(outputs, ShouldBeEmpty)
+
+				err = PrintBoMDirectoryStats(prefix, rooted, WithMinBoMSize(15), WithMinBoMCount(2))
+				So(err, ShouldBeNil)
+
+				outputs, errg = filepath.Glob(prefix + ".*")
+				So(errg, ShouldBeNil)
+				So(outputs, ShouldResemble, []string{prefix + ".CASM.tsv"})
+
+				err = PrintBoMDirectoryStats(prefix+"2", rooted, WithMinBoMCount(3))
+				So(err, ShouldBeNil)
+
+				outputs, errg = filepath.Glob(prefix + "2.*")
+				So(errg, ShouldBeNil)
+				So(outputs, ShouldBeEmpty)
+			})
+
+			Convey("and print their sizes in GiBs", func() {
+				tempDir := t.TempDir()
+				prefix := filepath.Join(tempDir, "output")
+
+				err = PrintBoMDirectoryStats(prefix, stats)
+				So(err, ShouldBeNil)
+
+				b, err := os.ReadFile(prefix + ".HumanGenetics.tsv")
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "/\t1\t2.35\n/a\t1\t2.35\n/a/c\t1\t2.35\n")
+
+				b, err = os.ReadFile(prefix + ".CASM.tsv")
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "/\t1\t1.50\n/a\t1\t1.50\n/a/b\t1\t1.50\n")
+			})
+
+			Convey("and retry creating output files that fail to be created", func() {
+				tempDir := t.TempDir()
+				prefix := filepath.Join(tempDir, "output")
+				failures := make(map[string]int)
+
+				flakyCreate := func(name string) (io.WriteCloser, error) {
+					if failures[name] < 2 {
+						failures[name]++
+
+						return nil, os.ErrDeadlineExceeded
+					}
+
+					return os.Create(name)
+				}
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithWriterFactory(flakyCreate))
+				So(err, ShouldEqual, os.ErrDeadlineExceeded)
+
+				failures = make(map[string]int)
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithWriterFactory(flakyCreate),
+					WithCreateRetries(2, time.Millisecond))
+				So(err, ShouldBeNil)
+				So(failures[prefix+".CASM.tsv"], ShouldEqual, 2)
+
+				b, err := os.ReadFile(prefix + ".CASM.tsv")
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "/\t1\t1.50\n/a\t1\t1.50\n/a/b\t1\t1.50\n")
+
+				Convey("but only if the failure is transient", func() {
+					var creates int
+
+					failWith := func(failure error) WriterFactory {
+						creates = 0
+
+						return func(name string) (io.WriteCloser, error) {
+							creates++
+
+							if creates == 1 {
+								return nil, &os.PathError{Op: "open", Path: name, Err: failure}
+							}
+
+							return os.Create(name)
+						}
+					}
+
+					err = PrintBoMDirectoryStats(prefix, stats, WithWriterFactory(failWith(syscall.ESTALE)),
+						WithCreateRetries(2, time.Millisecond))
+					So(err, ShouldBeNil)
+					So(creates, ShouldEqual, 3)
+
+					err = PrintBoMDirectoryStats(prefix, stats, WithWriterFactory(failWith(syscall.EACCES)),
+						WithCreateRetries(2, time.Millisecond))
+					So(errors.Is(err, os.ErrPermission), ShouldBeTrue)
+					So(creates, ShouldEqual, 1)
+				})
+			})
+
+			Convey("and retry renaming output files that fail to be renamed", func() {
+				prefix := filepath.Join(t.TempDir(), "output")
+				failures := make(map[string]int)
+
+				flakyRename := func(po *printOptions) {
+					po.rename = func(oldpath, newpath string) error {
+						if failures[oldpath] < 2 {
+							failures[oldpath]++
+
+							return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EBUSY}
+						}
+
+						return os.Rename(oldpath, newpath)
+					}
+				}
+
+				err = PrintBoMDirectoryStats(prefix, stats, flakyRename)
+				So(errors.Is(err, syscall.EBUSY), ShouldBeTrue)
+
+				_, errs := os.Stat(prefix + ".CASM.tsv")
+				So(errs, ShouldNotBeNil)
+
+				failures = make(map[string]int)
+
+				err = PrintBoMDirectoryStats(prefix, stats, flakyRename, WithCreateRetries(2, time.Millisecond))
+				So(err, ShouldBeNil)
+				So(failures[prefix+".CASM.tsv"+tmpSuffix], ShouldEqual, 2)
+
+				b, errr := os.ReadFile(prefix + ".CASM.tsv")
+				So(errr, ShouldBeNil)
+				So(string(b), ShouldEqual, "/\t1\t1.50\n/a\t1\t1.50\n/a/b\t1\t1.50\n")
+
+				tmps, errg := filepath.Glob(prefix + ".*" + tmpSuffix)
+				So(errg, ShouldBeNil)
+				So(tmps, ShouldBeEmpty)
+			})
+
+			Convey("and print their sizes in GBs", func() {
+				tempDir := t.TempDir()
+				prefix := filepath.Join(tempDir, "output")
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithSizeUnit(GB))
+				So(err, ShouldBeNil)
+
+				b, err := os.ReadFile(prefix + ".HumanGenetics.tsv")
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "/\t1\t2.52\n/a\t1\t2.52\n/a/c\t1\t2.52\n")
+
+				So(GB.String(), ShouldEqual, "GB")
+				So(GiB.String(), ShouldEqual, "GiB")
+			})
+
+			Convey("and print them with a metadata comment line", func() {
+				tempDir := t.TempDir()
+				prefix := filepath.Join(tempDir, "output")
+				generated := time.Date(2024, 5, 9, 13, 34, 25, 0, time.UTC)
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithMetadataComment("7y", generated))
+				So(err, ShouldBeNil)
+
+				b, err := os.ReadFile(prefix + ".CASM.tsv")
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "# stats-parse age=7y generated=2024-05-09T13:34:25Z version="+Version+
+					"\n/\t1\t1.50\n/a\t1\t1.50\n/a/b\t1\t1.50\n")
+			})
+
+			Convey("and upload them concurrently to an object store", func() {
+				u := newFakeUploader()
+
+				err = UploadBoMDirectoryStats(u, "reports/output", stats, WithBoMColumn())
+				So(err, ShouldBeNil)
+				So(len(u.uploads), ShouldEqual, 2)
+				So(u.uploads["reports/output.CASM.tsv"].String(), ShouldEqual,
+					"CASM\t/\t1\t1.50\nCASM\t/a\t1\t1.50\nCASM\t/a/b\t1\t1.50\n")
+				So(u.uploads["reports/output.HumanGenetics.tsv"].closed, ShouldBeTrue)
+				So(u.uploads["reports/output.CASM.tsv"].closed, ShouldBeTrue)
+
+				Convey("with errors aggregated after all uploads are closed", func() {
+					u = newFakeUploader()
+					u.failClose["reports/output.CASM.tsv"] = true
+					u.failUpload["reports/output.HumanGenetics.tsv"] = true
+
+					err = UploadBoMDirectoryStats(u, "reports/output", stats)
+					So(err, ShouldNotBeNil)
+					So(errors.Is(err, errFakeClose), ShouldBeTrue)
+					So(errors.Is(err, errFakeUpload), ShouldBeTrue)
+					So(u.uploads["reports/output.CASM.tsv"].closed, ShouldBeTrue)
+				})
+
+				Convey("but not with options that change which files are written", func() {
+					for _, opt := range []PrintOption{
+						WithMaxRowsPerFile(1), WithTopDirSplit(), WithColdSplit(0.5),
+						WithEmptyBoMFiles([]string{"ToL"}), WithIndex(gtb), WithStaleFileRemoval(),
+					} {
+						u = newFakeUploader()
+
+						err = UploadBoMDirectoryStats(u, "reports/output", stats, opt)
+						So(err, ShouldEqual, ErrConcurrentFileOptions)
+						So(u.uploads, ShouldBeEmpty)
+					}
+				})
+			})
+
+			Convey("and write them to a Parquet file", func() {
+				path := filepath.Join(t.TempDir(), "output.parquet")
+
+				err = WriteBoMDirectoryStatsParquet(path, stats)
+				So(err, ShouldBeNil)
+
+				rows := readParquetRows(t, path)
+				So(len(rows), ShouldEqual, 6)
+
+				So(rows[3], ShouldResemble, parquetRow{
+					BoM:       "CASM",
+					Directory: "/",
+					Count:     1,
+					SizeBytes: 1611000000,
+				})
+				So(rows[5].BoM, ShouldEqual, "CASM")
+				So(rows[5].Directory, ShouldEqual, "/a/b")
+			})
+
+			Convey("and write them to a tar archive matching the per-file output", func() {
+				tempDir := t.TempDir()
+				prefix := filepath.Join(tempDir, "output")
+
+				err = PrintBoMDirectoryStats(prefix, stats)
+				So(err, ShouldBeNil)
+
+				for _, name := range []string{"output.tar", "output.tar.gz"} {
+					tarPath := filepath.Join(tempDir, name)
+
+					err = WriteBoMDirectoryStatsTar(tarPath, stats)
+					So(err, ShouldBeNil)
+
+					members := readTarMembers(t, tarPath)
+					So(len(members), ShouldEqual, 2)
+
+					for _, bom := range []string{"HumanGenetics", "CASM"} {
+						b, err := os.ReadFile(prefix + "." + bom + ".tsv")
+						So(err, ShouldBeNil)
+						So(members[bom+".tsv"], ShouldEqual, string(b))
+					}
+				}
+			})
+
+			Convey("and print them with a BoM column in each per-BoM file", func() {
+				tempDir := t.TempDir()
+				prefix := filepath.Join(tempDir, "output")
+
+				err = PrintBoMDirectoryStats(prefix, stats, WithBoMColumn())
+				So(err, ShouldBeNil)
+
+				b, err := os.ReadFile(prefix + ".HumanGenetics.tsv")
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual,
+					"HumanGenetics\t/\t1\t2.35\nHumanGenetics\t/a\t1\t2.35\nHumanGenetics\t/a/c\t1\t2.35\n")
+
+				b, err = os.ReadFile(prefix + ".CASM.tsv")
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "CASM\t/\t1\t1.50\nCASM\t/a\t1\t1.50\nCASM\t/a/b\t1\t1.50\n")
+			})
+		})
+
+		Convey("you can get the stats in more complicated data", func() {
+			f, err := os.Open("test3.stats.gz")
+			So(err, ShouldBeNil)
+
+			defer f.Close()
+
+			gr, err := gzip.NewReader(f)
+			So(err, ShouldBeNil)
+
+			defer gr.Close()
+
+			p = NewStatsParser(gr)
+
+			stats, err := BoMDirectoryStats(p, gtb, yearsRelativeToTestFileCreation(7))
+			So(err, ShouldBeNil)
+
+			Convey("and there are no duplicates", func() {
+				dirs := make(map[string]bool)
+				dups := 0
+
+				for _, s := range stats {
+					key := string(s.BoM) + ":" + s.Directory
+					if dirs[key] {
+						dups++
+					} else {
+						dirs[key] = true
+					}
+				}
+
+				So(dups, ShouldEqual, 0)
+			})
+
+			Convey("and there are no missing directories", func() {
+				for retry := 0; retry < 10; retry++ {
+					f, err = os.Open("test3.stats.gz")
+					So(err, ShouldBeNil)
+
+					defer f.Close()
+
+					gz, err := gzip.NewReader(f)
+					So(err, ShouldBeNil)
+
+					defer gz.Close()
+
+					p = NewStatsParser(gz)
+
+					stats, err := BoMDirectoryStats(p, gtb, yearsRelativeToTestFileCreation(7))
+					So(err, ShouldBeNil)
+
+					uniqueDirs := make(map[string]bool)
+					wrongDirs := make(map[string]bool)
+
+					for _, s := range stats {
+						wrongDirs[s.Directory] = true
+
+						dirs := strings.Split(s.Directory, "/")
+						for i := 1; i < len(dirs); i++ {
+							dir := strings.Join(dirs[:i], "/")
+
+							if dir != "" {
+								uniqueDirs[dir] = true
+							}
+						}
+					}
+
+					for dir := range wrongDirs {
+						delete(uniqueDirs, dir)
+					}
+
+					So(len(uniqueDirs), ShouldEqual, 0)
+				}
+			})
+		})
+
+		Convey("you can spill stats to disk and get the same results", func() {
+			data := splitTestFile(t, "test3.stats.gz", 1)[0]
+
+			expected, err := BoMDirectoryStats(NewStatsParser(bytes.NewReader(data)), gtb,
+				yearsRelativeToTestFileCreation(0))
+			So(err, ShouldBeNil)
+			So(len(expected), ShouldBeGreaterThan, 100)
+
+			spillDir := t.TempDir()
+
+			for _, threshold := range []int{len(expected) / 8, len(expected) / 2, len(expected) * 2} {
+				stats, errs := BoMDirectoryStats(NewStatsParser(bytes.NewReader(data)), gtb,
+					yearsRelativeToTestFileCreation(0), WithSpillThreshold(threshold, spillDir))
+				So(errs, ShouldBeNil)
+				So(stats, ShouldResemble, expected)
+
+				entries, errs := os.ReadDir(spillDir)
+				So(errs, ShouldBeNil)
+				So(len(entries), ShouldEqual, 0)
+			}
+		})
+
+		Convey("you can print stats split by top level directory", func() {
+			data := statsLine("/scratch1/a/file", bytesPerGiB, 808, 0, 0, 0) +
+				statsLine("/scratch1/b/file", 2*bytesPerGiB, 808, 0, 0, 0) +
+				statsLine("/scratch2/a/file", 4*bytesPerGiB, 808, 0, 0, 0)
+
+			stats, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb,
+				yearsRelativeToTestFileCreation(7))
+			So(errb, ShouldBeNil)
+
+			prefix := filepath.Join(t.TempDir(), "output")
+
+			errb = PrintBoMDirectoryStats(prefix, stats, WithTopDirSplit())
+			So(errb, ShouldBeNil)
+
+			b, errb := os.ReadFile(prefix + ".CASM.scratch1.tsv")
+			So(errb, ShouldBeNil)
+			So(string(b), ShouldEqual, "/scratch1\t2\t3.00\n/scratch1/b\t1\t2.00\n/scratch1/a\t1\t1.00\n")
+
+			b, errb = os.ReadFile(prefix + ".CASM.scratch2.tsv")
+			So(errb, ShouldBeNil)
+			So(string(b), ShouldEqual, "/scratch2\t1\t4.00\n/scratch2/a\t1\t4.00\n")
+
+			_, errb = os.Stat(prefix + ".CASM.tsv")
+			So(errb, ShouldNotBeNil)
+		})
+
+		Convey("you can get stats with paths that only differ by case aggregated", func() {
+			data := statsLine("/Data/X/file1", 10, 808, 0, 0, 0) +
+				statsLine("/data/x/file2", 20, 808, 0, 0, 0) +
+				statsLine("/data/y/file3", 40, 808, 0, 0, 0)
+
+			sp := NewStatsParser(strings.NewReader(data))
+			sp.FoldPathCase()
+
+			stats, errb := BoMDirectoryStats(sp, gtb, yearsRelativeToTestFileCreation(7))
+			So(errb, ShouldBeNil)
+			So(len(stats), ShouldEqual, 4)
+
+			So(stats[3].Directory, ShouldEqual, "/data/x")
+			So(stats[3].Count, ShouldEqual, 2)
+			So(stats[3].Size, ShouldEqual, 30)
+
+			Convey("but not by default", func() {
+				stats, errb = BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb,
+					yearsRelativeToTestFileCreation(7))
+				So(errb, ShouldBeNil)
+				So(len(stats), ShouldEqual, 6)
+			})
+		})
+
+		Convey("you can get stats with malformed paths aggregated with their canonical form", func() {
+			data := statsLine("/a/b/file1", 1, 808, 0, 0, 0) +
+				statsLine("/a//b/file2", 2, 808, 0, 0, 0) +
+				statsLine("/a/./b/file3", 4, 808, 0, 0, 0) +
+				statsLine("//a/b/./file4", 8, 808, 0, 0, 0) +
+				statsLine("/a/../b/file5", 16, 808, 0, 0, 0)
+
+			sp := NewStatsParser(strings.NewReader(data))
+			sp.NormalisePaths()
+
+			stats, errb := BoMDirectoryStats(sp, gtb, yearsRelativeToTestFileCreation(7))
+			So(errb, ShouldBeNil)
+			So(len(stats), ShouldEqual, 5)
+
+			So(stats[0].Directory, ShouldEqual, "/")
+			So(stats[0].Size, ShouldEqual, 31)
+			So(stats[1].Directory, ShouldEqual, "/a")
+			So(stats[1].Size, ShouldEqual, 31)
+			So(stats[2].Directory, ShouldEqual, "/a/..")
+			So(stats[2].Size, ShouldEqual, 16)
+			So(stats[3].Directory, ShouldEqual, "/a/../b")
+			So(stats[3].Size, ShouldEqual, 16)
+			So(stats[4].Directory, ShouldEqual, "/a/b")
+			So(stats[4].Count, ShouldEqual, 4)
+			So(stats[4].Size, ShouldEqual, 15)
+
+			So(string(normalisePath([]byte("/./"))), ShouldEqual, "/")
+			So(string(normalisePath([]byte("/a/b/."))), ShouldEqual, "/a/b")
+
+			Convey("but not by default", func() {
+				stats, errb = BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb,
+					yearsRelativeToTestFileCreation(7))
+				So(errb, ShouldBeNil)
+				So(len(stats), ShouldBeGreaterThan, 5)
+			})
+		})
+
+		Convey("you can get stats with deep files counted in their ancestor at a capped depth", func() {
+			data := statsLine("/a/b/c/d/e/file1", 10, 808, 0, 0, 0) +
+				statsLine("/a/b/c/file2", 5, 808, 0, 0, 0) +
+				statsLine("/a/b/x/y/file3", 1, 808, 0, 0, 0)
+
+			sp := NewStatsParser(strings.NewReader(data))
+			sp.CapDepth(3)
+
+			stats, errb := BoMDirectoryStats(sp, gtb, yearsRelativeToTestFileCreation(7))
+			So(errb, ShouldBeNil)
+
+			dirs := make([]string, len(stats))
+			for i, s := range stats {
+				dirs[i] = s.Directory
+			}
+
+			So(dirs, ShouldResemble, []string{"/", "/a", "/a/b", "/a/b/c", "/a/b/x"})
+			So(stats[2].Size, ShouldEqual, 16)
+			So(stats[3].Count, ShouldEqual, 2)
+			So(stats[3].Size, ShouldEqual, 15)
+			So(stats[3].OwnCount, ShouldEqual, 2)
+			So(stats[3].OwnSize, ShouldEqual, 15)
+			So(stats[4].Size, ShouldEqual, 1)
+			So(ValidateStats(stats), ShouldBeNil)
+		})
+
+		Convey("you can report on inode usage", func() {
+			data := statsLine("/a/b/big", 1000, 1736, 0, 0, 0)
+			for i := range 5 {
+				data += statsLine(fmt.Sprintf("/a/c/tiny%d", i), 1, 808, 0, 0, 0)
+			}
+
+			data += statsLine("/a/d/tiny", 2, 808, 0, 0, 0)
+
+			stats, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb,
+				yearsRelativeToTestFileCreation(7), WithSortOrder(MostFilesFirst))
+			So(errb, ShouldBeNil)
+
+			dirs := make([]string, len(stats))
+			for i, s := range stats {
+				dirs[i] = string(s.BoM) + ":" + s.Directory
+			}
+
+			So(dirs, ShouldResemble, []string{"CASM:/", "CASM:/a", "CASM:/a/c", "HumanGenetics:/",
+				"HumanGenetics:/a", "HumanGenetics:/a/b", "CASM:/a/d"})
+
+			Convey("and only print BoMs using more than a minimum number of inodes", func() {
+				prefix := filepath.Join(t.TempDir(), "output")
+
+				errb = PrintBoMDirectoryStats(prefix, stats, WithMinBoMCount(2))
+				So(errb, ShouldBeNil)
+
+				outputs, errg := filepath.Glob(prefix + ".*")
+				So(errg, ShouldBeNil)
+				So(outputs, ShouldResemble, []string{prefix + ".CASM.tsv"})
+
+				b, errg := os.ReadFile(prefix + ".CASM.tsv")
+				So(errg, ShouldBeNil)
+				So(string(b), ShouldStartWith, "/\t6\t0.00\n/a\t6\t0.00\n/a/c\t5\t0.00\n")
+			})
+		})
+
+		Convey("you can get the stats sorted oldest first", func() {
+			data := statsLine("/a/b/file1", 5, 808, 0, 100, 0) +
+				statsLine("/a/c/file2", 10, 808, 0, 50, 0) +
+				statsLine("/a/d/file3", 45, 808, 0, 200, 0) +
+				statsLine("/a/d/file4", 1, 808, 0, 300, 0)
+
+			stats, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb,
+				yearsRelativeToTestFileCreation(7), WithSortOrder(OldestFirst))
+			So(errb, ShouldBeNil)
+
+			dirs := make([]string, len(stats))
+			for i, s := range stats {
+				dirs[i] = s.Directory
+			}
+
+			So(dirs, ShouldResemble, []string{"/", "/a", "/a/c", "/a/b", "/a/d"})
+			So(stats[0].OldestMTime, ShouldEqual, 50)
+			So(stats[4].OldestMTime, ShouldEqual, 200)
+		})
+
+		Convey("you can get the number of hardlinked files in each directory", func() {
+			data := hardlinkedStatsLine("/a/b/file1", 1) +
+				hardlinkedStatsLine("/a/b/file2", 2) +
+				hardlinkedStatsLine("/a/c/file3", 5) +
+				hardlinkedStatsLine("/a/d/file4", 1)
+
+			stats, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb,
+				yearsRelativeToTestFileCreation(7), WithSortOrder(SmallestFirst))
+			So(errb, ShouldBeNil)
+
+			hardlinked := make(map[string]uint64)
+			for _, s := range stats {
+				hardlinked[s.Directory] = s.HardlinkedFiles
+			}
+
+			So(hardlinked, ShouldResemble, map[string]uint64{"/": 2, "/a": 2, "/a/b": 1, "/a/c": 1, "/a/d": 0})
+
+			Convey("and print them in an extra column", func() {
+				prefix := filepath.Join(t.TempDir(), "output")
+
+				errb = PrintBoMDirectoryStats(prefix, stats, WithHardlinkColumn())
+				So(errb, ShouldBeNil)
+
+				b, errb := os.ReadFile(prefix + ".CASM.tsv")
+				So(errb, ShouldBeNil)
+				So(string(b), ShouldContainSubstring, "/a/b\t2\t0.00\t1\n")
+				So(string(b), ShouldContainSubstring, "/a/d\t1\t0.00\t0\n")
+			})
+		})
+
+		Convey("you can exclude the files of certain GIDs from the output", func() {
+			f, err = os.Open("test2.stats")
+			So(err, ShouldBeNil)
+
+			defer f.Close()
+
+			p = NewStatsParser(f)
+			p.FilterOutGIDs([]int{1736, 1})
+
+			stats, errb := BoMDirectoryStats(p, gtb, yearsRelativeToTestFileCreation(7))
+			So(errb, ShouldBeNil)
+			So(len(stats), ShouldEqual, 3)
+
+			prefix := filepath.Join(t.TempDir(), "output")
+
+			errb = PrintBoMDirectoryStats(prefix, stats)
+			So(errb, ShouldBeNil)
+
+			outputs, errb := filepath.Glob(prefix + ".*")
+			So(errb, ShouldBeNil)
+			So(outputs, ShouldResemble, []string{prefix + ".CASM.tsv"})
+		})
+
+		Convey("or of ranges of GIDs", func() {
+			f, err = os.Open("test2.stats")
+			So(err, ShouldBeNil)
+
+			defer f.Close()
+
+			p = NewStatsParser(f)
+			p.FilterOutGIDRanges([]GIDRange{{0, 1}, {1000, 1800}})
+
+			stats, errb := BoMDirectoryStats(p, gtb, yearsRelativeToTestFileCreation(7))
+			So(errb, ShouldBeNil)
+			So(len(stats), ShouldEqual, 3)
+		})
+
+		Convey("aggregating without an age filter is an error", func() {
+			data := statsLine("/a/new", 1, 808, 0, time.Now().Unix(), time.Now().Unix())
+
+			p = NewStatsParser(strings.NewReader(data))
+			So(p.AgeFiltered(), ShouldBeFalse)
+
+			_, errb := getBoMDirectoryStats(p, gtb, newStatsOptions(nil))
+			So(errb, ShouldEqual, ErrNoAgeFilter)
+
+			_, errb = spillingBoMDirectoryStats(p, gtb, newStatsOptions([]StatsOption{WithSpillThreshold(1, "")}))
+			So(errb, ShouldEqual, ErrNoAgeFilter)
+
+			p.FilterForFilesOlderThan(time.Hour)
+			So(p.AgeFiltered(), ShouldBeTrue)
+
+			stats, errb := getBoMDirectoryStats(p, gtb, newStatsOptions(nil))
+			So(errb, ShouldBeNil)
+			So(len(stats), ShouldEqual, 0)
+		})
+
+		Convey("you can restrict the stats to those within a root directory", func() {
+			const root = "/lustre/scratch122/tol"
+
+			all, errb := BoMDirectoryStats(NewStatsParser(testStatsReader(t)), gtb, time.Nanosecond)
+			So(errb, ShouldBeNil)
+
+			stats, errb := BoMDirectoryStats(NewStatsParser(testStatsReader(t)), gtb, time.Nanosecond,
+				WithRoot(root+"/"))
+			So(errb, ShouldBeNil)
+			So(len(stats), ShouldBeGreaterThan, 1)
+
+			expected := make(map[string]*Stats)
+
+			for _, s := range all {
+				if s.Directory == root || strings.HasPrefix(s.Directory, root+"/") {
+					expected[bomDirKey(s.BoM, s.Directory)] = s
+				}
+			}
+
+			So(len(stats), ShouldEqual, len(expected))
+
+			for _, s := range stats {
+				So(s.Directory == root || strings.HasPrefix(s.Directory, root+"/"), ShouldBeTrue)
+				So(s, ShouldResemble, expected[bomDirKey(s.BoM, s.Directory)])
+			}
+
+			So(stats[0].Directory, ShouldEqual, root)
+		})
+
+		Convey("you can aggregate by a key extracted from paths", func() {
+			data := statsLine("/lustre/a/project_ABC123/x", 1, 808, 0, 0, 0) +
+				statsLine("/lustre/b/project_ABC123/y/z", 2, 808, 0, 0, 0) +
+				statsLine("/lustre/project_XYZ9/z", 4, 808, 0, 0, 0) +
+				statsLine("/lustre/other/file", 8, 808, 0, 0, 0) +
+				statsLine("/lustre/project_XYZ9/w", 16, 1736, 0, 0, 0)
+
+			stats, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, time.Hour,
+				WithPathKey(regexp.MustCompile(`/project_([^/]+)/`)))
+			So(errb, ShouldBeNil)
+
+			keyed := make(map[string]*Stats)
+			for _, s := range stats {
+				keyed[string(s.BoM)+":"+s.Directory] = s
+			}
+
+			So(len(keyed), ShouldEqual, 4)
+			So(keyed["CASM:ABC123"].Count, ShouldEqual, 2)
+			So(keyed["CASM:ABC123"].Size, ShouldEqual, 3)
+			So(keyed["CASM:XYZ9"].Size, ShouldEqual, 4)
+			So(keyed["CASM:unmatched"].Size, ShouldEqual, 8)
+			So(keyed["HumanGenetics:XYZ9"].Size, ShouldEqual, 16)
+
+			_, errb = BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, time.Hour,
+				WithPathKey(regexp.MustCompile(`/project_`)))
+			So(errb, ShouldEqual, ErrNoCapture)
+		})
+
+		Convey("the min and max file sizes of each directory are tracked", func() {
+			data := statsLine("/a/b/small", 3, 808, 0, 0, 0) +
+				statsLine("/a/b/empty", 0, 808, 0, 0, 0) +
+				statsLine("/a/b/c/huge", 1000, 808, 0, 0, 0) +
+				statsLine("/a/d/medium", 50, 808, 0, 0, 0) +
+				statsLine("/a/e/empty", 0, 808, 0, 0, 0)
+
+			dirStats := func(opts ...StatsOption) map[string]*Stats {
+				stats, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, time.Hour, opts...)
+				So(errb, ShouldBeNil)
+
+				byDir := make(map[string]*Stats)
+				for _, s := range stats {
+					byDir[s.Directory] = s
+				}
+
+				return byDir
+			}
+
+			byDir := dirStats()
+			So(byDir["/a"].MinSize, ShouldEqual, 3)
+			So(byDir["/a"].MaxSize, ShouldEqual, 1000)
+			So(byDir["/a"].EmptyFiles, ShouldEqual, 2)
+			So(byDir["/a/b"].MinSize, ShouldEqual, 3)
+			So(byDir["/a/b"].MaxSize, ShouldEqual, 1000)
+			So(byDir["/a/d"].MinSize, ShouldEqual, 50)
+			So(byDir["/a/d"].MaxSize, ShouldEqual, 50)
+			So(byDir["/a/e"].MinSize, ShouldEqual, 0)
+			So(byDir["/a/e"].MaxSize, ShouldEqual, 0)
+
+			byDir = dirStats(WithEmptyFilesInMinSize())
+			So(byDir["/a"].MinSize, ShouldEqual, 0)
+			So(byDir["/a/b"].MinSize, ShouldEqual, 0)
+			So(byDir["/a/d"].MinSize, ShouldEqual, 50)
+			So(byDir["/a/b"].MaxSize, ShouldEqual, 1000)
+		})
+
+		Convey("you can total the path lengths of the files in each directory", func() {
+			paths := []string{"/a/b/file1", "/a/b/c/longer_file_name", "/a/d/x"}
+
+			var data string
+			for _, path := range paths {
+				data += statsLine(path, 1, 808, 0, 0, 0)
+			}
+
+			stats, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, time.Hour, WithPathBytes())
+			So(errb, ShouldBeNil)
+
+			byDir := make(map[string]*Stats)
+			for _, s := range stats {
+				byDir[s.Directory] = s
+			}
+
+			So(byDir["/a/b"].PathBytes, ShouldEqual, len(paths[0])+len(paths[1]))
+			So(byDir["/a/b/c"].PathBytes, ShouldEqual, len(paths[1]))
+			So(byDir["/a"].PathBytes, ShouldEqual, len(paths[0])+len(paths[1])+len(paths[2]))
+
+			stats, errb = BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, time.Hour)
+			So(errb, ShouldBeNil)
+			So(stats[0].PathBytes, ShouldEqual, 0)
+
+			recent := time.Now().Unix()
+			young := "/a/b/young_file"
+			data += statsLine(young, 1, 808, recent, recent, recent)
+
+			stats, errb = BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, time.Hour,
+				WithPathBytes(), WithTotals())
+			So(errb, ShouldBeNil)
+
+			byDir = make(map[string]*Stats)
+			for _, s := range stats {
+				byDir[s.Directory] = s
+			}
+
+			So(byDir["/a/b"].TotalCount, ShouldEqual, 3)
+			So(byDir["/a/b"].PathBytes, ShouldEqual, len(paths[0])+len(paths[1]))
+			So(byDir["/a"].PathBytes, ShouldEqual, len(paths[0])+len(paths[1])+len(paths[2]))
+		})
+
+		Convey("you can get the fraction of each directory that is old", func() {
+			old := time.Now().Add(-2 * year).Unix()
+			recent := time.Now().Unix()
+
+			data := statsLine("/a/b/old1", 30, 808, 0, old, old) +
+				statsLine("/a/b/old2", 60, 808, 0, old, old) +
+				statsLine("/a/b/new", 10, 808, 0, recent, recent) +
+				statsLine("/a/c/new", 100, 808, 0, recent, recent) +
+				statsLine("/a/d/old", 5, 808, 0, old, old)
+
+			byDir := func(stats []*Stats) map[string]*Stats {
+				dirs := make(map[string]*Stats)
+				for _, s := range stats {
+					dirs[s.Directory] = s
+				}
+
+				return dirs
+			}
+
+			stats, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, year, WithTotals())
+			So(errb, ShouldBeNil)
+
+			dirs := byDir(stats)
+			So(len(dirs), ShouldEqual, 4)
+			So(dirs["/a/c"], ShouldBeNil)
+			So(dirs["/a/b"].Count, ShouldEqual, 2)
+			So(dirs["/a/b"].Size, ShouldEqual, 90)
+			So(dirs["/a/b"].TotalCount, ShouldEqual, 3)
+			So(dirs["/a/b"].TotalSize, ShouldEqual, 100)
+			So(dirs["/a/b"].ColdFraction(), ShouldAlmostEqual, 0.9)
+			So(dirs["/a"].TotalSize, ShouldEqual, 205)
+			So(dirs["/a"].ColdFraction(), ShouldAlmostEqual, 95.0/205)
+			So(dirs["/a/d"].ColdFraction(), ShouldEqual, 1)
+			So(ValidateStats(stats), ShouldBeNil)
+
+			stats, errb = BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, year,
+				WithMinColdFraction(0.9), WithSortOrder(ColdestFirst))
+			So(errb, ShouldBeNil)
+			So(len(stats), ShouldEqual, 2)
+			So(stats[0].Directory, ShouldEqual, "/a/d")
+			So(stats[1].Directory, ShouldEqual, "/a/b")
+
+			prefix := filepath.Join(t.TempDir(), "output")
+
+			So(PrintBoMDirectoryStats(prefix, stats, WithColdFractionColumn(), WithBytesColumn()), ShouldBeNil)
+
+			b, errr := os.ReadFile(prefix + ".CASM.tsv")
+			So(errr, ShouldBeNil)
+			So(string(b), ShouldEqual, "directory\tcount\tbytes\tGiB\tcold_fraction\n"+
+				"/a/d\t1\t5\t0.00\t1.0000\n/a/b\t2\t90\t0.00\t0.9000\n")
+
+			Convey("and split the output in to cold and recent files", func() {
+				data += statsLine("/a/e/old", 40, 808, 0, old, old) +
+					statsLine("/a/e/new", 60, 808, 0, recent, recent) +
+					statsLine("/a/f/old", 50, 808, 0, old, old) +
+					statsLine("/a/f/new", 50, 808, 0, recent, recent)
+
+				stats, errb = BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, year,
+					WithTotals())
+				So(errb, ShouldBeNil)
+
+				prefix = filepath.Join(t.TempDir(), "output")
+
+				So(PrintBoMDirectoryStats(prefix, stats, WithColdSplit(0.5), WithColdFractionColumn(),
+					WithBytesColumn()), ShouldBeNil)
+
+				b, errr = os.ReadFile(prefix + ".CASM.cold.tsv")
+				So(errr, ShouldBeNil)
+				So(string(b), ShouldEqual, "directory\tcount\tbytes\tGiB\tcold_fraction\n"+
+					"/a/b\t2\t90\t0.00\t0.9000\n/a/f\t1\t50\t0.00\t0.5000\n/a/d\t1\t5\t0.00\t1.0000\n")
+
+				b, errr = os.ReadFile(prefix + ".CASM.recent.tsv")
+				So(errr, ShouldBeNil)
+				So(string(b), ShouldEqual, "directory\tcount\tbytes\tGiB\tcold_fraction\n"+
+					"/\t5\t185\t0.00\t0.4568\n/a\t5\t185\t0.00\t0.4568\n/a/e\t1\t40\t0.00\t0.4000\n")
+
+				_, errr = os.Stat(prefix + ".CASM.tsv")
+				So(errr, ShouldNotBeNil)
+			})
+		})
+
+		Convey("you can get the cost of each directory with per-GID rates", func() {
+			data := statsLine("/a/x", 100, 808, 0, 0, 0) +
+				statsLine("/a/y", 200, 1798, 0, 0, 0) +
+				statsLine("/a/b/z", 10, 15532, 0, 0, 0)
+
+			stats, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, time.Hour,
+				WithGIDCosts(map[int64]float64{808: 0.5, 1798: 0.25}, 2))
+			So(errb, ShouldBeNil)
+			So(len(stats), ShouldEqual, 3)
+			So(stats[0].Directory, ShouldEqual, "/")
+			So(stats[0].Cost, ShouldAlmostEqual, 120)
+			So(stats[1].Directory, ShouldEqual, "/a")
+			So(stats[1].Cost, ShouldAlmostEqual, 120)
+			So(stats[2].Directory, ShouldEqual, "/a/b")
+			So(stats[2].Cost, ShouldAlmostEqual, 20)
+
+			prefix := filepath.Join(t.TempDir(), "output")
+
+			So(PrintBoMDirectoryStats(prefix, stats, WithCostColumn(), WithBytesColumn()), ShouldBeNil)
+
+			b, errr := os.ReadFile(prefix + ".CASM.tsv")
+			So(errr, ShouldBeNil)
+			So(string(b), ShouldEqual, "directory\tcount\tbytes\tGiB\tcost\n"+
+				"/\t3\t310\t0.00\t120.00\n/a\t3\t310\t0.00\t120.00\n/a/b\t1\t10\t0.00\t20.00\n")
+
+			stats, errb = BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, time.Hour)
+			So(errb, ShouldBeNil)
+			So(stats[0].Cost, ShouldEqual, 0)
+		})
+
+		Convey("you can attribute files to the nearest of some project roots", func() {
+			data := statsLine("/lustre/projA/x", 1, 808, 0, 0, 0) +
+				statsLine("/lustre/projA/sub/y", 2, 808, 0, 0, 0) +
+				statsLine("/lustre/projA/nested/z", 4, 808, 0, 0, 0) +
+				statsLine("/lustre/projB/w", 8, 808, 0, 0, 0) +
+				statsLine("/lustre/projAB/v", 16, 808, 0, 0, 0) +
+				statsLine("/lustre/u", 32, 808, 0, 0, 0)
+
+			stats, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, time.Hour,
+				WithProjectRoots([]string{"/lustre/projA", "/lustre/projB/", "/lustre/projA/nested"}))
+			So(errb, ShouldBeNil)
+
+			byRoot := make(map[string]*Stats)
+			for _, s := range stats {
+				byRoot[s.Directory] = s
+			}
+
+			So(len(byRoot), ShouldEqual, 4)
+			So(byRoot["/lustre/projA"].Count, ShouldEqual, 2)
+			So(byRoot["/lustre/projA"].Size, ShouldEqual, 3)
+			So(byRoot["/lustre/projA/nested"].Size, ShouldEqual, 4)
+			So(byRoot["/lustre/projB"].Size, ShouldEqual, 8)
+			So(byRoot["other"].Count, ShouldEqual, 2)
+			So(byRoot["other"].Size, ShouldEqual, 48)
+		})
+
+		Convey("you can skip pathologically deep paths", func() {
+			logs := captureLogs()
+
+			deep := strings.Repeat("/d", 300) + "/file"
+			data := statsLine("/a/b/file", 1, 808, 0, 0, 0) + statsLine(deep, 2, 808, 0, 0, 0)
+
+			p = NewStatsParser(strings.NewReader(data))
+			p.MaxPathSegments(100)
+
+			stats, errb := BoMDirectoryStats(p, gtb, time.Hour)
+			So(errb, ShouldBeNil)
+			So(len(stats), ShouldEqual, 3)
+			So(stats[0].Size, ShouldEqual, 1)
+			So(p.TooDeep(), ShouldEqual, 1)
+			So(logs.String(), ShouldBeEmpty)
+
+			Convey("which the CLI warns about", func() {
+				opts, err := parseArgs([]string{"-b", "bom.gids", "-max-segments", "100"})
+				So(err, ShouldBeNil)
+
+				p = newConfiguredParser(strings.NewReader(data), opts)
+
+				parseStats(p, gtb, opts)
+				So(logs.String(), ShouldContainSubstring, "skipped 1 paths with more than 100 segments")
+			})
+		})
+
+		Convey("you can use different ages for different BoMs", func() {
+			ago := func(years int) int64 {
+				return time.Now().Add(-time.Duration(years) * year).Unix()
+			}
+
+			data := statsLine("/casm/5y", 1, 808, 0, ago(5), ago(5)) +
+				statsLine("/casm/1y", 2, 808, 0, ago(1), ago(1)) +
+				statsLine("/tol/5y", 4, 15295, 0, ago(5), ago(5)) +
+				statsLine("/tol/12y", 8, 15295, 0, ago(12), ago(12)) +
+				statsLine("/hg/8y", 16, 1736, 0, ago(8), ago(8)) +
+				statsLine("/hg/6y", 32, 1736, 0, ago(6), ago(6))
+
+			ages := WithBoMAges(map[string]time.Duration{"CASM": 3 * year, "ToL": 10 * year})
+
+			rootSizes := func(stats []*Stats) map[string]int64 {
+				sizes := make(map[string]int64)
+
+				for _, s := range stats {
+					if s.Directory == "/" {
+						sizes[string(s.BoM)] = s.Size
+					}
+				}
+
+				return sizes
+			}
+
+			expected := map[string]int64{"CASM": 1, "ToL": 8, "HumanGenetics": 16}
+
+			stats, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, 7*year, ages)
+			So(errb, ShouldBeNil)
+			So(rootSizes(stats), ShouldResemble, expected)
+
+			stats, errb = BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb, 7*year, ages,
+				WithSpillThreshold(1, t.TempDir()))
+			So(errb, ShouldBeNil)
+			So(rootSizes(stats), ShouldResemble, expected)
+		})
+
+		Convey("you can get the stats sorted smallest first", func() {
+			data := statsLine("/a/b/big", 30, 808, 0, 0, 0) +
+				statsLine("/a/c/small", 10, 808, 0, 0, 0) +
+				statsLine("/a/d/e/empty", 0, 808, 0, 0, 0) +
+				statsLine("/a/f/empty", 0, 808, 0, 0, 0)
+
+			stats, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader(data)), gtb,
+				yearsRelativeToTestFileCreation(7), WithSortOrder(SmallestFirst))
+			So(errb, ShouldBeNil)
+
+			dirs := make([]string, len(stats))
+			for i, s := range stats {
+				dirs[i] = s.Directory
+			}
+
+			So(dirs, ShouldResemble, []string{"/a/d", "/a/f", "/a/d/e", "/a/c", "/a/b", "/", "/a"})
+		})
+
+		Convey("you can get the stats for multiple ages in one pass", func() {
+			cutoffs := []time.Duration{
+				yearsRelativeToTestFileCreation(3),
+				yearsRelativeToTestFileCreation(5),
+				yearsRelativeToTestFileCreation(7),
+			}
+
+			results, errb := BoMDirectoryStatsMultiAge(p, gtb, cutoffs)
+			So(errb, ShouldBeNil)
+			So(len(results), ShouldEqual, 3)
+
+			expected, errb := BoMDirectoryStats(NewStatsParser(testStatsReader(t)), gtb, cutoffs[2])
+			So(errb, ShouldBeNil)
+			So(results[cutoffs[2]], ShouldResemble, expected)
+
+			byDir := func(stats []*Stats) map[string]*Stats {
+				m := make(map[string]*Stats, len(stats))
+				for _, s := range stats {
+					m[string(s.BoM)+s.Directory] = s
+				}
+
+				return m
+			}
+
+			three, five := byDir(results[cutoffs[0]]), byDir(results[cutoffs[1]])
+			So(len(three), ShouldBeGreaterThan, len(five))
+
+			for key, s5 := range five {
+				So(three[key], ShouldNotBeNil)
+				So(s5.Count, ShouldBeLessThanOrEqualTo, three[key].Count)
+			}
+
+			for _, s7 := range results[cutoffs[2]] {
+				s5 := five[string(s7.BoM)+s7.Directory]
+				So(s5, ShouldNotBeNil)
+				So(s7.Count, ShouldBeLessThanOrEqualTo, s5.Count)
+				So(s7.Size, ShouldBeLessThanOrEqualTo, s5.Size)
+			}
+
+			Convey("relative to the parser's SetNow() time", func() {
+				collected := time.Unix(epochWhenTestFileWasCreated, 0)
+				seven := 7 * year
+
+				sp := NewStatsParser(testStatsReader(t))
+				sp.SetNow(collected)
+
+				results, errb = BoMDirectoryStatsMultiAge(sp, gtb, []time.Duration{seven})
+				So(errb, ShouldBeNil)
+
+				sp = NewStatsParser(testStatsReader(t))
+				sp.SetNow(collected)
+
+				expected, errb = BoMDirectoryStats(sp, gtb, seven)
+				So(errb, ShouldBeNil)
+				So(results[seven], ShouldResemble, expected)
+				So(results[seven], ShouldNotResemble, results[cutoffs[2]])
+			})
+		})
+
+		Convey("ErrNoData is returned when there is no data at all", func() {
+			stats, errb := BoMDirectoryStats(NewStatsParser(strings.NewReader("")), gtb,
+				yearsRelativeToTestFileCreation(7))
+			So(errb, ShouldEqual, ErrNoData)
+			So(len(stats), ShouldEqual, 0)
+
+			_, counts, errb := BoMDirectoryStatsWithCounts(NewStatsParser(strings.NewReader("")), gtb,
+				yearsRelativeToTestFileCreation(7))
+			So(errb, ShouldEqual, ErrNoData)
+			So(len(counts), ShouldEqual, 0)
+
+			Convey("but not when there is data that just isn't old enough", func() {
+				stats, errb = BoMDirectoryStats(p, gtb, yearsRelativeToTestFileCreation(100))
+				So(errb, ShouldBeNil)
+				So(len(stats), ShouldEqual, 0)
+				So(p.EntriesParsed(), ShouldEqual, 18890)
+			})
+		})
+
+		Convey("you can split each BoM's output in to parts", func() {
+			stats, errb := BoMDirectoryStats(p, gtb, time.Nanosecond)
+			So(errb, ShouldBeNil)
+
+			dir := t.TempDir()
+			whole := filepath.Join(dir, "whole")
+			parts := filepath.Join(dir, "parts")
+
+			So(PrintBoMDirectoryStats(whole, stats, WithBytesColumn()), ShouldBeNil)
+			So(PrintBoMDirectoryStats(parts, stats, WithBytesColumn(), WithMaxRowsPerFile(100)), ShouldBeNil)
+
+			expected, errr := os.ReadFile(whole + ".ToL.tsv")
+			So(errr, ShouldBeNil)
+
+			header, rows, _ := strings.Cut(string(expected), "\n")
+			numRows := strings.Count(rows, "\n")
+			So(numRows, ShouldBeGreaterThan, 100)
+
+			partFiles, errg := filepath.Glob(parts + ".ToL.part*.tsv")
+			So(errg, ShouldBeNil)
+			So(len(partFiles), ShouldEqual, (numRows+99)/100)
+			So(partFiles[0], ShouldEqual, parts+".ToL.part0001.tsv")
+
+			var joined strings.Builder
+
+			for _, partFile := range partFiles {
+				b, errp := os.ReadFile(partFile)
+				So(errp, ShouldBeNil)
+
+				partHeader, partRows, _ := strings.Cut(string(b), "\n")
+				So(partHeader, ShouldEqual, header)
+				So(strings.Count(partRows, "\n"), ShouldBeLessThanOrEqualTo, 100)
+
+				joined.WriteString(partRows)
+			}
+
+			So(joined.String(), ShouldEqual, rows)
+		})
+
+		Convey("an error is provided when bad data is given", func() {
+			p = NewStatsParser(strings.NewReader("this is invalid since there's no tabs\n"))
+			_, err := BoMDirectoryStats(p, gtb, yearsRelativeToTestFileCreation(7))
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given output files from different shards", t, func() {
+		dir := t.TempDir()
+		shard1 := filepath.Join(dir, "shard1.ToL.tsv")
+		shard2 := filepath.Join(dir, "shard2.ToL.tsv")
+
+		err := os.WriteFile(shard1, []byte("directory\tcount\tbytes\tGiB\n"+
+			"/\t3\t300\t0.00\n/a\t2\t200\t0.00\n/a/b\t1\t100\t0.00\n"), 0600)
+		So(err, ShouldBeNil)
+
+		err = os.WriteFile(shard2, []byte("directory\tcount\tbytes\tGiB\n"+
+			"/\t5\t1000\t0.00\n/a\t5\t1000\t0.00\n/a/c\t5\t1000\t0.00\n"), 0600)
+		So(err, ShouldBeNil)
+
+		Convey("you can merge them, summing the totals of each directory", func() {
+			stats, errm := mergeOutputFiles([]string{shard1, shard2}, ParseStatsTSV)
+			So(errm, ShouldBeNil)
+			So(len(stats), ShouldEqual, 4)
+
+			So(string(stats[0].BoM), ShouldEqual, "ToL")
+			So(stats[0].Directory, ShouldEqual, "/")
+			So(stats[0].Count, ShouldEqual, 8)
+			So(stats[0].Size, ShouldEqual, 1300)
+			So(stats[1].Directory, ShouldEqual, "/a")
+			So(stats[1].Count, ShouldEqual, 7)
+			So(stats[1].Size, ShouldEqual, 1200)
+			So(stats[2].Directory, ShouldEqual, "/a/c")
+			So(stats[3].Directory, ShouldEqual, "/a/b")
+			So(stats[3].Size, ShouldEqual, 100)
+
+			prefix := filepath.Join(dir, "combined")
+			So(PrintBoMDirectoryStats(prefix, stats, WithBytesColumn()), ShouldBeNil)
+
+			b, errr := os.ReadFile(prefix + ".ToL.tsv")
+			So(errr, ShouldBeNil)
+			So(string(b), ShouldEqual, "directory\tcount\tbytes\tGiB\n"+
+				"/\t8\t1300\t0.00\n/a\t7\t1200\t0.00\n/a/c\t5\t1000\t0.00\n/a/b\t1\t100\t0.00\n")
+		})
+
+		Convey("you can only merge legacy files without a header when told their unit", func() {
+			legacy := filepath.Join(dir, "shard3.ToL.tsv")
+
+			err = os.WriteFile(legacy, []byte("/\t1\t1.00\n"), 0600)
+			So(err, ShouldBeNil)
+
+			_, errm := mergeOutputFiles([]string{shard1, legacy}, ParseStatsTSV)
+			So(errors.Is(errm, ErrNoStatsTSVHeader), ShouldBeTrue)
+
+			stats, errm := mergeOutputFiles([]string{shard1, legacy}, newStatsTSVParser(true, GB))
+			So(errm, ShouldBeNil)
+			So(stats[0].Directory, ShouldEqual, "/")
+			So(stats[0].Count, ShouldEqual, 4)
+			So(stats[0].Size, ShouldEqual, 300+1000000000)
+		})
+
+		Convey("merging fails on a missing file", func() {
+			_, errm := mergeOutputFiles([]string{shard1, filepath.Join(dir, "missing.ToL.tsv")}, ParseStatsTSV)
+			So(errm, ShouldNotBeNil)
+		})
+	})
+
+	Convey("-since-file can be a previous output file that this run replaces", t, func() {
+		gtb := openTestGIDToBoM(t)
+		prefix := filepath.Join(t.TempDir(), "run")
+		casm := func(count uint64, size int64) []*Stats {
+			return []*Stats{
+				{BoM: []byte("CASM"), Directory: "/", Count: count, Size: size},
+				{BoM: []byte("CASM"), Directory: "/a", Count: count, Size: size},
+			}
+		}
+
+		opts, err := parseArgs([]string{"-b", "bom.gids", "-gb", "-clean", "-o", prefix})
+		So(err, ShouldBeNil)
+
+		writeOutputs(gtb, opts, casm(1, bytesPerGB))
+
+		opts, err = parseArgs([]string{"-b", "bom.gids", "-gb", "-clean", "-o", prefix,
+			"-since-file", prefix + ".CASM.tsv"})
+		So(err, ShouldBeNil)
+
+		writeOutputs(gtb, opts, casm(2, 6*bytesPerGB))
+
+		b, err := os.ReadFile(prefix + ".CASM.delta.tsv")
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "/\t1\t5.00\n/a\t1\t5.00\n")
+
+		b, err = os.ReadFile(prefix + ".CASM.tsv")
+		So(err, ShouldBeNil)
+		So(string(b), ShouldContainSubstring, "/a\t2\t6000000000\t6.00\n")
+	})
+
+	Convey("The BoM of an output file can be found from its name", t, func() {
+		for path, expected := range map[string]struct {
+			bom     string
+			partial bool
+		}{
+			"/old/output.CASM.tsv":                 {"CASM", false},
+			"/old/output.CASM.part0002.tsv":        {"CASM", true},
+			"/old/output.CASM.cold.tsv":            {"CASM", true},
+			"/old/output.CASM.recent.part0001.tsv": {"CASM", true},
+		} {
+			bom, partial, err := bomFromOutputFile(path)
+			So(err, ShouldBeNil)
+			So(bom, ShouldEqual, expected.bom)
+			So(partial, ShouldEqual, expected.partial)
+		}
+
+		for _, path := range []string{
+			"/old/CASM.tsv", "/old/output.CASM.txt", "/old/output..tsv", "/old/output.cold.tsv", "/old/.CASM.tsv",
+			"/old/my.output.CASM.tsv", "/old/run.CASM.a.tsv", "/old/run.CASM.delta.tsv", "/old/run.CASM.a.cold.tsv",
+		} {
+			_, _, err := bomFromOutputFile(path)
+			So(errors.Is(err, ErrBadOutputName), ShouldBeTrue)
+		}
+
+		Convey("or from the index.tsv next to it, which handles top directory splits", func() {
+			dir := t.TempDir()
+			prefix := filepath.Join(dir, "output")
+			stats := []*Stats{
+				{BoM: []byte("HumanGenetics"), Directory: "/", Count: 2, Size: 2},
+				{BoM: []byte("HumanGenetics"), Directory: "/a.b", Count: 1, Size: 1},
+				{BoM: []byte("HumanGenetics"), Directory: "/c", Count: 1, Size: 1},
+				{BoM: []byte("ToL"), Directory: "/", Count: 1, Size: 1},
+				{BoM: []byte("ToL"), Directory: "/x", Count: 1, Size: 1},
+			}
+
+			gtb, err := NewGIDToBoM(strings.NewReader("Human Genetics\t1\nToL\t2\n"))
+			So(err, ShouldBeNil)
+
+			So(PrintBoMDirectoryStats(prefix, stats, WithTopDirSplit(), WithIndex(gtb)), ShouldBeNil)
+
+			bom, partial, err := bomFromOutputFile(prefix + ".HumanGenetics.a.b.tsv")
+			So(err, ShouldBeNil)
+			So(bom, ShouldEqual, "HumanGenetics")
+			So(partial, ShouldBeTrue)
+
+			bom, partial, err = bomFromOutputFile(prefix + ".ToL.x.tsv")
+			So(err, ShouldBeNil)
+			So(bom, ShouldEqual, "ToL")
+			So(partial, ShouldBeFalse)
+		})
+	})
+}
+
+func TestBoMDirectoryStatsParallel(t *testing.T) {
+	Convey("Given stats data split in to parts and a GIDToBoM", t, func() {
+		parts := splitTestFile(t, "test3.stats.gz", 3)
+		gtb := openTestGIDToBoM(t)
+
+		serial, err := BoMDirectoryStats(NewStatsParser(bytes.NewReader(bytes.Join(parts, nil))),
+			gtb, yearsRelativeToTestFileCreation(7))
+		So(err, ShouldBeNil)
+		So(len(serial), ShouldBeGreaterThan, 0)
+
+		Convey("sharded parallel stats exactly match the serial stats", func() {
+			for _, shards := range []int{1, 4, 16} {
+				sps := make([]*StatsParser, len(parts))
+				for i, part := range parts {
+					sps[i] = NewStatsParser(bytes.NewReader(part))
+				}
+
+				stats, errp := BoMDirectoryStatsParallel(sps, gtb, yearsRelativeToTestFileCreation(7), shards)
+				So(errp, ShouldBeNil)
+				So(stats, ShouldResemble, serial)
+			}
+		})
+
+		Convey("you can record the read throughput of each input", func() {
+			small := parts[0][:len(parts[0])/2]
+			small = small[:bytes.LastIndexByte(small, '\n')+1]
+
+			readers := []*ThroughputReader{
+				NewThroughputReader("big", bytes.NewReader(parts[1])),
+				NewThroughputReader("small", bytes.NewReader(small)),
+			}
+
+			sps := make([]*StatsParser, len(readers))
+			for i, r := range readers {
+				sps[i] = NewStatsParser(r)
+			}
+
+			_, errp := BoMDirectoryStatsParallel(sps, gtb, yearsRelativeToTestFileCreation(7), 4)
+			So(errp, ShouldBeNil)
+
+			throughputs := []*Throughput{readers[0].Throughput(), readers[1].Throughput()}
+			So(throughputs[0].Name, ShouldEqual, "big")
+			So(throughputs[0].Bytes, ShouldEqual, len(parts[1]))
+			So(throughputs[1].Name, ShouldEqual, "small")
+			So(throughputs[1].Bytes, ShouldEqual, len(small))
+			So(throughputs[1].Bytes, ShouldBeLessThan, throughputs[0].Bytes)
+
+			for _, tp := range throughputs {
+				So(tp.Duration, ShouldBeGreaterThan, 0)
+				So(tp.MBPerSec(), ShouldBeGreaterThan, 0)
+			}
+
+			var buf bytes.Buffer
+
+			So(WriteThroughputReport(&buf, throughputs), ShouldBeNil)
+
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			So(len(lines), ShouldEqual, 2)
+			So(lines[1], ShouldStartWith, fmt.Sprintf("small\t%d\t", len(small)))
+		})
+
+		Convey("you must have at least 1 shard", func() {
+			_, err = BoMDirectoryStatsParallel([]*StatsParser{NewStatsParser(bytes.NewReader(parts[0]))},
+				gtb, yearsRelativeToTestFileCreation(7), 0)
+			So(err, ShouldEqual, ErrNoShards)
+		})
+
+		Convey("errors from any worker are returned", func() {
+			sps := []*StatsParser{
+				NewStatsParser(bytes.NewReader(parts[0])),
+				NewStatsParser(strings.NewReader("this is invalid since there's no tabs\n")),
+			}
+
+			_, err = BoMDirectoryStatsParallel(sps, gtb, yearsRelativeToTestFileCreation(7), 4)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+const (
+	errFakeUpload = Error("upload failed")
+	errFakeClose  = Error("upload completion failed")
+)
+
+// fakeUploader is an Uploader that stores uploads in memory.
+type fakeUploader struct {
+	mu         sync.Mutex
+	uploads    map[string]*fakeUpload
+	failUpload map[string]bool
+	failClose  map[string]bool
+}
+
+func newFakeUploader() *fakeUploader {
+	return &fakeUploader{
+		uploads:    make(map[string]*fakeUpload),
+		failUpload: make(map[string]bool),
+		failClose:  make(map[string]bool),
+	}
+}
+
+func (f *fakeUploader) Upload(key string) (io.WriteCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failUpload[key] {
+		return nil, errFakeUpload
+	}
+
+	upload := &fakeUpload{failClose: f.failClose[key]}
+	f.uploads[key] = upload
+
+	return upload, nil
+}
+
+type fakeUpload struct {
+	bytes.Buffer
+	closed    bool
+	failClose bool
+}
+
+func (f *fakeUpload) Close() error {
+	f.closed = true
+
+	if f.failClose {
+		return errFakeClose
+	}
+
+	return nil
+}
+
+// statsLine returns a line of wrstat stats data for a file with the given
+// path, size, gid and times.
+func statsLine(path string, size, gid, atime, mtime, ctime int64) string {
+	return fmt.Sprintf("%s\t%d\t1\t%d\t%d\t%d\t%d\tf\t1\t1\t1\n",
+		base64.StdEncoding.EncodeToString([]byte(path)), size, gid, atime, mtime, ctime)
+}
+
+// hardlinkedStatsLine returns a line of stats data for an old CASM file with the
+// given path and number of hardlinks.
+func hardlinkedStatsLine(path string, nlink int) string {
+	return fmt.Sprintf("%s\t1\t1\t808\t0\t0\t0\tf\t1\t%d\t1\n",
+		base64.StdEncoding.EncodeToString([]byte(path)), nlink)
+}
+
+// ownedStatsLine returns a line of stats data for an old CASM file with the
+// given path, size and UID.
+func ownedStatsLine(path string, size, uid int64) string {
+	return fmt.Sprintf("%s\t%d\t%d\t808\t0\t0\t0\tf\t1\t1\t1\n",
+		base64.StdEncoding.EncodeToString([]byte(path)), size, uid)
+}
+
+// readParquetRows returns all the rows of the given Parquet file written by
+// WriteBoMDirectoryStatsParquet().
+func readParquetRows(t *testing.T, path string) []parquetRow {
+	t.Helper()
+
+	fr, err := local.NewLocalFileReader(path)
+	So(err, ShouldBeNil)
+
+	defer fr.Close()
+
+	pr, err := reader.NewParquetReader(fr, new(parquetRow), 1)
+	So(err, ShouldBeNil)
+
+	defer pr.ReadStop()
+
+	rows := make([]parquetRow, pr.GetNumRows())
+	So(pr.Read(&rows), ShouldBeNil)
+
+	return rows
+}
+
+// readTarMembers returns the content of each member of the given tar file,
+// keyed on member name. The tar file is gunzipped first if its name ends in
+// ".gz".
+func readTarMembers(t *testing.T, path string) map[string]string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	So(err, ShouldBeNil)
+
+	defer f.Close()
+
+	var r io.Reader = f
+
+	if strings.HasSuffix(path, ".gz") {
+		gr, errg := gzip.NewReader(f)
+		So(errg, ShouldBeNil)
+
+		defer gr.Close()
+
+		r = gr
+	}
+
+	members := make(map[string]string)
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, errn := tr.Next()
+		if errors.Is(errn, io.EOF) {
+			break
+		}
+
+		So(errn, ShouldBeNil)
+
+		content, errr := io.ReadAll(tr)
+		So(errr, ShouldBeNil)
+
+		members[hdr.Name] = string(content)
+	}
+
+	return members
+}
+
+// captureLogs makes the global logger log to the returned buffer for the
+// duration of the current Convey.
+func captureLogs() *bytes.Buffer {
+	var buf bytes.Buffer
+
+	original := l
+	l = newLeveledLogger(&buf, logNormal)
+
+	Reset(func() { l = original })
+
+	return &buf
+}
+
+// splitTestFile returns the uncompressed lines of the given gzipped stats file,
+// split in to n roughly equal parts.
+func splitTestFile(tb testing.TB, path string, n int) [][]byte {
+	tb.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	data, err := io.ReadAll(gr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	lines := bytes.SplitAfter(data, []byte{'\n'})
+	perPart := (len(lines) + n - 1) / n
+	parts := make([][]byte, 0, n)
+
+	for i := 0; i < len(lines); i += perPart {
+		parts = append(parts, bytes.Join(lines[i:min(i+perPart, len(lines))], nil))
+	}
+
+	return parts
+}
+
+func openTestGIDToBoM(tb testing.TB) *GIDToBoM {
+	tb.Helper()
+
+	f, err := os.Open("bom.gids")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	defer f.Close()
+
+	gtb, err := NewGIDToBoM(f)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return gtb
+}
+
+func TestAccumulator(t *testing.T) {
+	Convey("Given entries and a GIDToBoM", t, func() {
+		gtb := openTestGIDToBoM(t)
+
+		p := NewStatsParser(testStatsReader(t))
+		p.FilterForFilesOlderThan(yearsRelativeToTestFileCreation(0))
+
+		var entries []Entry
+		for p.Scan() {
+			entries = append(entries, p.Entry())
+		}
+
+		So(p.Err(), ShouldBeNil)
+
+		expected, err := BoMDirectoryStats(NewStatsParser(testStatsReader(t)), gtb, yearsRelativeToTestFileCreation(0))
+		So(err, ShouldBeNil)
+
+		add := func(acc *Accumulator, entries []Entry) {
+			for _, entry := range entries {
+				bom, err := gtb.GetBom(int(entry.GID))
+				if err != nil {
+					panic(err)
+				}
+
+				acc.AddEntry(bom, entry)
+			}
+		}
+
+		Convey("you can accumulate them yourself to get the same result", func() {
+			acc := NewAccumulator()
+			add(acc, entries)
+
+			So(acc.Result(), ShouldResemble, expected)
+		})
+
+		Convey("you can drain the results a BoM at a time, in the same order", func() {
+			acc := NewAccumulator()
+			add(acc, entries)
+
+			for _, entry := range entries {
+				acc.Add([]byte("CASM"), []byte(entry.Path), entry.Size/2)
+			}
+
+			expected = acc.Result()
+
+			var (
+				boms    []string
+				drained []*Stats
+			)
+
+			err = acc.DrainByBoM(func(stats []*Stats) error {
+				boms = append(boms, string(stats[0].BoM))
+				drained = append(drained, stats...)
+
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(len(boms), ShouldBeGreaterThan, 1)
+			So(slices.IsSorted(boms), ShouldBeTrue)
+			So(len(drained), ShouldEqual, len(expected))
+			So(acc.Result(), ShouldBeEmpty)
+
+			i := 0
+
+			for _, bom := range boms {
+				for _, s := range expected {
+					if string(s.BoM) == bom {
+						So(drained[i], ShouldResemble, s)
+						i++
+					}
+				}
+			}
+		})
+
+		Convey("you can accumulate them from multiple goroutines", func() {
+			acc := NewSyncAccumulator()
+			half := len(entries) / 2
+
+			var wg sync.WaitGroup
+
+			for _, part := range [][]Entry{entries[:half], entries[half:]} {
+				wg.Add(1)
+
+				go func(part []Entry) {
+					defer wg.Done()
+
+					add(acc, part)
+				}(part)
+			}
+
+			wg.Wait()
+
+			So(acc.Result(), ShouldResemble, expected)
+		})
+	})
+
+	Convey("Given a directories-only filter", t, func() {
+		gtb := openTestGIDToBoM(t)
+		bom, err := gtb.GetBom(808)
+		So(err, ShouldBeNil)
+
+		data := strings.ReplaceAll(statsLine("/a/b", 4096, 808, 0, 0, 0), "\tf\t", "\td\t") +
+			statsLine("/a/b/file", 10, 808, 0, 0, 0) +
+			strings.ReplaceAll(statsLine("/a/c", 512, 808, 0, 0, 0), "\tf\t", "\td\t")
+
+		p := NewStatsParser(strings.NewReader(data))
+		p.FilterForType('d')
+
+		var entries []Entry
+		for p.Scan() {
+			entries = append(entries, p.Entry())
+		}
+
+		So(p.Err(), ShouldBeNil)
+		So(len(entries), ShouldEqual, 2)
+
+		rootStats := func(acc *Accumulator) *Stats {
+			for _, entry := range entries {
+				acc.AddEntry(bom, entry)
+			}
+
+			return acc.Result()[0]
+		}
+
+		Convey("directories are counted without their sizes by default", func() {
+			root := rootStats(NewAccumulator())
+			So(root.Directory, ShouldEqual, "/")
+			So(root.Count, ShouldEqual, 2)
+			So(root.Size, ShouldEqual, 0)
+		})
+
+		Convey("directory sizes can be counted with a wider SizePolicy", func() {
+			for _, policy := range []SizePolicy{AllEntrySizes(), EntryTypeSizes('f', 'd')} {
+				acc := NewAccumulator()
+				acc.SetSizePolicy(policy)
+
+				root := rootStats(acc)
+				So(root.Count, ShouldEqual, 2)
+				So(root.Size, ShouldEqual, 4608)
+			}
+		})
+	})
+}
+
+func TestLeveledLogger(t *testing.T) {
+	Convey("Given a leveled logger", t, func() {
+		var buf bytes.Buffer
+
+		logAll := func(level logLevel) string {
+			buf.Reset()
+
+			ll := newLeveledLogger(&buf, level)
+			ll.Errorf("e%d", 1)
+			ll.Warnf("w%d", 2)
+			ll.Verbosef("v%d", 3)
+
+			return buf.String()
+		}
+
+		Convey("quiet only logs errors", func() {
+			So(logAll(logQuiet), ShouldEqual, "ERROR: e1\n")
+		})
+
+		Convey("normal logs errors and warnings", func() {
+			So(logAll(logNormal), ShouldEqual, "ERROR: e1\nWARNING: w2\n")
+		})
+
+		Convey("verbose logs everything", func() {
+			So(logAll(logVerbose), ShouldEqual, "ERROR: e1\nWARNING: w2\nv3\n")
+		})
+
+		Convey("levels are derived from the -q and -v flags", func() {
+			So(logLevelFromFlags(true, false), ShouldEqual, logQuiet)
+			So(logLevelFromFlags(false, false), ShouldEqual, logNormal)
+			So(logLevelFromFlags(false, true), ShouldEqual, logVerbose)
+		})
+	})
+}
+
+func TestOwnerTotals(t *testing.T) {
+	Convey("Given a stats parser and a GIDToBoM", t, func() {
+		gtb := openTestGIDToBoM(t)
+		d := yearsRelativeToTestFileCreation(0)
+
+		Convey("per-owner totals sum to the grand total", func() {
+			for _, by := range []OwnerType{OwnerUID, OwnerGID} {
+				stats, err := BoMDirectoryStats(NewStatsParser(testStatsReader(t)), gtb, d)
+				So(err, ShouldBeNil)
+
+				var (
+					grandCount uint64
+					grandSize  int64
+				)
+
+				for _, s := range stats {
+					if s.Directory == "/" {
+						grandCount += s.Count
+						grandSize += s.Size
+					}
+				}
+
+				owners, err := OwnerTotals(NewStatsParser(testStatsReader(t)), gtb, d, by)
+				So(err, ShouldBeNil)
+				So(len(owners), ShouldBeGreaterThan, 1)
+
+				var (
+					count uint64
+					size  int64
+				)
+
+				for i, o := range owners {
+					count += o.Count
+					size += o.Size
+
+					if i > 0 {
+						So(o.Size, ShouldBeLessThanOrEqualTo, owners[i-1].Size)
+					}
+				}
+
+				So(count, ShouldEqual, grandCount)
+				So(size, ShouldEqual, grandSize)
+			}
+		})
+
+		Convey("owners can be GIDs with their BoM attached", func() {
+			owners, err := OwnerTotals(NewStatsParser(testStatsReader(t)), gtb, yearsRelativeToTestFileCreation(7), OwnerGID)
+			So(err, ShouldBeNil)
+			So(len(owners), ShouldEqual, 1)
+			So(owners[0].Owner, ShouldEqual, 15078)
+			So(string(owners[0].BoM), ShouldEqual, "ToL")
+			So(owners[0].Count, ShouldEqual, 6)
+			So(owners[0].Size, ShouldEqual, 26440)
+		})
+	})
+
+	Convey("Given owner totals", t, func() {
+		owners := []*OwnerStats{
+			{Owner: 0, BoM: []byte("CASM"), Count: 2, Size: 2 * bytesPerGiB},
+			{Owner: 4294967, BoM: []byte("CASM"), Count: 1, Size: bytesPerGiB},
+		}
+
+		Convey("you can print them with numeric IDs", func() {
+			var buf bytes.Buffer
+
+			So(PrintOwnerTotals(&buf, owners, OwnerGID), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "0\tCASM\t2\t2.00\n4294967\tCASM\t1\t1.00\n")
+		})
+
+		Convey("you can print them with group names, falling back to IDs", func() {
+			g, err := user.LookupGroupId("0")
+			if err != nil {
+				SkipSo(g, ShouldNotBeNil)
+
+				return
+			}
+
+			var buf bytes.Buffer
+
+			So(PrintOwnerTotals(&buf, owners, OwnerGID, WithOwnerNames()), ShouldBeNil)
+			So(buf.String(), ShouldEqual, g.Name+"\tCASM\t2\t2.00\n4294967\tCASM\t1\t1.00\n")
+		})
+	})
+}
+
+func TestParseArgs(t *testing.T) {
+	Convey("parseArgs validates command line arguments", t, func() {
+		opts, err := parseArgs([]string{"-b", "bom.gids", "-no-root", "-bom-column"})
+		So(err, ShouldBeNil)
+		So(opts.bomGidsFile, ShouldEqual, "bom.gids")
+		So(opts.age, ShouldEqual, defaultAge)
+		So(opts.prefix, ShouldEqual, "output")
+		So(opts.noRoot, ShouldBeTrue)
+		So(opts.bomColumn, ShouldBeTrue)
+		So(len(opts.printOptions(nil)), ShouldEqual, 4)
+
+		opts, err = parseArgs([]string{"-b", "bom.gids", "-no-root", "-bom-column", "-legacy"})
+		So(err, ShouldBeNil)
+		So(opts.legacy, ShouldBeTrue)
+		So(len(opts.printOptions(nil)), ShouldEqual, 3)
+
+		_, err = parseArgs([]string{})
+		So(err, ShouldEqual, ErrNoBoMGIDsFile)
+
+		_, err = parseArgs([]string{"-b", "bom.gids", "-a", "0"})
+		So(err, ShouldEqual, ErrBadAge)
+
+		_, err = parseArgs([]string{"-b", "bom.gids", "-a", "293"})
+		So(err, ShouldEqual, ErrBadAge)
+
+		opts, err = parseArgs([]string{"-b", "bom.gids", "-a", "292"})
+		So(err, ShouldBeNil)
+		So(opts.maxAge, ShouldBeGreaterThan, 0)
+
+		_, err = parseArgs([]string{"-b", "bom.gids", "-q", "-v"})
+		So(err, ShouldEqual, ErrQuietAndVerbose)
+
+		_, err = NewGIDToBoM(strings.NewReader(""), opts.gidToBoMOptions()...)
+		So(err, ShouldEqual, ErrNoBoMs)
+
+		opts, err = parseArgs([]string{"-b", "bom.gids", "-exclude-gids", "1001,1002-200000000"})
+		So(err, ShouldBeNil)
+		So(opts.excludeGIDs, ShouldResemble, []GIDRange{{1001, 1001}, {1002, 200000000}})
+
+		_, err = parseArgs([]string{"-b", "bom.gids", "-exclude-gids", "1001,x"})
+		So(err, ShouldNotBeNil)
+
+		_, err = parseArgs([]string{"-b", "bom.gids", "-check", "-direct-only"})
+		So(err, ShouldEqual, ErrCheckFiltered)
+
+		_, err = parseArgs([]string{"-b", "bom.gids", "-check", "-min-cold", "0.5"})
+		So(err, ShouldEqual, ErrCheckFiltered)
+
+		opts, err = parseArgs([]string{"-b", "bom.gids", "-check", "-split-cold", "0.5"})
+		So(err, ShouldBeNil)
+		So(opts.check, ShouldBeTrue)
+
+		opts, err = parseArgs([]string{"-b", "bom.gids", "-since-file", "/old/output.CASM.tsv"})
+		So(err, ShouldBeNil)
+		So(opts.sinceFile, ShouldEqual, "/old/output.CASM.tsv")
+
+		_, err = parseArgs([]string{"-b", "bom.gids", "-smallest-first", "-sort-by-age"})
+		So(err, ShouldEqual, ErrSortOrders)
+
+		_, err = parseArgs([]string{"-b", "bom.gids", "-min-cold", "1.5"})
+		So(err, ShouldEqual, ErrBadColdFraction)
+
+		opts, err = parseArgs([]string{"-b", "bom.gids", "-min-cold", "0.9"})
+		So(err, ShouldBeNil)
+		So(opts.wantsCold(), ShouldBeTrue)
+		So(len(opts.statsOptions()), ShouldEqual, 1)
+
+		_, err = parseArgs([]string{"-b", "bom.gids", "-split-cold", "-0.5"})
+		So(err, ShouldEqual, ErrBadColdFraction)
+
+		opts, err = parseArgs([]string{"-b", "bom.gids", "-split-cold", "0.5"})
+		So(err, ShouldBeNil)
+		So(opts.wantsCold(), ShouldBeTrue)
+
+		_, err = parseArgs([]string{"-b", "bom.gids", "-now", "yesterday"})
+		So(err, ShouldNotBeNil)
+
+		Convey("the age can come from the environment", func() {
+			Reset(func() { os.Unsetenv(ageEnvVar) })
+
+			t.Setenv(ageEnvVar, "3")
+
+			opts, err = parseArgs([]string{"-b", "bom.gids"})
+			So(err, ShouldBeNil)
+			So(opts.maxAge, ShouldEqual, 3*year)
+			So(opts.ageLabel, ShouldEqual, "3y")
+
+			t.Setenv(ageEnvVar, "18mo")
+
+			opts, err = parseArgs([]string{"-b", "bom.gids"})
+			So(err, ShouldBeNil)
+			So(opts.maxAge, ShouldEqual, 18*year/12)
+			So(opts.ageLabel, ShouldEqual, "18mo")
+
+			t.Setenv(ageEnvVar, "soon")
+
+			_, err = parseArgs([]string{"-b", "bom.gids"})
+			So(errors.Is(err, ErrBadAgeDuration), ShouldBeTrue)
+
+			Convey("but the flags override it", func() {
+				opts, err = parseArgs([]string{"-b", "bom.gids", "-a", "5"})
+				So(err, ShouldBeNil)
+				So(opts.maxAge, ShouldEqual, 5*year)
+
+				opts, err = parseArgs([]string{"-b", "bom.gids", "-d", "2w"})
+				So(err, ShouldBeNil)
+				So(opts.maxAge, ShouldEqual, 14*24*time.Hour)
+			})
+		})
+
+		opts, err = parseArgs([]string{"-h"})
+		So(err, ShouldBeNil)
+		So(opts.help, ShouldBeTrue)
+	})
+
+	Convey("With a fixed -now, parsing stdin gives stable results", t, func() {
+		collected := time.Unix(epochWhenTestFileWasCreated, 0).UTC()
+
+		opts, err := parseArgs([]string{"-b", "bom.gids", "-a", "7", "-now", collected.Format(time.RFC3339)})
+		So(err, ShouldBeNil)
+		So(opts.now.Equal(collected), ShouldBeTrue)
+
+		original := os.Stdin
+
+		Reset(func() { os.Stdin = original })
+
+		gtb := openTestGIDToBoM(t)
+
+		parse := func() []*Stats {
+			f, erro := os.Open("test.stats.gz")
+			So(erro, ShouldBeNil)
+
+			defer f.Close()
+
+			os.Stdin = f
+
+			return parseInput(gtb, opts)
+		}
+
+		first := parse()
+		So(len(first), ShouldBeGreaterThan, 0)
+		So(parse(), ShouldResemble, first)
+
+		expected, err := BoMDirectoryStats(NewStatsParser(testStatsReader(t)), gtb, yearsRelativeToTestFileCreation(7))
+		So(err, ShouldBeNil)
+		So(first, ShouldResemble, expected)
+
+		Convey("and parsing split files in parallel gives the same results", func() {
+			data, errr := io.ReadAll(testStatsReader(t))
+			So(errr, ShouldBeNil)
+
+			half := bytes.IndexByte(data[len(data)/2:], '\n') + len(data)/2 + 1
+			dir := t.TempDir()
+			files := []string{filepath.Join(dir, "1.stats"), filepath.Join(dir, "2.stats")}
+
+			So(os.WriteFile(files[0], data[:half], 0600), ShouldBeNil)
+			So(os.WriteFile(files[1], data[half:], 0600), ShouldBeNil)
+
+			for _, parallel := range []string{"2", "1"} {
+				opts, err = parseArgs(append([]string{"-b", "bom.gids", "-now", collected.Format(time.RFC3339),
+					"-parallel", parallel}, files...))
+				So(err, ShouldBeNil)
+				So(opts.files, ShouldResemble, files)
+
+				stats := parseInput(gtb, opts, opts.statsOptions()...)
+				So(len(stats), ShouldEqual, len(expected))
+
+				for i, s := range stats {
+					So(*s, ShouldResemble, *expected[i])
+				}
+			}
+
+			So(opts.workers(), ShouldEqual, 1)
+
+			opts.parallel = 0
+			So(opts.workers(), ShouldEqual, min(runtime.NumCPU(), 2))
+		})
+
+		Convey("and parsing files in parallel warns about files with future times", func() {
+			dir := t.TempDir()
+			files := []string{filepath.Join(dir, "1.stats"), filepath.Join(dir, "2.stats")}
+			future := collected.Add(time.Hour).Unix()
+
+			So(os.WriteFile(files[0], []byte(statsLine("/a/old", 1, 808, 0, 0, 0)), 0600), ShouldBeNil)
+			So(os.WriteFile(files[1], []byte(statsLine("/a/new", 1, 808, 0, future, future)), 0600), ShouldBeNil)
+
+			opts, err = parseArgs(append([]string{"-b", "bom.gids", "-now", collected.Format(time.RFC3339),
+				"-parallel", "2"}, files...))
+			So(err, ShouldBeNil)
+
+			logs := captureLogs()
+
+			stats := parseInput(gtb, opts, opts.statsOptions()...)
+			So(len(stats), ShouldBeGreaterThan, 0)
+			So(logs.String(), ShouldContainSubstring, "1 files have an mtime or ctime in the future")
+			So(logs.String(), ShouldNotContainSubstring, "serially")
+
+			Convey("and that options that need serial parsing override -parallel", func() {
+				opts, err = parseArgs(append([]string{"-b", "bom.gids", "-now", collected.Format(time.RFC3339),
+					"-parallel", "2", "-min-cold", "0.5"}, files...))
+				So(err, ShouldBeNil)
+
+				stats = parseInput(gtb, opts, opts.statsOptions()...)
+				So(len(stats), ShouldBeGreaterThan, 0)
+				So(logs.String(), ShouldContainSubstring,
+					"parsing 2 stats files serially instead of with 2 workers")
+			})
+		})
+
+		Convey("and stats files can be listed in an -input-list file", func() {
+			list := filepath.Join(t.TempDir(), "files.txt")
+			So(os.WriteFile(list, []byte("# fixtures\ntest.stats.gz\n\n  test2.stats\n"), 0600), ShouldBeNil)
+
+			opts, err = parseArgs([]string{"-b", "bom.gids", "-now", collected.Format(time.RFC3339),
+				"-parallel", "1", "-input-list", list})
+			So(err, ShouldBeNil)
+			So(opts.files, ShouldResemble, []string{"test.stats.gz", "test2.stats"})
+
+			f, erro := os.Open("test2.stats")
+			So(erro, ShouldBeNil)
+
+			defer f.Close()
+
+			expected, err = BoMDirectoryStats(NewStatsParser(io.MultiReader(testStatsReader(t), f)), gtb,
+				yearsRelativeToTestFileCreation(7))
+			So(err, ShouldBeNil)
+
+			stats := parseInput(gtb, opts, opts.statsOptions()...)
+			So(stats, ShouldResemble, expected)
+			So(countBoMDirectories(stats), ShouldContainKey, "ToL")
+			So(countBoMDirectories(stats), ShouldContainKey, "HumanGenetics")
+
+			opts, err = parseArgs([]string{"-b", "bom.gids", "-input-list", list, "extra.stats"})
+			So(err, ShouldBeNil)
+			So(opts.files, ShouldResemble, []string{"test.stats.gz", "test2.stats", "extra.stats"})
+
+			_, err = parseArgs([]string{"-b", "bom.gids", "-input-list", list + ".missing"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestDecompressIfGzipped(t *testing.T) {
+	Convey("Given stats data written slowly to a pipe", t, func() {
+		gzipped, err := os.ReadFile("test.stats.gz")
+		So(err, ShouldBeNil)
+
+		raw, err := io.ReadAll(testStatsReader(t))
+		So(err, ShouldBeNil)
+
+		for _, data := range [][]byte{gzipped, raw} {
+			Convey(fmt.Sprintf("all lines are parsed without premature termination (%d bytes)", len(data)), func() {
+				pr, pw := io.Pipe()
+
+				go slowlyWrite(pw, data)
+
+				r, errd := DecompressIfGzipped(pr)
+				So(errd, ShouldBeNil)
+
+				p := NewStatsParser(r)
+
+				i := 0
+				for p.Scan() {
+					i++
+				}
+
+				So(p.Err(), ShouldBeNil)
+				So(i, ShouldEqual, 18890)
+			})
+		}
+	})
+
+	Convey("Empty and tiny inputs are passed through", t, func() {
+		for _, data := range []string{"", "a"} {
+			r, err := DecompressIfGzipped(strings.NewReader(data))
+			So(err, ShouldBeNil)
+
+			b, err := io.ReadAll(r)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, data)
+		}
+	})
+}
+
+// slowlyWrite writes the given data to the given pipe in small chunks with
+// pauses, giving the reader lots of short reads, including of the first bytes.
+func slowlyWrite(pw *io.PipeWriter, data []byte) {
+	const chunkSize = 4093
+
+	for i := 0; i < len(data); {
+		n := chunkSize
+		if i < 3 {
+			n = 1
+		}
+
+		end := min(i+n, len(data))
+
+		if _, err := pw.Write(data[i:end]); err != nil {
+			pw.CloseWithError(err)
+
+			return
+		}
+
+		if i < 3 || (i/chunkSize)%50 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		i = end
+	}
+
+	pw.Close()
+}
+
+func TestBoMDirectoryUserStats(t *testing.T) {
+	Convey("Given stats data with multiple owners per directory", t, func() {
+		gtb := openTestGIDToBoM(t)
+
+		data := ownedStatsLine("/a/b/file1", 10, 1) +
+			ownedStatsLine("/a/b/file2", 30, 2) +
+			ownedStatsLine("/a/b/file3", 5, 3) +
+			ownedStatsLine("/a/c/file4", 20, 1)
+
+		stats, err := BoMDirectoryUserStats(NewStatsParser(strings.NewReader(data)), gtb,
+			yearsRelativeToTestFileCreation(7), 2)
+		So(err, ShouldBeNil)
+		So(len(stats), ShouldEqual, 4)
+
+		Convey("each directory has its top users, largest first", func() {
+			So(stats[0].Directory, ShouldEqual, "/")
+			So(stats[0].Size, ShouldEqual, 65)
+			So(stats[0].Users, ShouldResemble, []*OwnerStats{
+				{Owner: 1, BoM: []byte("CASM"), Count: 2, Size: 30},
+				{Owner: 2, BoM: []byte("CASM"), Count: 1, Size: 30},
+			})
+
+			So(stats[2].Directory, ShouldEqual, "/a/b")
+			So(len(stats[2].Users), ShouldEqual, 2)
+			So(stats[2].Users[0].Owner, ShouldEqual, 2)
+			So(stats[2].Users[1].Owner, ShouldEqual, 1)
+
+			So(stats[3].Directory, ShouldEqual, "/a/c")
+			So(stats[3].Users, ShouldResemble, []*OwnerStats{
+				{Owner: 1, BoM: []byte("CASM"), Count: 1, Size: 20},
+			})
+		})
+
+		Convey("they can be written as nested JSON", func() {
+			var buf bytes.Buffer
+
+			err = WriteDirectoryUserStatsJSON(&buf, stats[3:])
+			So(err, ShouldBeNil)
+			So(buf.String(), ShouldEqual, `[{"bom":"CASM","directory":"/a/c","count":1,"size_bytes":20,`+
+				`"users":[{"uid":1,"count":1,"size_bytes":20}]}]`+"\n")
+		})
+	})
+}
+
+func TestDeepestPaths(t *testing.T) {
+	Convey("Given stats data and bom.gids", t, func() {
+		gtb := openTestGIDToBoM(t)
+		p := NewStatsParser(testStatsReader(t))
+
+		Convey("you can get the deepest file paths of each BoM", func() {
+			paths, err := DeepestPaths(p, gtb, yearsRelativeToTestFileCreation(7), 3)
+			So(err, ShouldBeNil)
+
+			var tol []*DeepPath
+
+			for _, dp := range paths {
+				if string(dp.BoM) == "ToL" {
+					tol = append(tol, dp)
+				}
+			}
+
+			So(len(tol), ShouldEqual, 3)
+			So(tol[0].Depth, ShouldEqual, 11)
+			So(tol[0].Path, ShouldEqual,
+				"/lustre/scratch122/tol/teams/blaxter/users/cc51/software/bcftools-1.19/test/convert.gs.pl.gen")
+
+			Convey("and write them to a file per BoM", func() {
+				prefix := filepath.Join(t.TempDir(), "output")
+
+				err = PrintDeepestPaths(prefix, paths)
+				So(err, ShouldBeNil)
+
+				b, err := os.ReadFile(prefix + ".ToL.deepest.tsv")
+				So(err, ShouldBeNil)
+				So(strings.Count(string(b), "\n"), ShouldEqual, 3)
+				So(string(b), ShouldStartWith, "11\t"+tol[0].Path+"\n")
+			})
+		})
+
+		Convey("-deepest reads stats files given on the command line", func() {
+			prefix := filepath.Join(t.TempDir(), "output")
+
+			opts, err := parseArgs([]string{"-b", "bom.gids", "-a", "1", "-deepest", "3", "-o", prefix, "test.stats.gz"})
+			So(err, ShouldBeNil)
+
+			printDeepestPaths(gtb, opts)
+
+			b, err := os.ReadFile(prefix + ".ToL.deepest.tsv")
+			So(err, ShouldBeNil)
+			So(strings.Count(string(b), "\n"), ShouldEqual, 3)
+		})
+
+		Convey("the number of paths retained per BoM is capped", func() {
+			paths, err := DeepestPaths(p, gtb, time.Nanosecond, maxDeepestPaths*2)
+			So(err, ShouldBeNil)
+
+			perBoM := make(map[string]int)
+			for _, dp := range paths {
+				perBoM[string(dp.BoM)]++
+			}
+
+			So(perBoM["ToL"], ShouldEqual, maxDeepestPaths)
+		})
+	})
+}
+
+func TestProgressReader(t *testing.T) {
+	Convey("Given a ProgressReader of a regular file", t, func() {
+		f, err := os.Open("test.stats.gz")
+		So(err, ShouldBeNil)
+
+		defer f.Close()
+
+		size := InputSize(f)
+		So(size, ShouldBeGreaterThan, 0)
+
+		pr := NewProgressReader(f, size)
+		So(pr.Percent(), ShouldEqual, 0)
+
+		Convey("the reported percentage reaches 100% at EOF", func() {
+			var buf bytes.Buffer
+
+			stop := pr.Report(&buf, time.Millisecond)
+
+			r, err := DecompressIfGzipped(pr)
+			So(err, ShouldBeNil)
+
+			p := NewStatsParser(r)
+			for p.Scan() {
+			}
+
+			stop()
+
+			So(p.Err(), ShouldBeNil)
+			So(pr.Percent(), ShouldEqual, 100)
+
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			So(lines[len(lines)-1], ShouldEqual, "progress: 100.0%")
+		})
+	})
+
+	Convey("Given a ProgressReader of a pipe, progress is reported in lines", t, func() {
+		r, w, err := os.Pipe()
+		So(err, ShouldBeNil)
+
+		defer r.Close()
 
-				err = PrintBoMDirectoryStats(prefix, stats)
-				So(err, ShouldBeNil)
+		So(InputSize(r), ShouldEqual, 0)
 
-				b, errr := os.ReadFile(prefix + ".ToL.tsv")
-				So(errr, ShouldBeNil)
+		go func() {
+			w.WriteString(statsLine("/a/file1", 1, 808, 0, 0, 0) + statsLine("/a/file2", 1, 808, 0, 0, 0))
+			w.Close()
+		}()
 
-				So(string(b), ShouldEqual, expectedTSV)
-			})
-		})
+		pr := NewProgressReader(r, InputSize(r))
 
-		Convey("you can get the stats for different BoMs", func() {
-			f, err = os.Open("test2.stats")
-			So(err, ShouldBeNil)
+		_, err = io.Copy(io.Discard, pr)
+		So(err, ShouldBeNil)
+		So(pr.Percent(), ShouldEqual, -1)
+		So(pr.Lines(), ShouldEqual, 2)
+		So(pr.String(), ShouldEqual, "progress: 2 lines")
+	})
+}
 
-			defer f.Close()
+func TestRollupToDepth(t *testing.T) {
+	Convey("Given the stats of test.stats.gz", t, func() {
+		gtb := openTestGIDToBoM(t)
 
-			p = NewStatsParser(f)
+		stats, err := BoMDirectoryStats(NewStatsParser(testStatsReader(t)), gtb, time.Nanosecond)
+		So(err, ShouldBeNil)
 
-			stats, err := BoMDirectoryStats(p, gtb, yearsRelativeToTestFileCreation(7))
-			So(err, ShouldBeNil)
-			So(len(stats), ShouldEqual, 6)
+		Convey("you can roll them up to a coarser depth", func() {
+			rolled := RollupToDepth(stats, 2)
+			So(len(rolled), ShouldBeGreaterThan, 0)
 
-			So(string(stats[0].BoM), ShouldEqual, "HumanGenetics")
-			So(stats[0].Directory, ShouldEqual, "/")
-			So(stats[0].Count, ShouldEqual, 1)
-			So(stats[0].Size, ShouldEqual, 2523300000)
-			So(stats[1].Directory, ShouldEqual, "/a")
-			So(stats[2].Directory, ShouldEqual, "/a/c")
+			p := NewStatsParser(testStatsReader(t))
+			p.CapDepth(2)
 
-			So(string(stats[3].BoM), ShouldEqual, "CASM")
-			So(stats[3].Directory, ShouldEqual, "/")
-			So(stats[3].Count, ShouldEqual, 1)
-			So(stats[3].Size, ShouldEqual, 1611000000)
-			So(stats[4].Directory, ShouldEqual, "/a")
-			So(stats[5].Directory, ShouldEqual, "/a/b")
+			capped, err := BoMDirectoryStats(p, gtb, time.Nanosecond)
+			So(err, ShouldBeNil)
 
-			Convey("and print their sizes in GiBs", func() {
-				tempDir := t.TempDir()
-				prefix := filepath.Join(tempDir, "output")
+			expected := RollupToDepth(capped, 2)
+			So(len(rolled), ShouldEqual, len(expected))
 
-				err = PrintBoMDirectoryStats(prefix, stats)
-				So(err, ShouldBeNil)
+			for i, s := range rolled {
+				So(strings.Count(s.Directory, "/"), ShouldEqual, 2)
+				So(s.BoM, ShouldResemble, expected[i].BoM)
+				So(s.Directory, ShouldEqual, expected[i].Directory)
+				So(s.Count, ShouldEqual, expected[i].Count)
+				So(s.Size, ShouldEqual, expected[i].Size)
+			}
+		})
 
-				b, err := os.ReadFile(prefix + ".HumanGenetics.tsv")
-				So(err, ShouldBeNil)
-				So(string(b), ShouldEqual, "/\t1\t2.35\n/a\t1\t2.35\n/a/c\t1\t2.35\n")
+		Convey("depth 0 is the root of each BoM", func() {
+			roots := RollupToDepth(stats, 0)
+			So(len(roots), ShouldBeGreaterThan, 0)
 
-				b, err = os.ReadFile(prefix + ".CASM.tsv")
-				So(err, ShouldBeNil)
-				So(string(b), ShouldEqual, "/\t1\t1.50\n/a\t1\t1.50\n/a/b\t1\t1.50\n")
-			})
+			for _, s := range roots {
+				So(s.Directory, ShouldEqual, "/")
+			}
 		})
+	})
+}
 
-		Convey("you can get the stats in more complicated data", func() {
-			f, err := os.Open("test3.stats.gz")
-			So(err, ShouldBeNil)
+func TestTotalColdBytes(t *testing.T) {
+	Convey("TotalColdBytes matches the sum of the root rows of BoMDirectoryStats", t, func() {
+		count, size, err := TotalColdBytes(testStatsReader(t), yearsRelativeToTestFileCreation(7))
+		So(err, ShouldBeNil)
+		So(count, ShouldBeGreaterThan, 0)
 
-			defer f.Close()
+		stats, err := BoMDirectoryStats(NewStatsParser(testStatsReader(t)), openTestGIDToBoM(t),
+			yearsRelativeToTestFileCreation(7))
+		So(err, ShouldBeNil)
 
-			gr, err := gzip.NewReader(f)
-			So(err, ShouldBeNil)
+		var (
+			rootCount uint64
+			rootSize  int64
+		)
 
-			defer gr.Close()
+		for _, s := range stats {
+			if s.Directory == "/" {
+				rootCount += s.Count
+				rootSize += s.Size
+			}
+		}
 
-			p = NewStatsParser(gr)
+		So(count, ShouldEqual, rootCount)
+		So(size, ShouldEqual, rootSize)
+	})
+}
 
-			stats, err := BoMDirectoryStats(p, gtb, yearsRelativeToTestFileCreation(7))
+func TestTreeOrder(t *testing.T) {
+	Convey("treeOrder puts children directly after their parents", t, func() {
+		bom := []byte("bom")
+		stats := []*Stats{
+			{BoM: bom, Directory: "/", Size: 10},
+			{BoM: bom, Directory: "/a", Size: 6},
+			{BoM: bom, Directory: "/b", Size: 4},
+			{BoM: bom, Directory: "/a/x", Size: 3},
+			{BoM: []byte("other"), Directory: "/", Size: 2},
+			{BoM: bom, Directory: "/b/y", Size: 1},
+		}
+
+		ordered := treeOrder(stats)
+		dirs := make([]string, len(ordered))
+
+		for i, s := range ordered {
+			dirs[i] = string(s.BoM) + ":" + s.Directory
+		}
+
+		So(dirs, ShouldResemble, []string{"bom:/", "bom:/a", "bom:/a/x", "bom:/b", "bom:/b/y", "other:/"})
+		So(treeName("/"), ShouldEqual, "/")
+		So(treeName("/a/x"), ShouldEqual, "    x")
+	})
+}
+
+func TestRoundingMode(t *testing.T) {
+	Convey("RoundingModes round to 2 decimal places in different ways", t, func() {
+		So(RoundHalfUp.round(1125, 1000), ShouldEqual, 1.13)
+		So(RoundHalfUp.round(1124, 1000), ShouldEqual, 1.12)
+		So(RoundUp.round(1121, 1000), ShouldEqual, 1.13)
+		So(RoundUp.round(0, 1000), ShouldEqual, 0)
+		So(Truncate.round(1129, 1000), ShouldEqual, 1.12)
+		So(RoundNearest.round(1129, 1000), ShouldEqual, 1.129)
+
+		Convey("without floating point error for values exactly on a hundredth", func() {
+			for _, mode := range []RoundingMode{RoundHalfUp, RoundUp, Truncate} {
+				So(mode.round(70000000, bytesPerGB), ShouldEqual, 0.07)
+				So(mode.round(290000000, bytesPerGB), ShouldEqual, 0.29)
+			}
+
+			So(RoundUp.round(70000001, bytesPerGB), ShouldEqual, 0.08)
+			So(Truncate.round(289999999, bytesPerGB), ShouldEqual, 0.28)
+		})
+
+		Convey("with negative values rounded towards lower and higher values", func() {
+			So(RoundUp.round(-1121, 1000), ShouldEqual, -1.12)
+			So(Truncate.round(-1121, 1000), ShouldEqual, -1.13)
+			So(RoundHalfUp.round(-1125, 1000), ShouldEqual, -1.12)
+			So(RoundHalfUp.round(-1126, 1000), ShouldEqual, -1.13)
+			So(Truncate.round(-70000000, bytesPerGB), ShouldEqual, -0.07)
+		})
+
+		for name, expected := range map[string]RoundingMode{
+			"nearest": RoundNearest, "half-up": RoundHalfUp, "up": RoundUp, "truncate": Truncate,
+		} {
+			mode, err := ParseRoundingMode(name)
 			So(err, ShouldBeNil)
+			So(mode, ShouldEqual, expected)
+		}
 
-			Convey("and there are no duplicates", func() {
-				dirs := make(map[string]bool)
-				dups := 0
+		_, err := ParseRoundingMode("sideways")
+		So(err, ShouldEqual, ErrBadRoundingMode)
 
-				for _, s := range stats {
-					key := string(s.BoM) + ":" + s.Directory
-					if dirs[key] {
-						dups++
-					} else {
-						dirs[key] = true
-					}
-				}
+		opts, err := parseArgs([]string{"-b", "bom.gids", "-round", "up"})
+		So(err, ShouldBeNil)
+		So(opts.rounding, ShouldEqual, RoundUp)
 
-				So(dups, ShouldEqual, 0)
-			})
+		_, err = parseArgs([]string{"-b", "bom.gids", "-round", "sideways"})
+		So(err, ShouldNotBeNil)
+	})
+}
 
-			Convey("and there are no missing directories", func() {
-				for retry := 0; retry < 10; retry++ {
-					f, err = os.Open("test3.stats.gz")
-					So(err, ShouldBeNil)
+func TestParseAge(t *testing.T) {
+	Convey("ParseAge understands each age suffix", t, func() {
+		for age, expected := range map[string]time.Duration{
+			"5y":     5 * 365 * 24 * time.Hour,
+			"18mo":   18 * 730 * time.Hour,
+			"2w":     14 * 24 * time.Hour,
+			"30d":    30 * 24 * time.Hour,
+			"1.5y":   365 * 36 * time.Hour,
+			"43800h": 43800 * time.Hour,
+			"90m":    90 * time.Minute,
+		} {
+			d, err := ParseAge(age)
+			So(err, ShouldBeNil)
+			So(d, ShouldEqual, expected)
+		}
 
-					defer f.Close()
+		for _, bad := range []string{"", "y", "5x", "fivey", "5 y", "NaNy", "nand", "Infy", "-infw", "+Infmo", "1e300y"} {
+			_, err := ParseAge(bad)
+			So(err, ShouldEqual, ErrBadAgeDuration)
+		}
+	})
 
-					gz, err := gzip.NewReader(f)
-					So(err, ShouldBeNil)
+	Convey("The CLI accepts an age as -a years or a -d duration, but not both", t, func() {
+		opts, err := parseArgs([]string{"-b", "bom.gids"})
+		So(err, ShouldBeNil)
+		So(opts.maxAge, ShouldEqual, 7*365*24*time.Hour)
+		So(opts.ageLabel, ShouldEqual, "7y")
 
-					defer gz.Close()
+		opts, err = parseArgs([]string{"-b", "bom.gids", "-a", "3"})
+		So(err, ShouldBeNil)
+		So(opts.maxAge, ShouldEqual, 3*365*24*time.Hour)
 
-					p = NewStatsParser(gz)
+		opts, err = parseArgs([]string{"-b", "bom.gids", "-d", "18mo"})
+		So(err, ShouldBeNil)
+		So(opts.maxAge, ShouldEqual, 18*730*time.Hour)
+		So(opts.ageLabel, ShouldEqual, "18mo")
 
-					stats, err := BoMDirectoryStats(p, gtb, yearsRelativeToTestFileCreation(7))
-					So(err, ShouldBeNil)
+		_, err = parseArgs([]string{"-b", "bom.gids", "-a", "3", "-d", "18mo"})
+		So(err, ShouldEqual, ErrAgeAndDuration)
 
-					uniqueDirs := make(map[string]bool)
-					wrongDirs := make(map[string]bool)
+		_, err = parseArgs([]string{"-b", "bom.gids", "-d", "-5y"})
+		So(err, ShouldEqual, ErrBadAge)
 
-					for _, s := range stats {
-						wrongDirs[s.Directory] = true
+		_, err = parseArgs([]string{"-b", "bom.gids", "-d", "5x"})
+		So(err, ShouldEqual, ErrBadAgeDuration)
+	})
+}
 
-						dirs := strings.Split(s.Directory, "/")
-						for i := 1; i < len(dirs); i++ {
-							dir := strings.Join(dirs[:i], "/")
+func TestParseLine(t *testing.T) {
+	Convey("ParseLine parses a single line in to an Entry", t, func() {
+		entry, err := ParseLine([]byte(strings.TrimSuffix(statsLine("/a/file", 5, 808, 1, 2, 3), "\n")))
+		So(err, ShouldBeNil)
+		So(string(entry.Path), ShouldEqual, "/a/file")
+		So(entry.Size, ShouldEqual, 5)
+		So(entry.GID, ShouldEqual, 808)
+		So(entry.CTime, ShouldEqual, 3)
+		So(entry.EntryType, ShouldEqual, fileType)
+
+		Convey("classifying the problem with bad lines", func() {
+			for line, expected := range map[string]error{
+				"":                                  ErrTooFewColumns,
+				"L2E=\t1\t1":                        ErrTooFewColumns,
+				"not base64\t1\t1\t1\t1\t1\t1\tf\t": ErrBadPath,
+				"L2E=\t1\t1\t1e\t1\t1\t1\tf\t":      ErrBadNumber,
+				"L2E=\t1\t1\t1\t1\t1\t1\t\t":        ErrTooFewColumns,
+				strings.Repeat("L2Fh", maxBase64EncodedPathLength) + "\t1\t1\t1\t1\t1\t1\tf\t": ErrPathTooLong,
+			} {
+				_, err = ParseLine([]byte(line))
+				So(err, ShouldEqual, expected)
+			}
+		})
 
-							if dir != "" {
-								uniqueDirs[dir] = true
-							}
-						}
-					}
+		Convey("handling numbers at the limits of an int64", func() {
+			line := func(size string) []byte {
+				return []byte("L2E=\t" + size + "\t1\t1\t1\t1\t1\tf\t")
+			}
 
-					for dir := range wrongDirs {
-						delete(uniqueDirs, dir)
-					}
+			for size, expected := range map[string]int64{
+				"0":                   0,
+				"7":                   7,
+				"922337203685477580":  math.MaxInt64 / 10,
+				"9223372036854775807": math.MaxInt64,
+				"0000000000000000001": 1,
+			} {
+				entry, errp := ParseLine(line(size))
+				So(errp, ShouldBeNil)
+				So(entry.Size, ShouldEqual, expected)
+			}
 
-					So(len(uniqueDirs), ShouldEqual, 0)
-				}
-			})
+			for size, expected := range map[string]error{
+				"9223372036854775808":  ErrNumberTooLarge,
+				"9999999999999999999":  ErrNumberTooLarge,
+				"92233720368547758070": ErrNumberTooLarge,
+				"00000000000000000001": ErrNumberTooLarge,
+				"-1":                   ErrBadNumber,
+				"922337203685477580x":  ErrBadNumber,
+			} {
+				_, err = ParseLine(line(size))
+				So(err, ShouldEqual, expected)
+			}
 		})
 
-		Convey("an error is provided when bad data is given", func() {
-			p = NewStatsParser(strings.NewReader("this is invalid since there's no tabs\n"))
-			_, err := BoMDirectoryStats(p, gtb, yearsRelativeToTestFileCreation(7))
-			So(err, ShouldNotBeNil)
+		Convey("accepting times before the epoch, but not other negative numbers", func() {
+			entry, errp := ParseLine([]byte("L2E=\t1\t1\t1\t-1\t-86400\t0\tf\t"))
+			So(errp, ShouldBeNil)
+			So(entry.ATime, ShouldEqual, -1)
+			So(entry.MTime, ShouldEqual, -86400)
+			So(entry.CTime, ShouldEqual, 0)
+
+			for _, line := range []string{
+				"L2E=\t1\t1\t-1\t1\t1\t1\tf\t",
+				"L2E=\t1\t1\t1\t-\t1\t1\tf\t",
+				"L2E=\t1\t1\t1\t1\t--1\t1\tf\t",
+				"L2E=\t1\t1\t1\t1\t1\t1-\tf\t",
+			} {
+				_, err = ParseLine([]byte(line))
+				So(err, ShouldEqual, ErrBadNumber)
+			}
+
+			_, err = ParseLine([]byte("L2E=\t1\t1\t1\t1\t-9223372036854775808\t1\tf\t"))
+			So(err, ShouldEqual, ErrNumberTooLarge)
 		})
 	})
 }
 
+// FuzzParseLine checks that ParseLine() never panics, and always either
+// succeeds or returns one of its documented errors.
+func FuzzParseLine(f *testing.F) {
+	encodedPath := base64.StdEncoding.EncodeToString([]byte("/a/b"))
+
+	for _, seed := range []string{
+		strings.TrimSuffix(statsLine("/lustre/scratch122/tol/file", 1, 15295, 1, 2, 3), "\n"),
+		encodedPath + "\t1\t1\t1\t1\t1\t1\tf\t1\t2\td",
+		encodedPath + "\t1\t1\t1\t1\t1\t1\tf\t",
+		encodedPath + "\t1\t1\t1\t1\t1",
+		encodedPath,
+		"this is invalid since it has spaces\t1\t1\t1\t1\t1\t1\tf\t1\t1\td",
+		"this is invalid since there's no tabs",
+		encodedPath + "\t1\t1\tx\t1\t1\t1\tf\t1\t1\td",
+		encodedPath + "\t1\t1\t\t1\t1\t1\tf\t1\t1\td",
+		encodedPath + "\t9223372036854775808\t1\t1\t1\t1\t1\tf\t1\t1\td",
+		"",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	classified := []error{ErrTooFewColumns, ErrBadNumber, ErrNumberTooLarge, ErrEmptyColumn, ErrEmptyFileSize,
+		ErrBadPath, ErrPathTooLong}
+
+	f.Fuzz(func(t *testing.T, line []byte) {
+		_, err := ParseLine(line)
+		if err != nil && !slices.Contains(classified, err) {
+			t.Fatalf("unclassified error for %q: %v", line, err)
+		}
+	})
+}
+
 func yearsRelativeToTestFileCreation(years int) time.Duration {
 	timeDifference := time.Since(time.Unix(epochWhenTestFileWasCreated, 0))
 	yearsDifference := time.Duration(years) * 365 * 24 * time.Hour
@@ -471,22 +4480,94 @@ func BenchmarkScanAndFileInfo(b *testing.B) {
 	}
 }
 
-func openTestFile(b *testing.B) (io.ReadCloser, io.ReadCloser) {
-	b.Helper()
+func openTestFile(tb testing.TB) (io.ReadCloser, io.ReadCloser) {
+	tb.Helper()
 
 	f, err := os.Open("test.stats.gz")
 	if err != nil {
-		b.Fatal(err)
+		tb.Fatal(err)
 	}
 
 	gr, err := gzip.NewReader(f)
 	if err != nil {
-		b.Fatal(err)
+		tb.Fatal(err)
 	}
 
 	return f, gr
 }
 
+// testStatsReader returns a reader of the uncompressed test.stats.gz data, that
+// will be closed when the test completes.
+func testStatsReader(tb testing.TB) io.Reader {
+	tb.Helper()
+
+	f, gr := openTestFile(tb)
+
+	tb.Cleanup(func() {
+		gr.Close()
+		f.Close()
+	})
+
+	return gr
+}
+
+func BenchmarkScanFiltering(b *testing.B) {
+	data, err := io.ReadAll(testStatsReader(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bench := range []struct {
+		name   string
+		filter func(*StatsParser)
+	}{
+		{"unfiltered", func(*StatsParser) {}},
+		{"filtered", func(p *StatsParser) {
+			p.FilterForFilesOlderThan(yearsRelativeToTestFileCreation(7))
+		}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+
+			for n := 0; n < b.N; n++ {
+				p := NewStatsParser(bytes.NewReader(data))
+				bench.filter(p)
+
+				for p.Scan() {
+				}
+
+				if p.Err() != nil {
+					b.Fatal(p.Err())
+				}
+			}
+		})
+	}
+}
+
+// benchmarkSink stops the compiler optimising away the results of benchmarks.
+var benchmarkSink int64
+
+func BenchmarkParseNumber(b *testing.B) {
+	cols := [][]byte{[]byte("0"), []byte("4096"), []byte("1715261665"), []byte("9223372036854775807")}
+	p := &StatsParser{}
+
+	var v, sum int64
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		for _, col := range cols {
+			if !p.parseNumber(col, &v) {
+				b.Fatal(p.error)
+			}
+
+			sum += v
+		}
+	}
+
+	benchmarkSink = sum
+}
+
 func BenchmarkRawScanner(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		b.StopTimer()
@@ -586,3 +4667,133 @@ func BenchmarkBoMDirectoryStats(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkTotalColdBytes(b *testing.B) {
+	data, err := io.ReadAll(testStatsReader(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if _, _, err := TotalColdBytes(bytes.NewReader(data), yearsRelativeToTestFileCreation(7)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBoMDirectoryStatsParallel(b *testing.B) {
+	gtb := openTestGIDToBoM(b)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		parts := splitTestFile(b, "test.stats.gz", workers)
+
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				sps := make([]*StatsParser, len(parts))
+				for i, part := range parts {
+					sps[i] = NewStatsParser(bytes.NewReader(part))
+				}
+
+				stats, err := BoMDirectoryStatsParallel(sps, gtb, yearsRelativeToTestFileCreation(0), 16)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				if len(stats) == 0 {
+					b.Error("BoMDirectoryStatsParallel gave no results")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAccumulatorResults(b *testing.B) {
+	const (
+		numBoMs = 20
+		numDirs = 5000
+	)
+
+	fill := func() *Accumulator {
+		acc := NewAccumulator()
+
+		for i := 0; i < numBoMs; i++ {
+			bom := []byte(fmt.Sprintf("bom%d", i))
+
+			for j := 0; j < numDirs; j++ {
+				acc.Add(bom, []byte(fmt.Sprintf("/a/%d/file", j)), int64(j))
+			}
+		}
+
+		return acc
+	}
+
+	b.Run("Result", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for n := 0; n < b.N; n++ {
+			b.StopTimer()
+			acc := fill()
+			b.StartTimer()
+
+			if len(acc.Result()) != numBoMs*(numDirs+2) {
+				b.Fatal("wrong number of results")
+			}
+		}
+	})
+
+	b.Run("DrainByBoM", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for n := 0; n < b.N; n++ {
+			b.StopTimer()
+			acc := fill()
+			b.StartTimer()
+
+			total := 0
+
+			if err := acc.DrainByBoM(func(stats []*Stats) error {
+				total += len(stats)
+
+				return nil
+			}); err != nil {
+				b.Fatal(err)
+			}
+
+			if total != numBoMs*(numDirs+2) {
+				b.Fatal("wrong number of results")
+			}
+		}
+	})
+}
+
+func BenchmarkBoMDirectoryStatsExpectedDirectories(b *testing.B) {
+	gtb := openTestGIDToBoM(b)
+
+	const numDirs = 100000
+
+	var buf bytes.Buffer
+	for i := 0; i < numDirs; i++ {
+		buf.WriteString(statsLine(fmt.Sprintf("/a/%d/file", i), 1, 808, 0, 0, 0))
+	}
+
+	data := buf.Bytes()
+
+	for _, capacity := range []int{0, numDirs + 2} {
+		b.Run(fmt.Sprintf("capacity=%d", capacity), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				stats, err := BoMDirectoryStats(NewStatsParser(bytes.NewReader(data)), gtb,
+					yearsRelativeToTestFileCreation(0), WithExpectedDirectories(capacity))
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				if len(stats) != numDirs+2 {
+					b.Errorf("BoMDirectoryStats gave %d results", len(stats))
+				}
+			}
+		})
+	}
+}
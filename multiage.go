@@ -0,0 +1,86 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import "time"
+
+// BoMDirectoryStatsMultiAge is like BoMDirectoryStats(), but gets the stats for
+// each of the given durations in a single scan, returning them keyed on
+// duration.
+//
+// Ages are relative to the StatsParser's creation time, or any time given to
+// its SetNow().
+//
+// Returns ErrNoData (along with the empty results) if the StatsParser had no
+// entries at all.
+func BoMDirectoryStatsMultiAge(sp *StatsParser, gp *GIDToBoM,
+	cutoffs []time.Duration) (map[time.Duration][]*Stats, error) {
+	now := time.Unix(sp.now, 0)
+	epochs := make([]int64, len(cutoffs))
+	stores := make([]bomDirectoryStats, len(cutoffs))
+
+	for i, d := range cutoffs {
+		epochs[i] = now.Add(-d).Unix()
+		stores[i] = make(bomDirectoryStats)
+	}
+
+	sp.FilterForFiles()
+
+	if err := accumulateMultiAge(sp, gp, epochs, stores); err != nil {
+		return nil, err
+	}
+
+	results := make(map[time.Duration][]*Stats, len(cutoffs))
+
+	for i, d := range cutoffs {
+		results[d] = sortBoMDirectoryStats(stores[i])
+	}
+
+	if sp.EntriesParsed() == 0 {
+		return results, ErrNoData
+	}
+
+	return results, nil
+}
+
+// accumulateMultiAge scans through all of sp's entries, accumulating their
+// stats in to each of the given stores whose corresponding epoch time the entry
+// is not newer than.
+func accumulateMultiAge(sp *StatsParser, gp *GIDToBoM, epochs []int64, stores []bomDirectoryStats) error {
+	for sp.Scan() {
+		age := sp.ageTime()
+
+		for i, epoch := range epochs {
+			if age > epoch {
+				continue
+			}
+
+			if err := accumulateParsedEntry(sp, gp, stores[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return sp.Err()
+}
@@ -0,0 +1,75 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+)
+
+// jsonStatsRow is a line of WriteBoMDirectoryStatsNDJSON() output.
+type jsonStatsRow struct {
+	BoM       string `json:"bom"`
+	Directory string `json:"directory"`
+	Count     uint64 `json:"count"`
+	Size      int64  `json:"size_bytes"`
+}
+
+// WriteBoMDirectoryStatsNDJSON writes the given BoMDirectoryStats() results to
+// the given writer as newline delimited JSON, with one object per line:
+//
+//	{"bom":"...","directory":"...","count":1,"size_bytes":1}
+func WriteBoMDirectoryStatsNDJSON(w io.Writer, stats []*Stats) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	for _, s := range stats {
+		if err := enc.Encode(jsonStatsRow{
+			BoM:       string(s.BoM),
+			Directory: s.Directory,
+			Count:     s.Count,
+			Size:      s.Size,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// WriteGzippedBoMDirectoryStatsNDJSON is like WriteBoMDirectoryStatsNDJSON(),
+// but gzip compresses the output.
+func WriteGzippedBoMDirectoryStatsNDJSON(w io.Writer, stats []*Stats) error {
+	gw := gzip.NewWriter(w)
+
+	if err := WriteBoMDirectoryStatsNDJSON(gw, stats); err != nil {
+		gw.Close()
+
+		return err
+	}
+
+	return gw.Close()
+}
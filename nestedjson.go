@@ -0,0 +1,111 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// jsonDirectoryStats is the value stored per directory by
+// WriteBoMDirectoryStatsNestedJSON().
+type jsonDirectoryStats struct {
+	Count       uint64 `json:"count"`
+	Size        int64  `json:"size_bytes"`
+	OldestMTime int64  `json:"oldest_mtime"`
+}
+
+// WriteBoMDirectoryStatsNestedJSON writes the given BoMDirectoryStats() results
+// to the given writer as a single JSON object keyed by BoM, then by directory:
+//
+//	{"bom":{"/":{"count":1,"size_bytes":1,"oldest_mtime":1},"/dir":{...}}}
+//
+// BoMs appear in the order they are first seen in the given stats, and each
+// BoM's directories keep their order from the given stats (ie. as sorted).
+func WriteBoMDirectoryStatsNestedJSON(w io.Writer, stats []*Stats) error {
+	boms, byBoM := groupByBoM(stats)
+	bw := bufio.NewWriter(w)
+
+	bw.WriteByte('{')
+
+	for i, bom := range boms {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+
+		if err := writeJSONKey(bw, bom); err != nil {
+			return err
+		}
+
+		if err := writeNestedDirectories(bw, byBoM[bom]); err != nil {
+			return err
+		}
+	}
+
+	bw.WriteString("}\n")
+
+	return bw.Flush()
+}
+
+// writeNestedDirectories writes a JSON object keyed by the directories of the
+// given stats.
+func writeNestedDirectories(bw *bufio.Writer, stats []*Stats) error {
+	bw.WriteByte('{')
+
+	for i, s := range stats {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+
+		if err := writeJSONKey(bw, s.Directory); err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(jsonDirectoryStats{Count: s.Count, Size: s.Size, OldestMTime: s.OldestMTime})
+		if err != nil {
+			return err
+		}
+
+		bw.Write(value)
+	}
+
+	bw.WriteByte('}')
+
+	return nil
+}
+
+// writeJSONKey writes the given string as a JSON object key, followed by a
+// colon.
+func writeJSONKey(bw *bufio.Writer, key string) error {
+	encoded, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	bw.Write(encoded)
+	bw.WriteByte(':')
+
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os/user"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// OwnerType determines whether OwnerTotals() aggregates by UID or GID.
+type OwnerType int
+
+const (
+	OwnerUID OwnerType = iota
+	OwnerGID
+)
+
+// OwnerStats holds the number and size of the files owned by a particular UID
+// or GID in a particular BoM.
+type OwnerStats struct {
+	Owner int64
+	BoM   []byte
+	Count uint64
+	Size  int64 // in bytes
+}
+
+type ownerKey struct {
+	owner int64
+	bom   string
+}
+
+// OwnerTotals uses the given StatsParser and GIDToBoM to find the number and
+// size of all files belonging to each UID or GID (per the given OwnerType) in
+// each BoM area that are older than the given duration. Unlike
+// BoMDirectoryStats(), there is no breakdown by directory.
+//
+// The results are sorted largest Size first.
+func OwnerTotals(sp *StatsParser, gp *GIDToBoM, d time.Duration, by OwnerType) ([]*OwnerStats, error) {
+	sp.FilterForFilesOlderThan(d)
+
+	totals := make(map[ownerKey]*OwnerStats)
+
+	for sp.Scan() {
+		bom, err := gp.GetBom(int(sp.GID))
+		if err != nil {
+			return nil, err
+		}
+
+		ostats := ownerStatsFor(totals, sp.ownerID(by), bom)
+		ostats.Count++
+		ostats.Size += sp.Size
+	}
+
+	if err := sp.Err(); err != nil {
+		return nil, err
+	}
+
+	return sortOwnerStats(totals), nil
+}
+
+func (p *StatsParser) ownerID(by OwnerType) int64 {
+	if by == OwnerGID {
+		return p.GID
+	}
+
+	return p.UID
+}
+
+func ownerStatsFor(totals map[ownerKey]*OwnerStats, owner int64, bom []byte) *OwnerStats {
+	key := ownerKey{owner: owner, bom: string(bom)}
+
+	ostats, ok := totals[key]
+	if !ok {
+		ostats = &OwnerStats{Owner: owner, BoM: bom}
+		totals[key] = ostats
+	}
+
+	return ostats
+}
+
+func sortOwnerStats(totals map[ownerKey]*OwnerStats) []*OwnerStats {
+	results := make([]*OwnerStats, 0, len(totals))
+
+	for _, ostats := range totals {
+		results = append(results, ostats)
+	}
+
+	slices.SortFunc(results, func(a, b *OwnerStats) int {
+		if n := cmp.Compare(b.Size, a.Size); n != 0 {
+			return n
+		}
+
+		if n := cmp.Compare(a.Owner, b.Owner); n != 0 {
+			return n
+		}
+
+		return cmp.Compare(string(a.BoM), string(b.BoM))
+	})
+
+	return results
+}
+
+// PrintOwnerTotals takes OwnerTotals() results for the given OwnerType and
+// writes them as a TSV:
+//
+//	Owner	BoM	Count	Size
+//
+// The size unit and rounding PrintOptions are respected, and owners are output
+// as numeric IDs unless WithOwnerNames() is used.
+func PrintOwnerTotals(w io.Writer, owners []*OwnerStats, by OwnerType, opts ...PrintOption) error {
+	po := newPrintOptions(opts)
+	names := make(map[int64]string)
+
+	for _, ostats := range owners {
+		name := strconv.FormatInt(ostats.Owner, 10)
+
+		if po.ownerNames {
+			name = ownerName(names, ostats.Owner, by)
+		}
+
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%d\t%.2f\n", name, ostats.BoM, ostats.Count,
+			po.convertSize(ostats.Size)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WithOwnerNames makes PrintOwnerTotals() output the user or group name of
+// each owner instead of its numeric ID, falling back to the ID if the name
+// can't be looked up. Note that looking up names takes time, and names are
+// looked up on the current host, which may not match the one the stats came
+// from.
+func WithOwnerNames() PrintOption {
+	return func(po *printOptions) {
+		po.ownerNames = true
+	}
+}
+
+// ownerName returns the name of the given UID or GID (per the given OwnerType),
+// or the ID itself if there isn't one. Names are cached in the given map.
+func ownerName(names map[int64]string, owner int64, by OwnerType) string {
+	if name, ok := names[owner]; ok {
+		return name
+	}
+
+	id := strconv.FormatInt(owner, 10)
+	name := id
+
+	if by == OwnerGID {
+		if g, err := user.LookupGroupId(id); err == nil {
+			name = g.Name
+		}
+	} else if u, err := user.LookupId(id); err == nil {
+		name = u.Username
+	}
+
+	names[owner] = name
+
+	return name
+}
@@ -0,0 +1,81 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const parquetWriterParallelism = 1
+
+// parquetRow is the schema of the rows written by
+// WriteBoMDirectoryStatsParquet().
+type parquetRow struct {
+	BoM       string `parquet:"name=bom, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	Directory string `parquet:"name=directory, type=UTF8"`
+	Count     uint64 `parquet:"name=count, type=UINT_64"`
+	SizeBytes int64  `parquet:"name=size_bytes, type=INT64"`
+}
+
+// WriteBoMDirectoryStatsParquet writes the given stats (as returned by
+// BoMDirectoryStats()) to a single Parquet file at the given path, with one row
+// per Stats and the columns bom, directory, count and size_bytes.
+//
+// Unlike PrintBoMDirectoryStats(), all BoMs go in the same file, and sizes are
+// in bytes.
+func WriteBoMDirectoryStatsParquet(path string, stats []*Stats) error {
+	fw, err := local.NewLocalFileWriter(path)
+	if err != nil {
+		return err
+	}
+
+	pw, err := writer.NewParquetWriter(fw, new(parquetRow), parquetWriterParallelism)
+	if err != nil {
+		fw.Close()
+
+		return err
+	}
+
+	for _, s := range stats {
+		if err = pw.Write(parquetRow{
+			BoM:       string(s.BoM),
+			Directory: s.Directory,
+			Count:     s.Count,
+			SizeBytes: s.Size,
+		}); err != nil {
+			fw.Close()
+
+			return err
+		}
+	}
+
+	if err = pw.WriteStop(); err != nil {
+		fw.Close()
+
+		return err
+	}
+
+	return fw.Close()
+}
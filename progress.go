@@ -0,0 +1,131 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const percent = 100
+
+// ProgressReader wraps a reader, keeping count of the bytes and lines read
+// through it, so that progress can be reported from another goroutine.
+type ProgressReader struct {
+	r     io.Reader
+	total int64
+	bytes atomic.Int64
+	lines atomic.Int64
+}
+
+// NewProgressReader returns a ProgressReader that reads from the given reader,
+// which has the given total size in bytes, or 0 if that is unknown (eg. for a
+// pipe).
+func NewProgressReader(r io.Reader, total int64) *ProgressReader {
+	return &ProgressReader{r: r, total: total}
+}
+
+// InputSize returns the size of the given file if it is a regular file, or 0
+// if its size can't be known, eg. if it's a pipe.
+func InputSize(f *os.File) int64 {
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return 0
+	}
+
+	return info.Size()
+}
+
+// Read implements io.Reader.
+func (pr *ProgressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+
+	pr.bytes.Add(int64(n))
+	pr.lines.Add(int64(bytes.Count(p[:n], []byte{'\n'})))
+
+	return n, err
+}
+
+// Percent returns the percentage of the total size read so far, or -1 if the
+// total size is unknown.
+func (pr *ProgressReader) Percent() float64 {
+	if pr.total <= 0 {
+		return -1
+	}
+
+	return float64(pr.bytes.Load()) / float64(pr.total) * percent
+}
+
+// Lines returns the number of lines read so far.
+func (pr *ProgressReader) Lines() int64 {
+	return pr.lines.Load()
+}
+
+// String describes the progress so far as a percentage, or if the total size
+// is unknown, as the number of lines read.
+func (pr *ProgressReader) String() string {
+	if pct := pr.Percent(); pct >= 0 {
+		return fmt.Sprintf("progress: %.1f%%", pct)
+	}
+
+	return fmt.Sprintf("progress: %d lines", pr.Lines())
+}
+
+// Report writes our String() as a line to the given writer every interval,
+// until the returned function is called, which writes a final line.
+func (pr *ProgressReader) Report(w io.Writer, interval time.Duration) func() {
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Fprintln(w, pr)
+			case <-done:
+				fmt.Fprintln(w, pr)
+
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
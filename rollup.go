@@ -0,0 +1,54 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import "strings"
+
+// RollupToDepth takes the results of BoMDirectoryStats() and returns just the
+// Stats of the directories that are exactly the given number of directories
+// deep, where "/" is at depth 0, "/a" is at depth 1, "/a/b" is at depth 2 and
+// so on. Since each directory's Stats already include everything nested within
+// it, this gives a coarser summary view without needing to re-parse. The order
+// of the given stats is retained.
+func RollupToDepth(stats []*Stats, depth int) []*Stats {
+	var rolled []*Stats
+
+	for _, s := range stats {
+		if dirDepth(s.Directory) == depth {
+			rolled = append(rolled, s)
+		}
+	}
+
+	return rolled
+}
+
+// dirDepth returns the number of directories deep the given directory is,
+// where "/" is at depth 0.
+func dirDepth(dir string) int {
+	if dir == "/" {
+		return 0
+	}
+
+	return strings.Count(dir, "/")
+}
@@ -0,0 +1,153 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+const ErrNoShards = Error("shards must be greater than 0")
+
+// shardedDirectoryStats spreads Stats over a number of bomDirectoryStats
+// shards, selected by a hash of their BoM and directory.
+type shardedDirectoryStats struct {
+	seed   maphash.Seed
+	shards []bomDirectoryStats
+}
+
+func newShardedDirectoryStats(seed maphash.Seed, n int) *shardedDirectoryStats {
+	shards := make([]bomDirectoryStats, n)
+
+	for i := range shards {
+		shards[i] = make(bomDirectoryStats)
+	}
+
+	return &shardedDirectoryStats{
+		seed:   seed,
+		shards: shards,
+	}
+}
+
+// statsFor returns the Stats for the given BoM and directory from the shard
+// their key hashes to, creating it if necessary.
+func (s *shardedDirectoryStats) statsFor(bom []byte, dir string) *Stats {
+	var h maphash.Hash
+
+	h.SetSeed(s.seed)
+	h.Write(bom)                   //nolint:errcheck
+	h.WriteString(bomDirSeparator) //nolint:errcheck
+	h.WriteString(dir)             //nolint:errcheck
+
+	return s.shards[h.Sum64()%uint64(len(s.shards))].statsFor(bom, dir)
+}
+
+// BoMDirectoryStatsParallel is like BoMDirectoryStats(), but scans each of the
+// given StatsParsers in its own goroutine.
+//
+// Each worker accumulates in to its own set of the given number of shards, so
+// no locking is needed during the scan. Because every worker selects shards
+// using the same hash, corresponding shards contain the same keys, and are
+// merged together in parallel at the end.
+func BoMDirectoryStatsParallel(sps []*StatsParser, gp *GIDToBoM, d time.Duration,
+	shards int) ([]*Stats, error) {
+	if shards <= 0 {
+		return nil, ErrNoShards
+	}
+
+	workers, err := scanInParallel(sps, gp, d, shards)
+	if err != nil {
+		return nil, err
+	}
+
+	return sortBoMDirectoryStats(mergeShards(workers, shards)...), nil
+}
+
+func scanInParallel(sps []*StatsParser, gp *GIDToBoM, d time.Duration,
+	shards int) ([]*shardedDirectoryStats, error) {
+	seed := maphash.MakeSeed()
+	workers := make([]*shardedDirectoryStats, len(sps))
+	errs := make([]error, len(sps))
+
+	var wg sync.WaitGroup
+
+	for i, sp := range sps {
+		workers[i] = newShardedDirectoryStats(seed, shards)
+
+		wg.Add(1)
+
+		go func(i int, sp *StatsParser) {
+			defer wg.Done()
+
+			sp.FilterForFilesOlderThan(d)
+			errs[i] = accumulateParsedStats(sp, gp, workers[i])
+		}(i, sp)
+	}
+
+	wg.Wait()
+
+	return workers, errors.Join(errs...)
+}
+
+func mergeShards(workers []*shardedDirectoryStats, shards int) []bomDirectoryStats {
+	merged := make([]bomDirectoryStats, shards)
+
+	var wg sync.WaitGroup
+
+	for i := range merged {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			merged[i] = mergeShard(workers, i)
+		}(i)
+	}
+
+	wg.Wait()
+
+	return merged
+}
+
+func mergeShard(workers []*shardedDirectoryStats, i int) bomDirectoryStats {
+	if len(workers) == 0 {
+		return make(bomDirectoryStats)
+	}
+
+	merged := workers[0].shards[i]
+
+	for _, worker := range workers[1:] {
+		for key, stats := range worker.shards[i] {
+			if existing, ok := merged[key]; ok {
+				existing.add(stats)
+			} else {
+				merged[key] = stats
+			}
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,286 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"container/heap"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"slices"
+)
+
+// WithSpillThreshold makes BoMDirectoryStats() cap the number of Stats it
+// holds in its in-memory map during the scan. Whenever the map grows beyond
+// the given number of entries, all its entries are written (sorted) to a new
+// temporary "run" file in the given directory (os.TempDir() if blank), and the
+// map is emptied.
+//
+// At the end of the scan the runs are merged together, summing entries for
+// the same BoM and directory that were spilled in different runs, and the run
+// files are deleted. Results are identical to not spilling.
+//
+// No assumption is made about the order of the input, but it works best on
+// input sorted by path (as wrstat produces), since then the entries for a
+// directory are rarely split over multiple runs. Note that while this bounds
+// the memory used by the map during the scan, the final merged results are
+// still returned in memory.
+func WithSpillThreshold(entries int, dir string) StatsOption {
+	return func(so *statsOptions) {
+		so.spillThreshold = entries
+		so.spillDir = dir
+	}
+}
+
+// spillingDirectoryStats is a bomDirectoryStats that can spill its entries to
+// disk.
+type spillingDirectoryStats struct {
+	bomDirectoryStats
+	threshold int
+	dir       string
+	runs      []*os.File
+}
+
+func spillingBoMDirectoryStats(sp *StatsParser, gp *GIDToBoM, so *statsOptions) ([]*Stats, error) {
+	if !so.ageFiltered(sp) {
+		return nil, ErrNoAgeFilter
+	}
+
+	s := &spillingDirectoryStats{
+		bomDirectoryStats: make(bomDirectoryStats),
+		threshold:         so.spillThreshold,
+		dir:               so.spillDir,
+	}
+
+	defer s.cleanup()
+
+	for sp.Scan() {
+		bom, err := gp.GetBom(int(sp.GID))
+		if err != nil {
+			return nil, err
+		}
+
+		so.accumulateIfOld(sp, bom, s)
+
+		if err := s.maybeSpill(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := sp.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.results()
+}
+
+// maybeSpill spills our entries to a new run if we have more than our
+// threshold.
+func (s *spillingDirectoryStats) maybeSpill() error {
+	if len(s.bomDirectoryStats) <= s.threshold {
+		return nil
+	}
+
+	return s.spill()
+}
+
+// spill writes all our entries, sorted by compareBoMDirs(), to a new temporary
+// run file, and empties our map.
+func (s *spillingDirectoryStats) spill() error {
+	f, err := os.CreateTemp(s.dir, "stats-parse-spill-*")
+	if err != nil {
+		return err
+	}
+
+	s.runs = append(s.runs, f)
+
+	entries := make([]*Stats, 0, len(s.bomDirectoryStats))
+	for _, stats := range s.bomDirectoryStats {
+		entries = append(entries, stats)
+	}
+
+	slices.SortFunc(entries, compareBoMDirs)
+
+	bw := bufio.NewWriter(f)
+	enc := gob.NewEncoder(bw)
+
+	for _, stats := range entries {
+		if err = enc.Encode(stats); err != nil {
+			return err
+		}
+	}
+
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+
+	s.bomDirectoryStats = make(bomDirectoryStats)
+
+	_, err = f.Seek(0, io.SeekStart)
+
+	return err
+}
+
+func compareBoMDirs(a, b *Stats) int {
+	if n := bytes.Compare(a.BoM, b.BoM); n != 0 {
+		return n
+	}
+
+	return cmp.Compare(a.Directory, b.Directory)
+}
+
+// results returns the sorted results of merging all our runs, or just our map
+// contents if we never spilled.
+func (s *spillingDirectoryStats) results() ([]*Stats, error) {
+	if len(s.runs) == 0 {
+		return sortBoMDirectoryStats(s.bomDirectoryStats), nil
+	}
+
+	if len(s.bomDirectoryStats) > 0 {
+		if err := s.spill(); err != nil {
+			return nil, err
+		}
+	}
+
+	results, err := mergeRuns(s.runs)
+	if err != nil {
+		return nil, err
+	}
+
+	sortStats(results)
+
+	return results, nil
+}
+
+// cleanup closes and deletes our run files.
+func (s *spillingDirectoryStats) cleanup() {
+	for _, f := range s.runs {
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
+
+// runReader reads Stats from a run file.
+type runReader struct {
+	dec     *gob.Decoder
+	current *Stats
+}
+
+// next reads the next Stats in to current, returning false at the end of the
+// run.
+func (r *runReader) next() (bool, error) {
+	r.current = &Stats{}
+
+	err := r.dec.Decode(r.current)
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// runHeap is a min-heap of runReaders ordered by their current Stats.
+type runHeap []*runReader
+
+func (h runHeap) Len() int           { return len(h) }
+func (h runHeap) Less(i, j int) bool { return compareBoMDirs(h[i].current, h[j].current) < 0 }
+func (h runHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)        { *h = append(*h, x.(*runReader)) } //nolint:forcetypeassert
+
+func (h *runHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return r
+}
+
+// mergeRuns does a k-way merge of the given sorted run files, summing Stats for
+// the same BoM and directory.
+func mergeRuns(runs []*os.File) ([]*Stats, error) {
+	h, err := newRunHeap(runs)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*Stats
+
+	for h.Len() > 0 {
+		r := (*h)[0]
+
+		if last := len(results) - 1; last >= 0 && compareBoMDirs(results[last], r.current) == 0 {
+			results[last].add(r.current)
+		} else {
+			results = append(results, r.current)
+		}
+
+		if err = advanceRunHeap(h); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+func newRunHeap(runs []*os.File) (*runHeap, error) {
+	h := make(runHeap, 0, len(runs))
+
+	for _, f := range runs {
+		r := &runReader{dec: gob.NewDecoder(bufio.NewReader(f))}
+
+		ok, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			h = append(h, r)
+		}
+	}
+
+	heap.Init(&h)
+
+	return &h, nil
+}
+
+// advanceRunHeap moves the smallest runReader on to its next Stats, removing
+// it from the heap if its run is finished.
+func advanceRunHeap(h *runHeap) error {
+	ok, err := (*h)[0].next()
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		heap.Fix(h, 0)
+	} else {
+		heap.Pop(h)
+	}
+
+	return nil
+}
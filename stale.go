@@ -0,0 +1,91 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WithStaleFileRemoval makes PrintBoMDirectoryStats(), after successfully
+// writing all its files, delete any other "[prefix].*.tsv" files, such as
+// those of BoMs that no longer exist, so that the files with the prefix always
+// hold a faithful snapshot of the latest run. Files with other prefixes are
+// left alone. An index.tsv in the same directory is also deleted if
+// WithIndex() wasn't used, since it would no longer describe the outputs.
+func WithStaleFileRemoval() PrintOption {
+	return func(po *printOptions) {
+		po.removeStale = true
+	}
+}
+
+// removeStaleFiles deletes any "[prefix].*.tsv" files that aren't one of the
+// given current files, and the given index file unless we wrote it, if
+// WithStaleFileRemoval() was used.
+func (po *printOptions) removeStaleFiles(prefix string, current []string, indexPath string) error {
+	if !po.removeStale {
+		return nil
+	}
+
+	keep := make(map[string]bool, len(current))
+
+	for _, path := range current {
+		keep[filepath.Clean(path)] = true
+	}
+
+	dir, base := filepath.Dir(prefix), filepath.Base(prefix)+"."
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, base) || !strings.HasSuffix(name, ".tsv") {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		if keep[path] {
+			continue
+		}
+
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	if po.index != nil {
+		return nil
+	}
+
+	if err = os.Remove(indexPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
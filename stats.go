@@ -25,8 +25,10 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/base64"
 	"io"
+	"math"
 	"time"
 )
 
@@ -42,54 +44,179 @@ const (
 	secsPerYear                = 3600 * 24 * 365
 	maxLineLength              = 64 * 1024
 	maxBase64EncodedPathLength = 1024
-
-	ErrBadPath       = Error("invalid file format: path is not base64 encoded")
-	ErrTooFewColumns = Error("invalid file format: too few tab separated columns")
+	maxInt64Digits             = 19
+
+	ErrBadPath        = Error("invalid file format: path is not base64 encoded")
+	ErrTooFewColumns  = Error("invalid file format: too few tab separated columns")
+	ErrPathTooLong    = Error("invalid file format: encoded path is too long")
+	ErrTruncatedInput = Error("invalid file format: incomplete final line; input may be truncated")
+	ErrBadNumber      = Error("invalid file format: numeric column contains a non-digit")
+	ErrEmptyColumn    = Error("invalid file format: numeric column is empty")
+	ErrNumberTooLarge = Error("invalid file format: numeric column is too large")
+	ErrEmptyFileSize  = Error("invalid file format: size of a file is empty; line may be truncated")
+	ErrNotReReadable  = Error("stats parser's input can not be re-read")
 )
 
 // StatsParser is used to parse wrstat stats files.
 type StatsParser struct {
+	source           io.Reader
+	start            int64
 	scanner          *bufio.Scanner
 	pathBuffer       []byte
-	filter           func() bool
+	filters          []func() bool
 	epochTimeDesired int64
+	ageFiltered      bool
+	maxAge           time.Duration
+	mtimeMaxAge      time.Duration
+	ctimeMaxAge      time.Duration
+	mtimeDesired     int64
+	ctimeDesired     int64
+	now              int64
+	countFuture      bool
+	futureFiles      uint64
+	futureReport     io.Writer
+	ageMetric        AgeMetric
+	pathEncoding     PathEncoding
+	sizeMissing      bool
+	missingFileSize  int64
+	hasMissingSize   bool
+	entriesParsed    uint64
+	limit            int
+	yielded          int
+	sampleEvery      uint64
+	sampleSeen       uint64
+	foldPathCase     bool
+	normalisePaths   bool
+	skipPaths        bool
+	depthCap         int
+	maxSegments      int
+	tooDeep          uint64
+	offset           int64
+	unterminated     bool
 	lineBytes        []byte
 	lineLength       int
 	lineIndex        int
 	Path             []byte
 	Size             int64
+	UID              int64
 	GID              int64
+	ATime            int64
 	MTime            int64
 	CTime            int64
 	EntryType        byte
+	Inode            int64
+	Nlink            int64
 	error            error
 }
 
 // NewStatsParser is used to create a new StatsParser, given uncompressed wrstat
 // stats data.
 func NewStatsParser(r io.Reader) *StatsParser {
-	scanner := bufio.NewScanner(r)
-	scanner.Buffer(make([]byte, 0, maxLineLength), maxLineLength)
-
-	return &StatsParser{
-		scanner:    scanner,
+	p := &StatsParser{
+		source:     r,
+		scanner:    bufio.NewScanner(r),
 		pathBuffer: make([]byte, base64.StdEncoding.DecodedLen(maxBase64EncodedPathLength)),
-		filter:     noFilter,
+		now:        time.Now().Unix(),
 	}
+
+	p.scanner.Buffer(make([]byte, 0, maxLineLength), maxLineLength)
+	p.scanner.Split(p.scanLines)
+
+	return p
 }
 
-func noFilter() bool {
-	return true
+// NewStatsParserAt is like NewStatsParser(), but first seeks to the given byte
+// offset in the given data, which should be a previous Offset() to resume
+// parsing from.
+func NewStatsParserAt(r io.ReadSeeker, offset int64) (*StatsParser, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	p := NewStatsParser(r)
+	p.offset = offset
+	p.start = offset
+
+	return p, nil
+}
+
+// Clone returns a new StatsParser that parses the same data as this one from
+// the start (or the offset given to NewStatsParserAt()), independently of this
+// one and any other clones, so that you can make multiple passes with different
+// filters over data you already have in memory.
+//
+// The clone has the same settings as this one, such as those from
+// SetAgeMetric(), SetNow(), SetPathEncoding() and SetMissingFileSize(), but none
+// of its filters.
+//
+// This requires the data to be re-readable, so the io.Reader this StatsParser
+// was created with must also be an io.ReaderAt, like a *bytes.Reader or
+// *os.File; otherwise ErrNotReReadable is returned.
+func (p *StatsParser) Clone() (*StatsParser, error) {
+	ra, ok := p.source.(io.ReaderAt)
+	if !ok {
+		return nil, ErrNotReReadable
+	}
+
+	clone := NewStatsParser(io.NewSectionReader(ra, p.start, math.MaxInt64-p.start))
+	clone.source = p.source
+	clone.start = p.start
+	clone.offset = p.start
+	clone.now = p.now
+	clone.ageMetric = p.ageMetric
+	clone.pathEncoding = p.pathEncoding
+	clone.foldPathCase = p.foldPathCase
+	clone.normalisePaths = p.normalisePaths
+	clone.skipPaths = p.skipPaths
+	clone.depthCap = p.depthCap
+	clone.maxSegments = p.maxSegments
+	clone.missingFileSize = p.missingFileSize
+	clone.hasMissingSize = p.hasMissingSize
+
+	return clone, nil
+}
+
+// scanLines is a bufio.SplitFunc like bufio.ScanLines, that also keeps track of
+// our offset, and whether the final line was missing its newline.
+func (p *StatsParser) scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	p.offset += int64(advance)
+
+	if atEOF && advance > 0 && data[advance-1] != '\n' {
+		p.unterminated = true
+	}
+
+	return advance, token, err
 }
 
 // Scan is used to read the next line of stats data, which will then be
-// available through the Path, Size, GID, MTime, CTime and EntryType properties.
+// available through the Path, Size, UID, GID, ATime, MTime, CTime, EntryType,
+// Inode and Nlink properties, or as a whole via Entry().
 //
 // It returns false when the scan stops, either by reaching the end of the input
 // or an error. After Scan returns false, the Err method will return any error
 // that occurred during scanning, except that if it was io.EOF, Err will return
-// nil.
+// nil. If the final line could not be parsed and was missing its newline, the
+// error will be ErrTruncatedInput.
 func (p *StatsParser) Scan() bool {
+	if p.limit > 0 && p.yielded >= p.limit {
+		return false
+	}
+
+	if !p.scanNext() {
+		if p.error != nil && p.unterminated {
+			p.error = ErrTruncatedInput
+		}
+
+		return false
+	}
+
+	p.yielded++
+
+	return true
+}
+
+func (p *StatsParser) scanNext() bool {
 	keepGoing := p.scanner.Scan()
 	if !keepGoing {
 		return false
@@ -106,52 +233,178 @@ func (p *StatsParser) parseLine() bool {
 		return true
 	}
 
+	encodedPath, ok := p.parseColumns()
+	if !ok {
+		return false
+	}
+
+	p.entriesParsed++
+
+	if p.countFuture && !p.checkFuture(encodedPath) {
+		return false
+	}
+
+	if p.filtering() && (!p.passesFilters() || !p.sampled()) {
+		return p.scanNext()
+	}
+
+	if p.skipPaths {
+		p.Path = nil
+
+		return true
+	}
+
+	if !p.decodePath(encodedPath) {
+		return false
+	}
+
+	if p.isTooDeep() {
+		return p.scanNext()
+	}
+
+	return true
+}
+
+// parseColumns parses all the columns of the current line except the path,
+// which is returned still encoded.
+func (p *StatsParser) parseColumns() ([]byte, bool) {
 	p.lineIndex = 0
 
 	encodedPath, ok := p.parseNextColumn()
 	if !ok {
-		return false
+		return nil, false
 	}
 
 	if !p.parseColumns2to7() {
-		return false
+		return nil, false
 	}
 
 	entryTypeCol, ok := p.parseNextColumn()
 	if !ok {
-		return false
+		return nil, false
+	}
+
+	if len(entryTypeCol) == 0 {
+		p.error = ErrTooFewColumns
+
+		return nil, false
 	}
 
 	p.EntryType = entryTypeCol[0]
 
-	if filterResult := p.filter(); !filterResult {
-		return p.Scan()
+	if p.sizeMissing && !p.resolveMissingSize() {
+		return nil, false
 	}
 
-	return p.decodePath(encodedPath)
+	return encodedPath, p.parseOptionalColumns9and10()
 }
 
 func (p *StatsParser) parseColumns2to7() bool {
-	for _, val := range []*int64{&p.Size, nil, &p.GID, nil, &p.MTime, &p.CTime} {
+	if !p.parseSizeColumn() {
+		return false
+	}
+
+	for _, val := range []*int64{&p.UID, &p.GID} {
 		if !p.parseNumberColumn(val) {
 			return false
 		}
 	}
 
+	for _, val := range []*int64{&p.ATime, &p.MTime, &p.CTime} {
+		if !p.parseTimeColumn(val) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseSizeColumn parses the size column, noting if it is empty, since that is
+// only valid for entries other than files, and we don't know the entry type yet.
+func (p *StatsParser) parseSizeColumn() bool {
+	col, ok := p.parseNextColumn()
+	if !ok {
+		return false
+	}
+
+	p.sizeMissing = len(col) == 0
+	if p.sizeMissing {
+		p.Size = 0
+
+		return true
+	}
+
+	return p.parseNumber(col, &p.Size)
+}
+
+// resolveMissingSize is called when the current entry's size column was empty.
+// That's fine for entries other than files, which get a Size of 0, but files
+// get the size set with SetMissingFileSize(), or else our error is set to
+// ErrEmptyFileSize and false is returned.
+func (p *StatsParser) resolveMissingSize() bool {
+	if p.EntryType != fileType {
+		return true
+	}
+
+	if !p.hasMissingSize {
+		p.error = ErrEmptyFileSize
+
+		return false
+	}
+
+	p.Size = p.missingFileSize
+
+	return true
+}
+
+// SetMissingFileSize makes files whose size column is empty be given the given
+// Size, instead of Scan() failing with ErrEmptyFileSize. (Entries other than
+// files with an empty size column always get a Size of 0.)
+func (p *StatsParser) SetMissingFileSize(size int64) {
+	p.missingFileSize = size
+	p.hasMissingSize = true
+}
+
+// parseOptionalColumns9and10 parses the inode and hardlink count columns, which
+// are left as 0 if not present, since older stats files may not have them.
+// Returns false if a present column isn't a number.
+func (p *StatsParser) parseOptionalColumns9and10() bool {
+	p.Inode, p.Nlink = 0, 0
+
+	for _, v := range []*int64{&p.Inode, &p.Nlink} {
+		col, ok := p.nextColumn()
+		if !ok {
+			return true
+		}
+
+		if !p.parseNumber(col, v) {
+			return false
+		}
+	}
+
 	return true
 }
 
 func (p *StatsParser) parseNextColumn() ([]byte, bool) {
+	col, ok := p.nextColumn()
+	if !ok {
+		p.error = ErrTooFewColumns
+	}
+
+	return col, ok
+}
+
+// nextColumn returns the next tab terminated column of the current line, or
+// false if there isn't one.
+func (p *StatsParser) nextColumn() ([]byte, bool) {
 	start := p.lineIndex
 
-	for p.lineBytes[p.lineIndex] != '\t' {
+	for p.lineIndex < p.lineLength && p.lineBytes[p.lineIndex] != '\t' {
 		p.lineIndex++
+	}
 
-		if p.lineIndex >= p.lineLength {
-			p.error = ErrTooFewColumns
-
-			return nil, false
-		}
+	if p.lineIndex >= p.lineLength {
+		return nil, false
 	}
 
 	end := p.lineIndex
@@ -170,17 +423,90 @@ func (p *StatsParser) parseNumberColumn(v *int64) bool {
 		return true
 	}
 
-	*v = 0
+	return p.parseNumber(col, v)
+}
+
+// parseTimeColumn is like parseNumberColumn(), but also accepts a negative
+// number, since files can have times before the epoch.
+func (p *StatsParser) parseTimeColumn(v *int64) bool {
+	col, ok := p.parseNextColumn()
+	if !ok {
+		return false
+	}
+
+	digits, negative := bytes.CutPrefix(col, []byte{'-'})
+	if negative && len(digits) == 0 {
+		p.error = ErrBadNumber
+
+		return false
+	}
+
+	if !p.parseNumber(digits, v) {
+		return false
+	}
+
+	if negative {
+		*v = -*v
+	}
+
+	return true
+}
+
+// parseNumber parses the given column of digits in to v, setting our error to
+// ErrBadNumber and returning false if it contains anything else, or to
+// ErrEmptyColumn if it is empty (so that eg. a missing GID isn't taken to be
+// GID 0).
+//
+// Numbers that don't fit in an int64 give ErrNumberTooLarge. Columns with more
+// digits than the largest int64 are rejected with that error up front, so the
+// digits are summed in a uint64, which can't wrap, and only checked against
+// the int64 limit at the end.
+func (p *StatsParser) parseNumber(col []byte, v *int64) bool {
+	switch {
+	case len(col) == 0:
+		p.error = ErrEmptyColumn
+
+		return false
+	case len(col) > maxInt64Digits:
+		p.error = ErrNumberTooLarge
+
+		return false
+	}
+
+	var n uint64
 
 	for _, c := range col {
-		*v = *v*10 + int64(c) - '0'
+		d := c - '0'
+		if d > 9 {
+			p.error = ErrBadNumber
+
+			return false
+		}
+
+		n = n*10 + uint64(d)
 	}
 
+	if n > math.MaxInt64 {
+		p.error = ErrNumberTooLarge
+
+		return false
+	}
+
+	*v = int64(n)
+
 	return true
 }
 
 func (p *StatsParser) decodePath(encodedPath []byte) bool {
-	l, err := base64.StdEncoding.Decode(p.pathBuffer, encodedPath)
+	enc := p.pathEncoding.encoding(encodedPath)
+
+	if enc.DecodedLen(len(encodedPath)) > len(p.pathBuffer) {
+		p.error = ErrPathTooLong
+
+		return false
+	}
+
+	l, err := enc.Decode(p.pathBuffer, encodedPath)
 	if err != nil {
 		p.error = ErrBadPath
 
@@ -189,14 +515,155 @@ func (p *StatsParser) decodePath(encodedPath []byte) bool {
 
 	p.Path = p.pathBuffer[:l]
 
+	if p.foldPathCase {
+		p.Path = bytes.ToLower(p.Path)
+	}
+
+	if p.normalisePaths {
+		p.Path = normalisePath(p.Path)
+	}
+
+	if p.depthCap > 0 {
+		p.Path = capPathDepth(p.Path, p.depthCap)
+	}
+
+	return true
+}
+
+// SkipPaths makes Scan() not decode the path of each entry, leaving Path nil,
+// for faster scanning when you only need the other columns. Invalid paths will
+// then not result in an error.
+func (p *StatsParser) SkipPaths() {
+	p.skipPaths = true
+}
+
+// CountFutureFiles makes Scan() count the files whose mtime or ctime is after
+// the time this StatsParser was created (or SetNow()), regardless of any
+// filters. Such files are a sign of clock skew or bad restores, and would never
+// be found to be old. Get the count with FutureFiles().
+//
+// If the given writer is not nil, the path of each such file is also written to
+// it, one per line.
+func (p *StatsParser) CountFutureFiles(report io.Writer) {
+	p.countFuture = true
+	p.futureReport = report
+}
+
+// FutureFiles returns the number of files found to have an mtime or ctime in
+// the future so far, if CountFutureFiles() was called.
+func (p *StatsParser) FutureFiles() uint64 {
+	return p.futureFiles
+}
+
+// checkFuture counts the current entry if it is a file with a time in the
+// future, writing its path to our report if we have one. Returns false if the
+// path couldn't be decoded or written.
+func (p *StatsParser) checkFuture(encodedPath []byte) bool {
+	if p.EntryType != fileType || (p.MTime <= p.now && p.CTime <= p.now) {
+		return true
+	}
+
+	p.futureFiles++
+
+	if p.futureReport == nil {
+		return true
+	}
+
+	if !p.decodePath(encodedPath) {
+		return false
+	}
+
+	if _, err := p.futureReport.Write(append(p.Path, '\n')); err != nil {
+		p.error = err
+
+		return false
+	}
+
 	return true
 }
 
+// filtering returns true if any filters or sampling have been configured, so
+// that the common unfiltered case can skip checking each entry.
+func (p *StatsParser) filtering() bool {
+	return len(p.filters) > 0 || p.sampleEvery > 1
+}
+
+// passesFilters returns true if the current entry passes all our filters.
+func (p *StatsParser) passesFilters() bool {
+	for _, filter := range p.filters {
+		if !filter() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sampled returns true if the current entry, which has passed our filters, is
+// one of the ones we want when sampling.
+func (p *StatsParser) sampled() bool {
+	if p.sampleEvery <= 1 {
+		return true
+	}
+
+	p.sampleSeen++
+
+	return p.sampleSeen%p.sampleEvery == 0
+}
+
 // FilterForFilesOlderThan alters Scan() so that it skips lines for entries
 // that are not files and not older than the given duration.
+//
+// Like all the FilterFor* methods, this adds to any existing filters, with
+// Scan() only returning entries that pass all of them.
 func (p *StatsParser) FilterForFilesOlderThan(d time.Duration) {
-	p.filter = p.filterForOldFiles
-	p.epochTimeDesired = time.Now().Add(-d).Unix()
+	p.filters = append(p.filters, p.filterForOldFiles)
+	p.maxAge = d
+	p.ageFiltered = true
+	p.setEpochTimeDesired()
+}
+
+// SetNow changes the time that ages are relative to (and after which times are
+// considered to be in the future) from the time this StatsParser was created.
+// Using the time the stats data was collected makes results reproducible, eg.
+// when re-parsing an archived stats file.
+func (p *StatsParser) SetNow(now time.Time) {
+	p.now = now.Unix()
+
+	if p.ageFiltered {
+		p.setEpochTimeDesired()
+	}
+}
+
+func (p *StatsParser) setEpochTimeDesired() {
+	now := time.Unix(p.now, 0)
+	p.epochTimeDesired = now.Add(-p.maxAge).Unix()
+	p.mtimeDesired = now.Add(-p.mtimeMaxAge).Unix()
+	p.ctimeDesired = now.Add(-p.ctimeMaxAge).Unix()
+}
+
+// FilterForMTimeAndCTimeOlderThan alters Scan() so that it skips lines for
+// entries that are not files with both an mtime older than the given mtimeAge
+// and a ctime older than the given ctimeAge. This lets you use separate
+// cutoffs, eg. for files modified more than 5 years ago whose metadata also
+// hasn't changed for a year, ignoring the AgeMetric.
+func (p *StatsParser) FilterForMTimeAndCTimeOlderThan(mtimeAge, ctimeAge time.Duration) {
+	p.filters = append(p.filters, p.filterForOldMTimeAndCTime)
+	p.mtimeMaxAge = mtimeAge
+	p.ctimeMaxAge = ctimeAge
+	p.ageFiltered = true
+	p.setEpochTimeDesired()
+}
+
+func (p *StatsParser) filterForOldMTimeAndCTime() bool {
+	return p.EntryType == fileType && p.MTime <= p.mtimeDesired && p.CTime <= p.ctimeDesired
+}
+
+// AgeFiltered returns true if FilterForFilesOlderThan() or
+// FilterForMTimeAndCTimeOlderThan() has been called, so that Scan() will only
+// return old files.
+func (p *StatsParser) AgeFiltered() bool {
+	return p.ageFiltered
 }
 
 func (p *StatsParser) filterForOldFiles() bool {
@@ -204,13 +671,310 @@ func (p *StatsParser) filterForOldFiles() bool {
 		return false
 	}
 
-	if min(p.MTime, p.CTime) > p.epochTimeDesired {
+	if p.ageTime() > p.epochTimeDesired {
+		return false
+	}
+
+	return true
+}
+
+// ageTime returns the epoch time that is considered the age of the current
+// entry, per our AgeMetric.
+func (p *StatsParser) ageTime() int64 {
+	return p.ageMetric.time(p.ATime, p.MTime, p.CTime)
+}
+
+// FilterForFiles alters Scan() so that it skips lines for entries that are not
+// files.
+func (p *StatsParser) FilterForFiles() {
+	p.FilterForType(fileType)
+}
+
+// FilterForType alters Scan() so that it skips lines for entries that are not
+// of the given type, eg. 'd' for directories.
+func (p *StatsParser) FilterForType(entryType byte) {
+	p.filters = append(p.filters, func() bool {
+		return p.EntryType == entryType
+	})
+}
+
+// AgeMetric determines which of an entry's times are used to decide its age.
+type AgeMetric int
+
+const (
+	// OldestOfCM uses the oldest of ctime and mtime. This is the default.
+	OldestOfCM AgeMetric = iota
+
+	// NewestOfAM uses the newest of atime and mtime, so an entry is only old
+	// if it has been neither accessed nor modified recently.
+	NewestOfAM
+)
+
+const ErrBadAgeMetric = Error("invalid age metric")
+
+// ParseAgeMetric returns the AgeMetric named "oldest-cm" or "newest-am".
+func ParseAgeMetric(name string) (AgeMetric, error) {
+	switch name {
+	case "oldest-cm":
+		return OldestOfCM, nil
+	case "newest-am":
+		return NewestOfAM, nil
+	default:
+		return OldestOfCM, ErrBadAgeMetric
+	}
+}
+
+// time returns the epoch time that should be considered the age of an entry
+// with the given times.
+func (m AgeMetric) time(atime, mtime, ctime int64) int64 {
+	if m == NewestOfAM {
+		return max(atime, mtime)
+	}
+
+	return min(mtime, ctime)
+}
+
+// SetAgeMetric changes how FilterForFilesOlderThan() determines the age of
+// entries, from the default OldestOfCM.
+func (p *StatsParser) SetAgeMetric(m AgeMetric) {
+	p.ageMetric = m
+}
+
+// PathEncoding determines how the base64 encoded paths in stats data are
+// decoded.
+type PathEncoding int
+
+const (
+	// PaddedBase64 requires paths to be standard, padded, base64. This is the
+	// default.
+	PaddedBase64 PathEncoding = iota
+
+	// UnpaddedBase64 requires paths to be base64 without padding.
+	UnpaddedBase64
+
+	// AnyPaddingBase64 accepts paths with or without padding, detecting which
+	// from the length of each path.
+	AnyPaddingBase64
+)
+
+const ErrBadPathEncoding = Error("invalid path encoding")
+
+// ParsePathEncoding returns the PathEncoding named "padded", "unpadded" or
+// "any".
+func ParsePathEncoding(name string) (PathEncoding, error) {
+	switch name {
+	case "padded":
+		return PaddedBase64, nil
+	case "unpadded":
+		return UnpaddedBase64, nil
+	case "any":
+		return AnyPaddingBase64, nil
+	default:
+		return PaddedBase64, ErrBadPathEncoding
+	}
+}
+
+// encoding returns the base64 encoding that should be used to decode the given
+// encoded path.
+func (e PathEncoding) encoding(encodedPath []byte) *base64.Encoding {
+	switch e {
+	case UnpaddedBase64:
+		return base64.RawStdEncoding
+	case AnyPaddingBase64:
+		if len(encodedPath)%4 != 0 {
+			return base64.RawStdEncoding
+		}
+	case PaddedBase64:
+	}
+
+	return base64.StdEncoding
+}
+
+// SetPathEncoding changes how paths are decoded, from the default PaddedBase64,
+// for stats data produced by something that doesn't pad its base64.
+func (p *StatsParser) SetPathEncoding(e PathEncoding) {
+	p.pathEncoding = e
+}
+
+// FilterForExactSize alters Scan() so that it skips lines for entries that are
+// not files of exactly the given size.
+func (p *StatsParser) FilterForExactSize(size int64) {
+	p.filters = append(p.filters, func() bool {
+		return p.EntryType == fileType && p.Size == size
+	})
+}
+
+// Limit alters Scan() so that it returns false once it has returned n entries,
+// letting you quickly look at just the start of a large file. Entries skipped
+// by filters do not count towards the limit. A limit of 0 or less means no
+// limit.
+func (p *StatsParser) Limit(n int) {
+	p.limit = n
+}
+
+// Sample alters Scan() so that it only returns every nth entry that passes the
+// filters, letting you cheaply estimate results for very large files. Note that
+// you should multiply any counts or sizes you calculate from the sampled
+// entries by n to get an estimate for the whole file. An n of 1 or less means
+// no sampling.
+func (p *StatsParser) Sample(n int) {
+	p.sampleEvery = uint64(max(n, 0))
+}
+
+// FoldPathCase makes Scan() lowercase every Path, so that paths on case
+// insensitive filesystems that only differ by case will aggregate together.
+func (p *StatsParser) FoldPathCase() {
+	p.foldPathCase = true
+}
+
+// NormalisePaths makes Scan() collapse repeated slashes and remove "."
+// segments in every Path, so that malformed paths like "/a//b" and "/a/./b"
+// aggregate together with "/a/b". ".." segments are left alone, since resolving
+// them could attribute files to the wrong directory if a segment was a symlink.
+func (p *StatsParser) NormalisePaths() {
+	p.normalisePaths = true
+}
+
+// normalisePath collapses repeated slashes and removes "." segments and any
+// trailing slash in the given path, in place.
+func normalisePath(path []byte) []byte {
+	w := 0
+
+	for r := 0; r < len(path); {
+		end := bytes.IndexByte(path[r:], '/')
+		if end == -1 {
+			end = len(path)
+		} else {
+			end += r
+		}
+
+		segment := path[r:end]
+		r = end + 1
+
+		if len(segment) == 0 || (len(segment) == 1 && segment[0] == '.') {
+			continue
+		}
+
+		path[w] = '/'
+		w++
+		w += copy(path[w:], segment)
+	}
+
+	if w == 0 {
+		return append(path[:0], '/')
+	}
+
+	return path[:w]
+}
+
+// FilterOutGIDs alters Scan() so that it skips lines for entries belonging to
+// any of the given GIDs.
+func (p *StatsParser) FilterOutGIDs(gids []int) {
+	excluded := make(map[int64]bool, len(gids))
+
+	for _, gid := range gids {
+		excluded[int64(gid)] = true
+	}
+
+	p.filters = append(p.filters, func() bool {
+		return !excluded[p.GID]
+	})
+}
+
+// FilterOutGIDRanges is like FilterOutGIDs(), but takes inclusive ranges of
+// GIDs, which are not expanded, so that even a huge range is cheap.
+func (p *StatsParser) FilterOutGIDRanges(ranges []GIDRange) {
+	p.filters = append(p.filters, func() bool {
+		for _, r := range ranges {
+			if r.Contains(int(p.GID)) {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// CapDepth makes Scan() truncate every Path that is nested more than the given
+// number of directories deep, so that it appears to be a file directly within
+// its ancestor directory at that depth. This means that when aggregated, the
+// files below that depth are counted in their depth-capped ancestor, without
+// creating any deeper directories. A depth of 0 or less means no cap.
+func (p *StatsParser) CapDepth(depth int) {
+	p.depthCap = depth
+}
+
+// MaxPathSegments makes Scan() skip any entry whose Path (after any CapDepth())
+// has more than the given number of segments, so that a pathologically deep
+// path can't make aggregation create a Stats for each of its thousands of
+// ancestor directories. A limit of 0 or less means no limit. Get the number
+// skipped with TooDeep().
+func (p *StatsParser) MaxPathSegments(limit int) {
+	p.maxSegments = limit
+}
+
+// TooDeep returns the number of entries skipped so far due to
+// MaxPathSegments().
+func (p *StatsParser) TooDeep() uint64 {
+	return p.tooDeep
+}
+
+// isTooDeep returns true, counting it, if the current Path has more segments
+// than our MaxPathSegments().
+func (p *StatsParser) isTooDeep() bool {
+	if p.maxSegments <= 0 || bytes.Count(p.Path, []byte{'/'}) <= p.maxSegments {
 		return false
 	}
 
+	p.tooDeep++
+
 	return true
 }
 
+// capPathDepth returns the given path truncated so that its directories are at
+// most the given depth.
+func capPathDepth(path []byte, depth int) []byte {
+	slashes := 0
+
+	for i, b := range path {
+		if b != '/' {
+			continue
+		}
+
+		slashes++
+
+		if slashes > depth+1 {
+			return path[:i]
+		}
+	}
+
+	return path
+}
+
+// Offset returns the byte offset in the input data of the start of the line
+// after the one most recently read by Scan(). After a crash, you could resume
+// parsing from that line by passing this offset to NewStatsParserAt().
+//
+// Note that the offset is of the uncompressed data, and that lines skipped by
+// filters are included, so resuming will not return them again.
+func (p *StatsParser) Offset() int64 {
+	return p.offset
+}
+
+// Line returns the raw bytes (without the trailing newline) of the line most
+// recently read by Scan(), which can be useful when debugging filters. Note
+// that the returned slice is only valid until the next call to Scan(), so copy
+// it if you need to keep it.
+func (p *StatsParser) Line() []byte {
+	return p.lineBytes
+}
+
+// EntriesParsed returns the number of entries parsed so far, including those
+// skipped by filters.
+func (p *StatsParser) EntriesParsed() uint64 {
+	return p.entriesParsed
+}
+
 // Err returns the first non-EOF error that was encountered, available after
 // Scan() returns false.
 func (p *StatsParser) Err() error {
@@ -0,0 +1,111 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// WithThousandsSeparators makes PrintRunSummary() output counts with commas
+// separating each group of thousands, eg. 18,890,000, to make large counts
+// easier for people to read. It is ignored by the outputs meant for programs,
+// like PrintBoMDirectoryStats(), whose counts are always plain numbers.
+func WithThousandsSeparators() PrintOption {
+	return func(po *printOptions) {
+		po.thousands = true
+	}
+}
+
+// PrintRunSummary writes the given RunSummary to the given writer in a form
+// meant for people to read, like:
+//
+//	BoMs: 2
+//	directories: 14
+//	files: 6
+//	size: 0.00 GiB
+//	elapsed: 1.5s
+//	BoM CASM: 4 files, 0.00 GiB, depth 2-5
+//
+// The size unit, rounding and thousands separator PrintOptions are respected.
+// The elapsed time is only included if there is one, and the BoMs are in
+// alphabetical order.
+func PrintRunSummary(w io.Writer, summary RunSummary, opts ...PrintOption) error {
+	po := newPrintOptions(opts)
+
+	if _, err := fmt.Fprintf(w, "BoMs: %s\ndirectories: %s\nfiles: %s\nsize: %.2f %s\n",
+		po.formatCount(uint64(summary.BoMs)), po.formatCount(uint64(summary.Directories)),
+		po.formatCount(summary.Files), po.convertSize(summary.Bytes), po.unit); err != nil {
+		return err
+	}
+
+	if summary.Elapsed > 0 {
+		if _, err := fmt.Fprintf(w, "elapsed: %s\n", summary.Elapsed); err != nil {
+			return err
+		}
+	}
+
+	boms := make([]string, 0, len(summary.PerBoM))
+	for bom := range summary.PerBoM {
+		boms = append(boms, bom)
+	}
+
+	slices.Sort(boms)
+
+	for _, bom := range boms {
+		bs := summary.PerBoM[bom]
+
+		if _, err := fmt.Fprintf(w, "BoM %s: %s files, %.2f %s, depth %d-%d\n", bom,
+			po.formatCount(bs.Files), po.convertSize(bs.Bytes), po.unit, bs.MinDepth, bs.MaxDepth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// formatCount returns the given count as a string, with thousands separators
+// if WithThousandsSeparators() was used.
+func (po *printOptions) formatCount(n uint64) string {
+	digits := strconv.FormatUint(n, 10)
+	if !po.thousands {
+		return digits
+	}
+
+	first := len(digits) % 3
+	if first == 0 {
+		first = 3
+	}
+
+	separated := []byte(digits[:first])
+
+	for i := first; i < len(digits); i += 3 {
+		separated = append(separated, ',')
+		separated = append(separated, digits[i:i+3]...)
+	}
+
+	return string(separated)
+}
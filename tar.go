@@ -0,0 +1,131 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"time"
+)
+
+const tarFileMode = 0644
+
+// WriteBoMDirectoryStatsTar is like PrintBoMDirectoryStats(), but instead of
+// creating one file per BoM, it creates a single tar archive at the given path
+// containing one "[bom name].tsv" member per BoM. If path ends in ".gz" or
+// ".tgz", the archive is gzip compressed.
+func WriteBoMDirectoryStatsTar(path string, stats []*Stats, opts ...PrintOption) (err error) {
+	po := newPrintOptions(opts)
+
+	f, err := po.createWithRetries(path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if errc := f.Close(); err == nil {
+			err = errc
+		}
+	}()
+
+	var w io.Writer = f
+
+	if strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".tgz") {
+		gw := gzip.NewWriter(f)
+
+		defer func() {
+			if errc := gw.Close(); err == nil {
+				err = errc
+			}
+		}()
+
+		w = gw
+	}
+
+	return po.writeTar(w, stats)
+}
+
+func (po *printOptions) writeTar(w io.Writer, stats []*Stats) error {
+	tw := tar.NewWriter(w)
+	boms, bomStats := groupByBoM(po.arrange(stats))
+	now := time.Now()
+
+	for _, bom := range boms {
+		rows := po.unskipped(bomStats[bom])
+		if len(rows) == 0 {
+			continue
+		}
+
+		var buf bytes.Buffer
+
+		if err := po.printRows(&buf, rows); err != nil {
+			return err
+		}
+
+		if err := writeTarMember(tw, bom+".tsv", buf.Bytes(), now); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func writeTarMember(tw *tar.Writer, name string, content []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(content)),
+		Mode:     tarFileMode,
+		ModTime:  modTime,
+	}); err != nil {
+		return err
+	}
+
+	_, err := tw.Write(content)
+
+	return err
+}
+
+// groupByBoM returns the BoMs of the given stats in the order they first
+// appear, along with each BoM's stats in their original order.
+func groupByBoM(stats []*Stats) ([]string, map[string][]*Stats) {
+	var boms []string
+
+	bomStats := make(map[string][]*Stats)
+
+	for _, s := range stats {
+		bom := string(s.BoM)
+
+		if _, ok := bomStats[bom]; !ok {
+			boms = append(boms, bom)
+		}
+
+		bomStats[bom] = append(bomStats[bom], s)
+	}
+
+	return boms, bomStats
+}
@@ -0,0 +1,101 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+const bytesPerMB = 1000 * 1000
+
+// ThroughputReader wraps a reader of an input file, recording how many bytes
+// were read from it and how long that took, so that you can find out which of
+// many inputs was slow to read (often a sign of bad compression or network
+// problems).
+type ThroughputReader struct {
+	name  string
+	r     io.Reader
+	bytes int64
+	start time.Time
+	end   time.Time
+}
+
+// NewThroughputReader returns a ThroughputReader that reads from the given
+// reader, which you name for reporting purposes (eg. after its file path).
+// Timing starts from the first Read().
+func NewThroughputReader(name string, r io.Reader) *ThroughputReader {
+	return &ThroughputReader{name: name, r: r}
+}
+
+// Read implements io.Reader.
+func (t *ThroughputReader) Read(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+
+	n, err := t.r.Read(p)
+	t.bytes += int64(n)
+	t.end = time.Now()
+
+	return n, err
+}
+
+// Throughput returns the name, number of bytes read and time spent reading so
+// far.
+func (t *ThroughputReader) Throughput() *Throughput {
+	return &Throughput{Name: t.name, Bytes: t.bytes, Duration: t.end.Sub(t.start)}
+}
+
+// Throughput holds the number of bytes read from a named input, and how long
+// that took.
+type Throughput struct {
+	Name     string
+	Bytes    int64
+	Duration time.Duration
+}
+
+// MBPerSec returns the read rate in decimal megabytes per second.
+func (t *Throughput) MBPerSec() float64 {
+	if t.Duration <= 0 {
+		return 0
+	}
+
+	return float64(t.Bytes) / bytesPerMB / t.Duration.Seconds()
+}
+
+// WriteThroughputReport writes the given Throughputs to the given writer as a
+// TSV with columns:
+//
+//	Name	Bytes	Duration	MB/s
+func WriteThroughputReport(w io.Writer, throughputs []*Throughput) error {
+	for _, t := range throughputs {
+		if _, err := fmt.Fprintf(w, "%s\t%d\t%s\t%.2f\n", t.Name, t.Bytes, t.Duration, t.MBPerSec()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
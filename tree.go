@@ -0,0 +1,104 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+const treeIndent = "  "
+
+// WithTreeLayout makes PrintBoMDirectoryStats() output each BoM's directories
+// in depth-first order, with each directory shown as just its basename beneath
+// its parent, indented by two spaces per level. Sibling directories keep their
+// relative order.
+func WithTreeLayout() PrintOption {
+	return func(po *printOptions) {
+		po.tree = true
+	}
+}
+
+// treeOrder reorders the given stats so that each BoM's directories are in
+// depth-first order, with parents before their children.
+func treeOrder(stats []*Stats) []*Stats {
+	boms, bomStats := groupByBoM(stats)
+	ordered := make([]*Stats, 0, len(stats))
+
+	for _, bom := range boms {
+		ordered = appendDepthFirst(ordered, bomStats[bom])
+	}
+
+	return ordered
+}
+
+// appendDepthFirst appends the given single BoM's stats to ordered in
+// depth-first order.
+func appendDepthFirst(ordered, stats []*Stats) []*Stats {
+	present := make(map[string]bool, len(stats))
+
+	for _, s := range stats {
+		present[s.Directory] = true
+	}
+
+	children := make(map[string][]*Stats)
+
+	var roots []*Stats
+
+	for _, s := range stats {
+		parent := path.Dir(s.Directory)
+
+		if s.Directory == "/" || !present[parent] {
+			roots = append(roots, s)
+		} else {
+			children[parent] = append(children[parent], s)
+		}
+	}
+
+	var visit func(s *Stats)
+
+	visit = func(s *Stats) {
+		ordered = append(ordered, s)
+
+		for _, child := range children[s.Directory] {
+			visit(child)
+		}
+	}
+
+	for _, root := range roots {
+		visit(root)
+	}
+
+	return ordered
+}
+
+// treeName returns the given directory's basename, indented according to its
+// depth.
+func treeName(dir string) string {
+	if dir == "/" {
+		return dir
+	}
+
+	return strings.Repeat(treeIndent, strings.Count(dir, "/")) + path.Base(dir)
+}
@@ -0,0 +1,224 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//
+//	Sendu Bala <sb10@sanger.ac.uk>.
+//	Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+const (
+	ErrBadStatsTSV       = Error("invalid stats tsv line")
+	ErrBadStatsTSVHeader = Error("unsupported stats tsv header")
+	ErrNoStatsTSVHeader  = Error("stats tsv has no header row, so the unit of its sizes is unknown")
+	minStatsTSVColumns   = 3
+	statsTSVHeader       = "directory\t"
+	statsTSVBoMHeader    = "bom\t" + statsTSVHeader
+)
+
+// statsTSVLayout describes the columns of a stats TSV: the index of each
+// column we parse (-1 if absent), and the unit of the size column.
+type statsTSVLayout struct {
+	bom       int
+	directory int
+	count     int
+	size      int
+	divisor   int64
+	columns   int
+}
+
+// headerlessStatsTSVLayout returns the layout of a stats TSV without a header
+// row, with sizes in the given unit.
+func headerlessStatsTSVLayout(unit SizeUnit) statsTSVLayout {
+	return statsTSVLayout{
+		bom:       -1,
+		directory: 0,
+		count:     1,
+		size:      2,
+		divisor:   unit.divisor(),
+		columns:   minStatsTSVColumns,
+	}
+}
+
+// ParseStatsTSV parses a file written by PrintBoMDirectoryStats() for the given
+// BoM back in to Stats.
+//
+// If the file has a header row (as written with WithBytesColumn()), the
+// columns are found by name, so files written WithBoMColumn(), or with any
+// other extra columns, can be parsed, and sizes are taken from the bytes
+// column, or else the column named after the size unit. A "bom" column, if
+// present, gives the BoM of each row instead of the given BoM. Headers
+// without the directory, count and a size column are rejected with
+// ErrBadStatsTSVHeader.
+//
+// Files without a header (as written without WithBytesColumn()) don't say
+// what unit their sizes are in, so are rejected with ErrNoStatsTSVHeader; use
+// ParseStatsTSVWithUnit() for those. Since sizes were rounded to 2 decimal
+// places of the unit, the Sizes parsed from files without a bytes column are
+// only accurate to within about 10MiB.
+func ParseStatsTSV(r io.Reader, bom string) ([]*Stats, error) {
+	return parseStatsTSV(r, bom, nil)
+}
+
+// ParseStatsTSVWithUnit is like ParseStatsTSV(), but also parses files without
+// a header, taking them to have directory, count and size columns, with sizes
+// in the given unit; any comment lines and extra columns after the size are
+// ignored.
+func ParseStatsTSVWithUnit(r io.Reader, bom string, unit SizeUnit) ([]*Stats, error) {
+	layout := headerlessStatsTSVLayout(unit)
+
+	return parseStatsTSV(r, bom, &layout)
+}
+
+// parseStatsTSV parses a stats TSV using the given layout until a header row
+// gives a different one. Rows before any header are rejected if the given
+// layout is nil.
+func parseStatsTSV(r io.Reader, bom string, layout *statsTSVLayout) ([]*Stats, error) {
+	var stats []*Stats
+
+	scanner := bufio.NewScanner(r)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Bytes()
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		if isStatsTSVHeader(line) {
+			header, err := parseStatsTSVHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+
+			layout = &header
+
+			continue
+		}
+
+		if layout == nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, ErrNoStatsTSVHeader)
+		}
+
+		s, err := layout.parseLine(line, bom)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		stats = append(stats, s)
+	}
+
+	return stats, scanner.Err()
+}
+
+// isStatsTSVHeader returns true if the given line is a header row, which starts
+// with the directory column, or the bom column and then the directory column.
+func isStatsTSVHeader(line []byte) bool {
+	return bytes.HasPrefix(line, []byte(statsTSVHeader)) || bytes.HasPrefix(line, []byte(statsTSVBoMHeader))
+}
+
+// parseStatsTSVHeader returns the layout described by the given header row.
+func parseStatsTSVHeader(line []byte) (statsTSVLayout, error) {
+	layout := statsTSVLayout{bom: -1, directory: -1, count: -1, size: -1}
+	unitCol := -1
+
+	var unit int64
+
+	cols := bytes.Split(line, []byte{'\t'})
+
+	for i, col := range cols {
+		switch string(col) {
+		case "bom":
+			layout.bom = i
+		case "directory":
+			layout.directory = i
+		case "count":
+			layout.count = i
+		case "bytes":
+			layout.size = i
+			layout.divisor = 1
+		case GiB.String():
+			unitCol, unit = i, GiB.divisor()
+		case GB.String():
+			unitCol, unit = i, GB.divisor()
+		}
+	}
+
+	if layout.size == -1 {
+		layout.size, layout.divisor = unitCol, unit
+	}
+
+	if layout.directory == -1 || layout.count == -1 || layout.size == -1 {
+		return layout, fmt.Errorf("%w: %s", ErrBadStatsTSVHeader, line)
+	}
+
+	layout.columns = max(layout.bom, layout.directory, layout.count, layout.size) + 1
+
+	return layout, nil
+}
+
+// parseLine parses the given row of a stats TSV with this layout, using the
+// given BoM unless the layout has a bom column.
+func (sl statsTSVLayout) parseLine(line []byte, bom string) (*Stats, error) {
+	cols := bytes.Split(line, []byte{'\t'})
+	if len(cols) < sl.columns {
+		return nil, ErrBadStatsTSV
+	}
+
+	count, err := strconv.ParseUint(string(cols[sl.count]), 10, 64)
+	if err != nil {
+		return nil, ErrBadStatsTSV
+	}
+
+	size, err := sl.parseSize(cols[sl.size])
+	if err != nil {
+		return nil, ErrBadStatsTSV
+	}
+
+	if sl.bom != -1 {
+		bom = string(cols[sl.bom])
+	}
+
+	return &Stats{
+		BoM:       []byte(bom),
+		Directory: string(cols[sl.directory]),
+		Count:     count,
+		Size:      size,
+	}, nil
+}
+
+// parseSize parses the given size column, which is in bytes if our divisor is
+// 1, otherwise in the unit with our divisor.
+func (sl statsTSVLayout) parseSize(col []byte) (int64, error) {
+	if sl.divisor == 1 {
+		return strconv.ParseInt(string(col), 10, 64)
+	}
+
+	units, err := strconv.ParseFloat(string(col), 64)
+
+	return int64(math.Round(units * float64(sl.divisor))), err
+}
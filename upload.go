@@ -0,0 +1,148 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrConcurrentFileOptions is returned by WriteBoMDirectoryStatsConcurrently()
+// if given options that change which files PrintBoMDirectoryStats() writes.
+const ErrConcurrentFileOptions = Error("WithMaxRowsPerFile(), WithTopDirSplit(), WithColdSplit(), " +
+	"WithEmptyBoMFiles(), WithIndex() and WithStaleFileRemoval() are not supported when writing concurrently")
+
+// Uploader is something that can stream data to keys in an object store, such
+// as an S3 multipart upload.
+type Uploader interface {
+	// Upload starts a streaming upload to the given key. The upload must be
+	// completed when the returned writer is closed, with Close() returning any
+	// error completing it.
+	Upload(key string) (io.WriteCloser, error)
+}
+
+// UploadBoMDirectoryStats is like PrintBoMDirectoryStats(), but streams each
+// BoM's TSV to the given Uploader under the key "[prefix].[bom name].tsv",
+// uploading all BoMs concurrently. It only returns once every upload has been
+// closed, returning all the errors that occurred. Like
+// WriteBoMDirectoryStatsConcurrently(), it rejects options that change which
+// files are written.
+func UploadBoMDirectoryStats(u Uploader, prefix string, stats []*Stats, opts ...PrintOption) error {
+	return WriteBoMDirectoryStatsConcurrently(prefix, stats, append(opts, WithWriterFactory(u.Upload))...)
+}
+
+// WriteBoMDirectoryStatsConcurrently is like PrintBoMDirectoryStats(), but
+// writes each BoM's file concurrently. Every writer is closed before
+// returning, and all errors that occurred are returned joined together.
+//
+// Only one file per BoM is written, so options that would write other files,
+// or remove them, are rejected with ErrConcurrentFileOptions.
+//
+// This is most useful with a WithWriterFactory() option that writes to a
+// high-latency destination.
+func WriteBoMDirectoryStatsConcurrently(path string, stats []*Stats, opts ...PrintOption) error {
+	po := newPrintOptions(opts)
+	if po.changesFiles() {
+		return ErrConcurrentFileOptions
+	}
+
+	boms, bomStats := groupByBoM(po.arrange(stats))
+	errs := make([]error, len(boms))
+
+	var wg sync.WaitGroup
+
+	for i, bom := range boms {
+		wg.Add(1)
+
+		go func(i int, bom string) {
+			defer wg.Done()
+
+			errs[i] = po.writeBoMFile(fmt.Sprintf("%s.%s.tsv", path, bom), bomStats[bom])
+		}(i, bom)
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// changesFiles returns true if we have options that make
+// PrintBoMDirectoryStats() write files other than one per BoM, or remove files.
+func (po *printOptions) changesFiles() bool {
+	return po.maxRows > 0 || po.splitTopDir || po.splitCold || po.emptyBoMs != nil ||
+		po.index != nil || po.removeStale
+}
+
+// writeBoMFile creates the named file and writes the given single BoM's stats
+// to it, closing it afterwards. Nothing is created if all the stats would be
+// skipped.
+func (po *printOptions) writeBoMFile(name string, stats []*Stats) (err error) {
+	rows := po.unskipped(stats)
+	if len(rows) == 0 {
+		return nil
+	}
+
+	w, err := po.createWithRetries(name)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if errc := w.Close(); err == nil {
+			err = errc
+		}
+	}()
+
+	return po.printRows(w, rows)
+}
+
+// unskipped returns the given stats minus those that skip() says should not be
+// printed.
+func (po *printOptions) unskipped(stats []*Stats) []*Stats {
+	rows := make([]*Stats, 0, len(stats))
+
+	for _, s := range stats {
+		if !po.skip(s) {
+			rows = append(rows, s)
+		}
+	}
+
+	return rows
+}
+
+func (po *printOptions) printRows(w io.Writer, stats []*Stats) error {
+	if err := po.printHeader(w); err != nil {
+		return err
+	}
+
+	for _, s := range stats {
+		if err := po.printRow(w, s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
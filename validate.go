@@ -0,0 +1,72 @@
+// Copyright © 2024 Genome Research Limited
+// Authors:
+//  Sendu Bala <sb10@sanger.ac.uk>.
+//  Dan Elia <de7@sanger.ac.uk>.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"path"
+)
+
+const ErrStatsDontSum = Error("count or size is not the sum of its subdirectories and own files")
+
+// ValidateStats checks that, for every directory in the given
+// BoMDirectoryStats() results, the Count and Size equal the sum of those of its
+// direct subdirectories plus its OwnCount and OwnSize. Returns an error for
+// each directory where this isn't the case, which would indicate a bug or
+// truncated input. Returns nil if the stats are valid.
+func ValidateStats(stats []*Stats) []error {
+	sums := make(map[string]*Stats)
+
+	for _, s := range stats {
+		if s.Directory == "/" {
+			continue
+		}
+
+		parent := bomDirKey(s.BoM, path.Dir(s.Directory))
+
+		sum, ok := sums[parent]
+		if !ok {
+			sum = &Stats{}
+			sums[parent] = sum
+		}
+
+		sum.Count += s.Count
+		sum.Size += s.Size
+	}
+
+	var errs []error
+
+	for _, s := range stats {
+		sum := sums[bomDirKey(s.BoM, s.Directory)]
+		if sum == nil {
+			sum = &Stats{}
+		}
+
+		if s.Count != sum.Count+s.OwnCount || s.Size != sum.Size+s.OwnSize {
+			errs = append(errs, fmt.Errorf("%s %s: %w", s.BoM, s.Directory, ErrStatsDontSum))
+		}
+	}
+
+	return errs
+}